@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/config"
+	"net/http"
+)
+
+type Role string
+
+const (
+	RoleAnonymous Role = "anonymous"
+	RoleAuthor    Role = "author"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+type Identity struct {
+	Subject string
+	Role    Role
+}
+
+var Anonymous = Identity{Role: RoleAnonymous}
+
+func (id Identity) IsAnonymous() bool {
+	return id.Role == RoleAnonymous
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity attached to the request context, or Anonymous when the caller
+// has not been identified.
+func FromContext(ctx context.Context) Identity {
+	if id, ok := ctx.Value(identityKey{}).(Identity); ok {
+		return id
+	}
+	return Anonymous
+}
+
+// Authenticator identifies the caller of a request. It returns ok=false when the request carries no
+// credentials it understands, and an error when it does but they are invalid.
+type Authenticator interface {
+	Authenticate(r *http.Request) (id Identity, ok bool, err error)
+}
+
+type InvalidCredentialsError struct {
+	reason string
+}
+
+func (e InvalidCredentialsError) Error() string {
+	return "Invalid credentials: " + e.reason
+}
+
+const ApiKeyHeader = "X-Api-Key"
+
+type ApiKeyAuthenticator struct {
+	keys map[string]Identity
+}
+
+func NewApiKeyAuthenticator(keys []config.ApiKeyConfig) *ApiKeyAuthenticator {
+	a := &ApiKeyAuthenticator{keys: make(map[string]Identity, len(keys))}
+	for _, k := range keys {
+		a.keys[k.Key] = Identity{Subject: k.Subject, Role: Role(k.Role)}
+	}
+	return a
+}
+
+func (a *ApiKeyAuthenticator) Authenticate(r *http.Request) (Identity, bool, error) {
+	key := r.Header.Get(ApiKeyHeader)
+	if key == "" {
+		return Anonymous, false, nil
+	}
+	id, ok := a.keys[key]
+	if !ok {
+		return Anonymous, false, InvalidCredentialsError{reason: "unknown API key"}
+	}
+	return id, true, nil
+}
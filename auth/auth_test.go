@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/config"
+	"net/http/httptest"
+	"testing"
+)
+
+var (
+	alice = Identity{Subject: "alice", Role: RoleAuthor}
+	mod   = Identity{Subject: "mod", Role: RoleModerator}
+	root  = Identity{Subject: "root", Role: RoleAdmin}
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	tests := []struct {
+		testName string
+		identity Identity
+		action   Action
+		owner    string
+		expected bool
+	}{
+		{"anonymousReadsPosts", Anonymous, PostsRead, "", true},
+		{"anonymousCannotCreatePosts", Anonymous, PostsCreate, "", false},
+		{"authorUpdatesOwnPost", alice, PostsUpdate, "alice", true},
+		{"authorCannotUpdateOthersPost", alice, PostsUpdate, "bob", false},
+		{"authorCannotHideComments", alice, CommentsHide, "", false},
+		{"moderatorHidesComments", mod, CommentsHide, "", true},
+		{"moderatorDeletesComments", mod, CommentsDelete, "", true},
+		{"moderatorCannotUpdatePosts", mod, PostsUpdate, "mod", false},
+		{"adminDoesEverything", root, PostsDelete, "bob", true},
+		{"unknownRoleHasNoPermissions", Identity{Subject: "x", Role: "guest"}, PostsRead, "", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expected, DefaultPolicy().Allowed(tc.identity, tc.action, tc.owner))
+		})
+	}
+}
+
+func TestOwnScopeRequiresSubject(t *testing.T) {
+	policy, err := NewPolicy(config.RbacConfig{Roles: map[string][]string{"anonymous": {"posts:update:own"}}})
+	assert.NoError(t, err)
+	assert.False(t, policy.Allowed(Anonymous, PostsUpdate, ""))
+}
+
+func TestHolds(t *testing.T) {
+	tests := []struct {
+		testName string
+		identity Identity
+		action   Action
+		expected bool
+	}{
+		{"anonymousReadsPosts", Anonymous, PostsRead, true},
+		{"anonymousCannotUpdatePosts", Anonymous, PostsUpdate, false},
+		{"authorUpdatesOwnPosts", alice, PostsUpdate, true},
+		{"moderatorCannotDeletePosts", mod, PostsDelete, false},
+		{"adminDoesEverything", root, PostsDelete, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expected, DefaultPolicy().Holds(tc.identity, tc.action))
+		})
+	}
+}
+
+func TestNewPolicyRejectsUnknownPermission(t *testing.T) {
+	_, err := NewPolicy(config.RbacConfig{Roles: map[string][]string{"author": {"posts:publish"}}})
+	assert.EqualError(t, err, "Role author has invalid permission: posts:publish")
+}
+
+func TestApiKeyAuthenticator(t *testing.T) {
+	authenticator := NewApiKeyAuthenticator([]config.ApiKeyConfig{{Key: "k", Subject: "alice", Role: "author"}})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	_, ok, err := authenticator.Authenticate(req)
+	assert.False(t, ok)
+	assert.NoError(t, err)
+
+	req.Header.Set(ApiKeyHeader, "k")
+	id, ok, err := authenticator.Authenticate(req)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, alice, id)
+
+	req.Header.Set(ApiKeyHeader, "nope")
+	_, _, err = authenticator.Authenticate(req)
+	assert.Error(t, err)
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/config"
+	"golang.org/x/oauth2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SessionCookie     = "blog_session"
+	defaultSessionTtl = 12 * time.Hour
+	loginTimeout      = 10 * time.Minute
+)
+
+// OidcRelyingParty signs callers in through an OpenID Connect provider using the authorization code
+// flow with PKCE, and then recognises them by a session cookie or by a bearer ID token.
+type OidcRelyingParty struct {
+	cfg      config.OidcConfig
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+
+	mu       sync.Mutex
+	logins   map[string]pendingLogin
+	sessions map[string]session
+	now      func() time.Time
+}
+
+type pendingLogin struct {
+	codeVerifier string
+	nonce        string
+	expires      time.Time
+}
+
+type session struct {
+	identity Identity
+	expires  time.Time
+}
+
+type LoginFailedError struct {
+	reason string
+}
+
+func (e LoginFailedError) Error() string {
+	return "Login failed: " + e.reason
+}
+
+// NewOidcRelyingParty discovers the provider configuration from cfg.Issuer. The context is used for
+// discovery and for all later JWKS fetches, so it should live as long as the relying party.
+func NewOidcRelyingParty(ctx context.Context, cfg config.OidcConfig) (*OidcRelyingParty, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("could not discover OIDC provider %s: %w", cfg.Issuer, err)
+	}
+
+	scopes := []string{oidc.ScopeOpenID}
+	for _, scope := range cfg.Scopes {
+		if scope != oidc.ScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+	if cfg.SubjectClaim == "" {
+		cfg.SubjectClaim = "sub"
+	}
+	if cfg.DefaultRole == "" {
+		cfg.DefaultRole = string(RoleAnonymous)
+	}
+
+	return &OidcRelyingParty{
+		cfg: cfg,
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientId,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectUrl,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientId}),
+		logins:   make(map[string]pendingLogin),
+		sessions: make(map[string]session),
+		now:      time.Now,
+	}, nil
+}
+
+// AuthCodeURL starts a login and returns the provider URL the caller should be redirected to.
+func (rp *OidcRelyingParty) AuthCodeURL() string {
+	state, nonce, codeVerifier := randomToken(), randomToken(), oauth2.GenerateVerifier()
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	now := rp.now()
+	for s, login := range rp.logins {
+		if now.After(login.expires) {
+			delete(rp.logins, s)
+		}
+	}
+	rp.logins[state] = pendingLogin{codeVerifier: codeVerifier, nonce: nonce, expires: now.Add(loginTimeout)}
+
+	return rp.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier))
+}
+
+// Exchange completes a login started by AuthCodeURL. It redeems the authorization code, validates the
+// ID token and returns the caller's identity together with a new session token.
+func (rp *OidcRelyingParty) Exchange(ctx context.Context, code, state string) (Identity, string, error) {
+	rp.mu.Lock()
+	login, ok := rp.logins[state]
+	delete(rp.logins, state)
+	rp.mu.Unlock()
+	if !ok || rp.now().After(login.expires) {
+		return Anonymous, "", LoginFailedError{reason: "unknown or expired state"}
+	}
+
+	token, err := rp.oauth2.Exchange(ctx, code, oauth2.VerifierOption(login.codeVerifier))
+	if err != nil {
+		return Anonymous, "", LoginFailedError{reason: err.Error()}
+	}
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Anonymous, "", LoginFailedError{reason: "token response has no id_token"}
+	}
+	idToken, err := rp.verifier.Verify(ctx, rawIdToken)
+	if err != nil {
+		return Anonymous, "", LoginFailedError{reason: err.Error()}
+	}
+	if idToken.Nonce != login.nonce {
+		return Anonymous, "", LoginFailedError{reason: "nonce mismatch"}
+	}
+	id, err := rp.identity(idToken)
+	if err != nil {
+		return Anonymous, "", err
+	}
+
+	ttl := time.Duration(rp.cfg.SessionTtl)
+	if ttl <= 0 {
+		ttl = defaultSessionTtl
+	}
+	sessionToken := randomToken()
+	rp.mu.Lock()
+	rp.sessions[sessionToken] = session{identity: id, expires: rp.now().Add(ttl)}
+	rp.mu.Unlock()
+	return id, sessionToken, nil
+}
+
+func (rp *OidcRelyingParty) Logout(sessionToken string) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	delete(rp.sessions, sessionToken)
+}
+
+// Authenticate accepts either the session cookie issued after a login or an ID token issued by the
+// provider for our client, sent as "Authorization: Bearer <token>".
+func (rp *OidcRelyingParty) Authenticate(r *http.Request) (Identity, bool, error) {
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		rp.mu.Lock()
+		s, ok := rp.sessions[cookie.Value]
+		rp.mu.Unlock()
+		if !ok || rp.now().After(s.expires) {
+			return Anonymous, false, InvalidCredentialsError{reason: "session expired"}
+		}
+		return s.identity, true, nil
+	}
+
+	rawIdToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return Anonymous, false, nil
+	}
+	idToken, err := rp.verifier.Verify(r.Context(), rawIdToken)
+	if err != nil {
+		return Anonymous, false, InvalidCredentialsError{reason: err.Error()}
+	}
+	id, err := rp.identity(idToken)
+	if err != nil {
+		return Anonymous, false, InvalidCredentialsError{reason: err.Error()}
+	}
+	return id, true, nil
+}
+
+// identity maps the claims of a validated ID token onto the caller's subject and role.
+func (rp *OidcRelyingParty) identity(idToken *oidc.IDToken) (Identity, error) {
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return Anonymous, LoginFailedError{reason: err.Error()}
+	}
+
+	subject, _ := claims[rp.cfg.SubjectClaim].(string)
+	if subject == "" {
+		return Anonymous, LoginFailedError{reason: fmt.Sprintf("ID token has no %s claim", rp.cfg.SubjectClaim)}
+	}
+
+	var values []string
+	switch v := claims[rp.cfg.RoleClaim].(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	role := Role(rp.cfg.DefaultRole)
+mappings:
+	for _, mapping := range rp.cfg.RoleMappings {
+		for _, value := range values {
+			if value == mapping.Value {
+				role = Role(mapping.Role)
+				break mappings
+			}
+		}
+	}
+	return Identity{Subject: subject, Role: role}, nil
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth/oidctest"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/config"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const testRedirectUrl = "http://blog.test/auth/callback"
+
+func newTestRelyingParty(t *testing.T) (*OidcRelyingParty, *oidctest.Provider) {
+	provider := oidctest.NewProvider("blog", "secret")
+	t.Cleanup(provider.Close)
+
+	rp, err := NewOidcRelyingParty(context.Background(), config.OidcConfig{
+		Issuer:       provider.Issuer(),
+		ClientId:     "blog",
+		ClientSecret: "secret",
+		RedirectUrl:  testRedirectUrl,
+		Scopes:       []string{"email"},
+		SubjectClaim: "email",
+		RoleClaim:    "groups",
+		RoleMappings: []config.RoleMapping{
+			{Value: "blog-admins", Role: "admin"},
+			{Value: "blog-authors", Role: "author"},
+		},
+		DefaultRole: "anonymous",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rp, provider
+}
+
+// login follows the authorization redirect and returns the code and state the provider sent back.
+func login(t *testing.T, rp *OidcRelyingParty) (string, string) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(rp.AuthCodeURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestOidcLoginMapsClaimsOntoRoles(t *testing.T) {
+	tests := []struct {
+		testName string
+		claims   map[string]interface{}
+		expected Identity
+	}{
+		{
+			testName: "firstMatchingMappingWins",
+			claims:   map[string]interface{}{"sub": "1", "email": "alice@corp", "groups": []string{"blog-authors", "blog-admins"}},
+			expected: Identity{Subject: "alice@corp", Role: RoleAdmin},
+		},
+		{
+			testName: "stringClaim",
+			claims:   map[string]interface{}{"sub": "2", "email": "bob@corp", "groups": "blog-authors"},
+			expected: Identity{Subject: "bob@corp", Role: RoleAuthor},
+		},
+		{
+			testName: "defaultRole",
+			claims:   map[string]interface{}{"sub": "3", "email": "eve@corp"},
+			expected: Identity{Subject: "eve@corp", Role: RoleAnonymous},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			rp, provider := newTestRelyingParty(t)
+			provider.SetUser(tc.claims)
+			code, state := login(t, rp)
+
+			// WHEN
+			id, sessionToken, err := rp.Exchange(context.Background(), code, state)
+
+			// THEN
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, id)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(&http.Cookie{Name: SessionCookie, Value: sessionToken})
+			sessionId, ok, err := rp.Authenticate(req)
+			assert.True(t, ok)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, sessionId)
+		})
+	}
+}
+
+func TestOidcExchangeRejectsReplayedState(t *testing.T) {
+	rp, provider := newTestRelyingParty(t)
+	provider.SetUser(map[string]interface{}{"sub": "1", "email": "alice@corp"})
+	code, state := login(t, rp)
+
+	_, _, err := rp.Exchange(context.Background(), code, state)
+	assert.NoError(t, err)
+	_, _, err = rp.Exchange(context.Background(), code, state)
+	assert.EqualError(t, err, "Login failed: unknown or expired state")
+}
+
+func TestOidcBearerIdToken(t *testing.T) {
+	rp, provider := newTestRelyingParty(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+provider.IdToken(map[string]interface{}{"email": "alice@corp", "groups": "blog-authors"}))
+	id, ok, err := rp.Authenticate(req)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, Identity{Subject: "alice@corp", Role: RoleAuthor}, id)
+
+	req.Header.Set("Authorization", "Bearer "+provider.IdToken(map[string]interface{}{"email": "alice@corp", "aud": "other-client"}))
+	_, _, err = rp.Authenticate(req)
+	assert.Error(t, err)
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/config"
+	"strings"
+)
+
+type Action string
+
+const (
+	PostsRead      Action = "posts:read"
+	PostsCreate    Action = "posts:create"
+	PostsUpdate    Action = "posts:update"
+	PostsDelete    Action = "posts:delete"
+	CommentsRead   Action = "comments:read"
+	CommentsCreate Action = "comments:create"
+	CommentsHide   Action = "comments:hide"
+	CommentsDelete Action = "comments:delete"
+	AdminExport    Action = "admin:export"
+	AdminImport    Action = "admin:import"
+)
+
+var knownActions = map[Action]bool{
+	PostsRead: true, PostsCreate: true, PostsUpdate: true, PostsDelete: true,
+	CommentsRead: true, CommentsCreate: true, CommentsHide: true, CommentsDelete: true,
+	AdminExport: true, AdminImport: true,
+}
+
+const (
+	wildcard  = "*"
+	ownSuffix = ":own"
+)
+
+// grant is the scope in which a role holds a permission; the zero value means not at all.
+type grant int
+
+const (
+	scopeNone grant = iota
+	scopeAny
+	scopeOwn
+)
+
+type Policy struct {
+	roles map[Role]map[Action]grant
+	all   map[Role]bool
+}
+
+type InvalidPermissionError struct {
+	role       string
+	permission string
+}
+
+func (e InvalidPermissionError) Error() string {
+	return fmt.Sprintf("Role %s has invalid permission: %s", e.role, e.permission)
+}
+
+func NewPolicy(cfg config.RbacConfig) (*Policy, error) {
+	p := &Policy{roles: make(map[Role]map[Action]grant), all: make(map[Role]bool)}
+	for role, permissions := range cfg.Roles {
+		grants := make(map[Action]grant)
+		for _, permission := range permissions {
+			if permission == wildcard {
+				p.all[Role(role)] = true
+				continue
+			}
+			scope := scopeAny
+			if strings.HasSuffix(permission, ownSuffix) {
+				scope = scopeOwn
+				permission = strings.TrimSuffix(permission, ownSuffix)
+			}
+			action := Action(permission)
+			if !knownActions[action] {
+				return nil, InvalidPermissionError{role: role, permission: permission}
+			}
+			if grants[action] != scopeAny {
+				grants[action] = scope
+			}
+		}
+		p.roles[Role(role)] = grants
+	}
+	return p, nil
+}
+
+// DefaultPolicy lets anybody read and comment, authors manage their own posts, moderators hide or
+// delete any comment, and admins do everything.
+func DefaultPolicy() *Policy {
+	p, err := NewPolicy(DefaultRbacConfig())
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func DefaultRbacConfig() config.RbacConfig {
+	return config.RbacConfig{Roles: map[string][]string{
+		string(RoleAnonymous): {"posts:read", "comments:read", "comments:create"},
+		string(RoleAuthor): {"posts:read", "comments:read", "comments:create",
+			"posts:create", "posts:update:own", "posts:delete:own"},
+		string(RoleModerator): {"posts:read", "comments:read", "comments:create",
+			"comments:hide", "comments:delete"},
+		string(RoleAdmin): {"*"},
+	}}
+}
+
+// Allowed reports whether the identity may perform the action on a resource owned by owner.
+// Pass an empty owner for actions that do not target an existing resource.
+func (p *Policy) Allowed(id Identity, action Action, owner string) bool {
+	if p.all[id.Role] {
+		return true
+	}
+	switch p.roles[id.Role][action] {
+	case scopeAny:
+		return true
+	case scopeOwn:
+		return !id.IsAnonymous() && id.Subject != "" && id.Subject == owner
+	default:
+		return false
+	}
+}
+
+// Holds reports whether the identity may perform the action on some resource, if only on its own. It
+// lets a request be turned away before the resource is looked up; Allowed decides on the resource.
+func (p *Policy) Holds(id Identity, action Action) bool {
+	if p.all[id.Role] {
+		return true
+	}
+	switch p.roles[id.Role][action] {
+	case scopeAny:
+		return true
+	case scopeOwn:
+		return !id.IsAnonymous() && id.Subject != ""
+	default:
+		return false
+	}
+}
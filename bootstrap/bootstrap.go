@@ -1,10 +1,96 @@
 package bootstrap
 
 import (
+	"context"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/compression"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/config"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/dto"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/idempotency"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/ratelimit"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/repository"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/scheduler"
 	"gitlab.com/devskiller-tasks/rest-api-blog-golang/service"
+	"log"
+	"time"
 )
 
-func Init(port int) error {
-	api := service.NewRestApiService()
+func Init(port int, cfg config.Config) error {
+	var opts []service.Option
+	if len(cfg.ApiKeys) > 0 {
+		opts = append(opts, service.WithAuthenticators(auth.NewApiKeyAuthenticator(cfg.ApiKeys)))
+	}
+	if cfg.Oidc != nil {
+		rp, err := auth.NewOidcRelyingParty(context.Background(), *cfg.Oidc)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, service.WithOidc(rp))
+	}
+	if cfg.Rbac != nil {
+		policy, err := auth.NewPolicy(*cfg.Rbac)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, service.WithPolicy(policy))
+	}
+	if len(cfg.RateLimits) > 0 {
+		limits := make(map[string]ratelimit.Limit, len(cfg.RateLimits))
+		for route, limit := range cfg.RateLimits {
+			limits[route] = ratelimit.Limit{Requests: limit.Requests, Per: time.Duration(limit.Per), Burst: limit.Burst}
+		}
+		limiter, err := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), limits)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, service.WithRateLimiter(limiter))
+	}
+	if cfg.Idempotency.Ttl > 0 {
+		opts = append(opts, service.WithIdempotency(idempotency.NewMemoryStore(), time.Duration(cfg.Idempotency.Ttl)))
+	}
+	if cfg.RequireIfMatch {
+		opts = append(opts, service.WithRequiredIfMatch())
+	}
+	if len(cfg.CacheControl) > 0 {
+		opts = append(opts, service.WithCacheControl(cfg.CacheControl))
+	}
+	if cfg.Compression != nil {
+		for _, coding := range cfg.Compression.Encodings {
+			if !compression.IsSupported(coding) {
+				return compression.UnsupportedEncodingError{Coding: coding}
+			}
+		}
+		opts = append(opts, service.WithCompression(cfg.Compression.MinSize, cfg.Compression.Encodings...))
+	}
+	for name, deprecation := range cfg.Deprecations {
+		version, err := dto.ParseVersion(name)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, service.WithDeprecation(version, deprecation.Date, deprecation.Sunset))
+	}
+	if cfg.DisableRequestValidation {
+		opts = append(opts, service.WithRequestValidation(false))
+	}
+	if cfg.ValidateResponses {
+		opts = append(opts, service.WithResponseValidation(func(err error) {
+			log.Printf("response does not conform to the OpenAPI document: %v", err)
+		}))
+	}
+	if cfg.BatchLimit > 0 {
+		opts = append(opts, service.WithBatchLimit(cfg.BatchLimit))
+	}
+	if cfg.Revisions != nil {
+		opts = append(opts, service.WithRevisionRetention(repository.RetentionPolicy{
+			MaxCount: cfg.Revisions.MaxCount, MaxAge: time.Duration(cfg.Revisions.MaxAge),
+		}))
+	}
+
+	// The scheduler publishes from the repository the service keeps its posts in.
+	posts := repository.NewPostRepository()
+	opts = append(opts, service.WithPostRepository(posts))
+	go scheduler.New(posts, time.Duration(cfg.PublishInterval)).Run(context.Background())
+
+	api := service.NewRestApiService(opts...)
 	return api.ServeContent(port)
 }
@@ -0,0 +1,567 @@
+// Package client is a Go client of the blog API. It speaks v2 of the API and maps its payloads onto
+// the domain model.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	v2 "gitlab.com/devskiller-tasks/rest-api-blog-golang/dto/v2"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"io"
+	"math"
+	mathrand "math/rand"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetries     = 3
+	defaultBackoff     = 100 * time.Millisecond
+	defaultMaxBackoff  = 5 * time.Second
+	maxErrorBodyLength = 4096
+)
+
+type Client struct {
+	baseUrl    *url.URL
+	httpClient *http.Client
+	auth       Authenticator
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+type Option func(*Client)
+
+// New returns a client of the API served at baseUrl, e.g. "https://blog.example.com".
+func New(baseUrl string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(baseUrl)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid base URL: %q", baseUrl)
+	}
+	c := &Client{
+		baseUrl:    parsed,
+		httpClient: http.DefaultClient,
+		retries:    defaultRetries,
+		backoff:    defaultBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+func WithHttpClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+func WithAuth(auth Authenticator) Option {
+	return func(c *Client) {
+		c.auth = auth
+	}
+}
+
+// WithRetries sets how many times a request is retried after a network error, 429, 502, 503 or 504,
+// and the initial delay between attempts, which doubles after every attempt. Retry-After is honoured.
+// Zero retries disable retrying.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// Authenticator adds credentials to the requests of a client.
+type Authenticator interface {
+	Authenticate(r *http.Request) error
+}
+
+type AuthenticatorFunc func(r *http.Request) error
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) error {
+	return f(r)
+}
+
+// ApiKey authenticates requests with an API key, see the apiKeys configuration of the service.
+func ApiKey(key string) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) error {
+		r.Header.Set("X-Api-Key", key)
+		return nil
+	})
+}
+
+// BearerToken authenticates requests with an ID token of the identity provider.
+func BearerToken(token string) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) error {
+		r.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// Post is a post along with the ETag to send back in If-Match when updating or deleting it.
+type Post struct {
+	model.Post
+	ETag string
+}
+
+// PostUpdate replaces the title and content of a post; tags, category, status and content format are
+// kept when left empty. IfMatch, when set, makes the update fail with PostVersionMismatchError if the
+// post has been modified since it was read.
+type PostUpdate struct {
+	Title         string
+	Content       string
+	Tags          []string
+	Category      string
+	Status        model.PostStatus
+	PublishAt     *time.Time
+	ContentFormat model.ContentFormat
+	IfMatch       string
+}
+
+// CreatePost adds a post. The author defaults to the caller. Creates carry an Idempotency-Key, so that
+// retries never add a post twice.
+func (c *Client) CreatePost(ctx context.Context, post model.Post) error {
+	payload := v2.CreatePost{
+		Id: post.Id, Title: post.Title, Content: post.Content, Author: post.Author, Created: post.CreationDate,
+		Tags: post.Tags, Category: post.Category, Status: string(post.Status), PublishAt: post.PublishAt,
+		ContentFormat: string(post.ContentFormat),
+	}
+	_, err := c.do(ctx, http.MethodPost, "/posts", nil, payload, nil, func(apiErr *Error) error {
+		if apiErr.Status == http.StatusConflict {
+			return PostAlreadyExistsError{Id: post.Id, cause: apiErr}
+		}
+		return apiErr
+	})
+	return err
+}
+
+func (c *Client) GetPost(ctx context.Context, id uint64) (*Post, error) {
+	var post v2.Post
+	header, err := c.do(ctx, http.MethodGet, "/posts/"+strconv.FormatUint(id, 10), nil, nil, &post, postErrors(id))
+	if err != nil {
+		return nil, err
+	}
+	return &Post{Post: post.Model(), ETag: header.Get("ETag")}, nil
+}
+
+// ListPosts returns every post, ordered by id, following the pages of the listing.
+func (c *Client) ListPosts(ctx context.Context) ([]model.Post, error) {
+	result := make([]model.Post, 0)
+	query := url.Values{"limit": {strconv.Itoa(postPageSize)}}
+	for {
+		var posts []v2.Post
+		header, err := c.do(ctx, http.MethodGet, "/posts?"+query.Encode(), nil, nil, &posts, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, post := range posts {
+			result = append(result, post.Model())
+		}
+		cursor := nextCursor(header)
+		if cursor == "" {
+			return result, nil
+		}
+		query.Set("cursor", cursor)
+	}
+}
+
+// UpdatePost updates a post and returns its new ETag.
+func (c *Client) UpdatePost(ctx context.Context, id uint64, update PostUpdate) (string, error) {
+	header, err := c.do(ctx, http.MethodPut, "/posts/"+strconv.FormatUint(id, 10), ifMatch(update.IfMatch),
+		v2.UpdatePost{
+			Title: update.Title, Content: update.Content, Tags: update.Tags, Category: update.Category,
+			Status: string(update.Status), PublishAt: update.PublishAt, ContentFormat: string(update.ContentFormat),
+		}, nil, postErrors(id))
+	if err != nil {
+		return "", err
+	}
+	return header.Get("ETag"), nil
+}
+
+// DeletePost deletes a post and its comments. An empty etag deletes the post whatever its version.
+func (c *Client) DeletePost(ctx context.Context, id uint64, etag string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/posts/"+strconv.FormatUint(id, 10), ifMatch(etag), nil, nil, postErrors(id))
+	return err
+}
+
+// CreateComment adds a comment. Like posts, comments are created with an Idempotency-Key.
+func (c *Client) CreateComment(ctx context.Context, comment model.Comment) error {
+	payload := v2.CreateComment{
+		Id: comment.Id, PostId: comment.PostId, Body: comment.Comment, Author: comment.Author, Created: comment.CreationDate,
+		ParentId: comment.ParentId,
+	}
+	_, err := c.do(ctx, http.MethodPost, "/comments", nil, payload, nil, func(apiErr *Error) error {
+		if apiErr.Status == http.StatusConflict {
+			return CommentAlreadyExistsError{Id: comment.Id, cause: apiErr}
+		}
+		return apiErr
+	})
+	return err
+}
+
+// ListComments returns the visible comments of a post, oldest first, following the pages of the listing.
+func (c *Client) ListComments(ctx context.Context, postId uint64) ([]model.Comment, error) {
+	result := make([]model.Comment, 0)
+	query := url.Values{"postId": {strconv.FormatUint(postId, 10)}, "limit": {strconv.Itoa(commentPageSize)}}
+	for {
+		var comments []v2.Comment
+		header, err := c.do(ctx, http.MethodGet, "/comments?"+query.Encode(), nil, nil, &comments, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, comment := range comments {
+			result = append(result, comment.Model())
+		}
+		cursor := nextCursor(header)
+		if cursor == "" {
+			return result, nil
+		}
+		query.Set("cursor", cursor)
+	}
+}
+
+// commentPageSize and postPageSize are the largest pages of comments and posts the service serves.
+const (
+	commentPageSize = 200
+	postPageSize    = 200
+)
+
+// nextCursor returns the cursor of the next page named by the Link header of a page, if any.
+func nextCursor(header http.Header) string {
+	for _, link := range header.Values("Link") {
+		target, params, ok := strings.Cut(link, ";")
+		if !ok || strings.TrimSpace(params) != `rel="next"` {
+			continue
+		}
+		next, err := url.Parse(strings.Trim(strings.TrimSpace(target), "<>"))
+		if err == nil {
+			return next.Query().Get("cursor")
+		}
+	}
+	return ""
+}
+
+// DeleteComment deletes a comment. An empty etag deletes the comment whatever its version.
+func (c *Client) DeleteComment(ctx context.Context, id uint64, etag string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/comments/"+strconv.FormatUint(id, 10), ifMatch(etag), nil, nil, commentErrors(id))
+	return err
+}
+
+// SetCommentHidden hides a comment from readers, or shows it again.
+func (c *Client) SetCommentHidden(ctx context.Context, id uint64, hidden bool) error {
+	action := "/hide"
+	if !hidden {
+		action = "/unhide"
+	}
+	_, err := c.do(ctx, http.MethodPost, "/comments/"+strconv.FormatUint(id, 10)+action, nil, nil, nil, commentErrors(id))
+	return err
+}
+
+func ifMatch(etag string) http.Header {
+	if etag == "" {
+		return nil
+	}
+	return http.Header{"If-Match": {etag}}
+}
+
+func postErrors(id uint64) func(*Error) error {
+	return func(apiErr *Error) error {
+		switch apiErr.Status {
+		case http.StatusNotFound:
+			return PostNotFoundError{Id: id, cause: apiErr}
+		case http.StatusPreconditionFailed:
+			return PostVersionMismatchError{Id: id, cause: apiErr}
+		}
+		return apiErr
+	}
+}
+
+func commentErrors(id uint64) func(*Error) error {
+	return func(apiErr *Error) error {
+		switch apiErr.Status {
+		case http.StatusNotFound:
+			return CommentNotFoundError{Id: id, cause: apiErr}
+		case http.StatusPreconditionFailed:
+			return CommentVersionMismatchError{Id: id, cause: apiErr}
+		}
+		return apiErr
+	}
+}
+
+// do sends a request to path, relative to the v2 API, and decodes the response into out. Error
+// responses are turned into an *Error and passed through mapError, when given.
+func (c *Client) do(ctx context.Context, method string, path string, header http.Header, in interface{}, out interface{}, mapError func(*Error) error) (http.Header, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+	target, err := c.baseUrl.Parse(strings.TrimSuffix(c.baseUrl.Path, "/") + "/api/v2" + path)
+	if err != nil {
+		return nil, err
+	}
+	// The key makes retries of a create replay its first response instead of creating twice.
+	idempotencyKey := ""
+	if method == http.MethodPost && in != nil {
+		idempotencyKey = newIdempotencyKey()
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		req.Header.Set("Accept", "application/json")
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if idempotencyKey != "" {
+			req.Header.Set("Idempotency-Key", idempotencyKey)
+		}
+		if c.auth != nil {
+			if err := c.auth.Authenticate(req); err != nil {
+				return nil, err
+			}
+		}
+
+		response, err := c.httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= c.retries {
+				return nil, err
+			}
+			if err := c.wait(ctx, attempt, 0); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if response.StatusCode >= http.StatusBadRequest {
+			apiErr := readError(response)
+			if retryable(response.StatusCode) && attempt < c.retries {
+				if err := c.wait(ctx, attempt, retryAfter(response.Header)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if mapError != nil {
+				return response.Header, mapError(apiErr)
+			}
+			return response.Header, apiErr
+		}
+
+		defer response.Body.Close()
+		if out != nil {
+			if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+				return response.Header, fmt.Errorf("could not decode response of %s %s: %w", method, path, err)
+			}
+		}
+		return response.Header, nil
+	}
+}
+
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func retryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// wait sleeps before the next attempt: the delay asked for by the server, or an exponential backoff
+// with full jitter.
+func (c *Client) wait(ctx context.Context, attempt int, delay time.Duration) error {
+	if delay <= 0 {
+		backoff := float64(c.backoff) * math.Pow(2, float64(attempt))
+		delay = time.Duration(mathrand.Int63n(int64(math.Min(backoff, float64(c.maxBackoff))) + 1))
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func readError(response *http.Response) *Error {
+	defer response.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBodyLength))
+	apiErr := &Error{Status: response.StatusCode, Message: strings.TrimSpace(string(data))}
+
+	// v2 reports errors as problem details, v1 as an AckJsonResponse.
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	var problem v2.Problem
+	var ack struct {
+		Message string
+		Status  int
+	}
+	switch {
+	case mediaType == "application/problem+json" && json.Unmarshal(data, &problem) == nil:
+		apiErr.Message = problem.Detail
+	case mediaType == "application/json" && json.Unmarshal(data, &ack) == nil && ack.Message != "":
+		apiErr.Message = ack.Message
+		if ack.Status != 0 {
+			apiErr.Status = ack.Status
+		}
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(response.StatusCode)
+	}
+	return apiErr
+}
+
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(key)
+}
+
+// Error is an error response of the service. Not found, already exists and version mismatch errors
+// are reported by the typed errors below, which wrap it.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+}
+
+// StatusOf returns the status of the error response err reports, or zero when err is not an error
+// response of the service.
+func StatusOf(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Status
+	}
+	return 0
+}
+
+type PostNotFoundError struct {
+	Id    uint64
+	cause *Error
+}
+
+func (e PostNotFoundError) Error() string {
+	return fmt.Sprintf("Post with id: %v does not exist", e.Id)
+}
+
+func (e PostNotFoundError) Unwrap() error {
+	if e.cause == nil {
+		return nil
+	}
+	return e.cause
+}
+
+type PostAlreadyExistsError struct {
+	Id    uint64
+	cause *Error
+}
+
+func (e PostAlreadyExistsError) Error() string {
+	return fmt.Sprintf("Post with id: %v already exists", e.Id)
+}
+
+func (e PostAlreadyExistsError) Unwrap() error {
+	if e.cause == nil {
+		return nil
+	}
+	return e.cause
+}
+
+type PostVersionMismatchError struct {
+	Id    uint64
+	cause *Error
+}
+
+func (e PostVersionMismatchError) Error() string {
+	if e.cause == nil || e.cause.Message == "" {
+		return fmt.Sprintf("Post with id: %v has been modified", e.Id)
+	}
+	return e.cause.Message
+}
+
+func (e PostVersionMismatchError) Unwrap() error {
+	if e.cause == nil {
+		return nil
+	}
+	return e.cause
+}
+
+type CommentNotFoundError struct {
+	Id    uint64
+	cause *Error
+}
+
+func (e CommentNotFoundError) Error() string {
+	return fmt.Sprintf("Comment with id: %v does not exist", e.Id)
+}
+
+func (e CommentNotFoundError) Unwrap() error {
+	if e.cause == nil {
+		return nil
+	}
+	return e.cause
+}
+
+type CommentAlreadyExistsError struct {
+	Id    uint64
+	cause *Error
+}
+
+func (e CommentAlreadyExistsError) Error() string {
+	return fmt.Sprintf("Comment with id: %v already exists", e.Id)
+}
+
+func (e CommentAlreadyExistsError) Unwrap() error {
+	if e.cause == nil {
+		return nil
+	}
+	return e.cause
+}
+
+type CommentVersionMismatchError struct {
+	Id    uint64
+	cause *Error
+}
+
+func (e CommentVersionMismatchError) Error() string {
+	if e.cause == nil || e.cause.Message == "" {
+		return fmt.Sprintf("Comment with id: %v has been modified", e.Id)
+	}
+	return e.cause.Message
+}
+
+func (e CommentVersionMismatchError) Unwrap() error {
+	if e.cause == nil {
+		return nil
+	}
+	return e.cause
+}
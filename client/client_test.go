@@ -0,0 +1,316 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/config"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/repository"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/service"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testDate = time.Date(2018, time.September, 16, 12, 0, 0, 0, time.UTC)
+
+func newTestClient(t *testing.T, handler http.Handler, opts ...Option) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	c, err := New(server.URL, append([]Option{WithRetries(3, time.Millisecond)}, opts...)...)
+	require.NoError(t, err)
+	return c
+}
+
+func newService(opts ...service.Option) http.Handler {
+	svc := service.NewRestApiService(opts...)
+	return svc.Handler()
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("localhost:8080")
+	assert.EqualError(t, err, `invalid base URL: "localhost:8080"`)
+
+	c, err := New("http://localhost:8080")
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+}
+
+func TestPosts(t *testing.T) {
+	// GIVEN
+	c := newTestClient(t, newService())
+	ctx := context.Background()
+	post := model.Post{
+		Id: 1, Title: "title", Content: "content", Author: "author", CreationDate: testDate, Slug: "title",
+		Tags: []string{"go"}, Category: "backend", Status: model.Published,
+	}
+
+	// WHEN
+	require.NoError(t, c.CreatePost(ctx, post))
+	created, err := c.GetPost(ctx, 1)
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, post, created.Post)
+	assert.NotEmpty(t, created.ETag)
+	posts, err := c.ListPosts(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []model.Post{post}, posts)
+
+	// WHEN the post is updated
+	etag, err := c.UpdatePost(ctx, 1, PostUpdate{
+		Title: "new title", Content: "new content", Tags: []string{"web"}, Status: model.Archived, IfMatch: created.ETag,
+	})
+
+	// THEN
+	require.NoError(t, err)
+	updated, err := c.GetPost(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "new title", updated.Title)
+	assert.Equal(t, []string{"web"}, updated.Tags)
+	assert.Equal(t, "backend", updated.Category)
+	assert.Equal(t, model.Archived, updated.Status)
+	assert.Equal(t, etag, updated.ETag)
+	assert.NotNil(t, updated.ModificationDate)
+
+	// WHEN the post is updated with a stale ETag
+	_, err = c.UpdatePost(ctx, 1, PostUpdate{Title: "t", Content: "c", IfMatch: created.ETag})
+
+	// THEN
+	var mismatch PostVersionMismatchError
+	require.ErrorAs(t, err, &mismatch)
+	assert.Equal(t, uint64(1), mismatch.Id)
+	assert.Equal(t, http.StatusPreconditionFailed, StatusOf(err))
+
+	// WHEN the post is created twice
+	err = c.CreatePost(ctx, post)
+
+	// THEN
+	var exists PostAlreadyExistsError
+	require.ErrorAs(t, err, &exists)
+	assert.EqualError(t, err, "Post with id: 1 already exists")
+
+	// WHEN the post is deleted
+	require.NoError(t, c.DeletePost(ctx, 1, updated.ETag))
+	_, err = c.GetPost(ctx, 1)
+
+	// THEN
+	var notFound PostNotFoundError
+	require.ErrorAs(t, err, &notFound)
+	assert.Equal(t, http.StatusNotFound, StatusOf(err))
+}
+
+func TestListPostsPages(t *testing.T) {
+	// GIVEN more posts than a page holds
+	stored := make([]model.Post, postPageSize+1)
+	for i := range stored {
+		stored[i] = model.Post{Id: uint64(i + 1), Title: "t", Content: "c", Author: "a", CreationDate: testDate}
+	}
+	posts := repository.CustomPostRepository(stored)
+	c := newTestClient(t, newService(service.WithPostRepository(&posts)))
+
+	// WHEN
+	listed, err := c.ListPosts(context.Background())
+
+	// THEN
+	require.NoError(t, err)
+	if assert.Len(t, listed, postPageSize+1) {
+		assert.Equal(t, uint64(postPageSize+1), listed[postPageSize].Id)
+	}
+}
+
+func TestComments(t *testing.T) {
+	// GIVEN
+	c := newTestClient(t, newService())
+	ctx := context.Background()
+	require.NoError(t, c.CreatePost(ctx, model.Post{Id: 1, Title: "t", Content: "c", Author: "a", CreationDate: testDate}))
+	comment := model.Comment{Id: 10, PostId: 1, Comment: "comment", Author: "reader", CreationDate: testDate}
+
+	// WHEN
+	require.NoError(t, c.CreateComment(ctx, comment))
+	comments, err := c.ListComments(ctx, 1)
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, []model.Comment{comment}, comments)
+
+	// WHEN the comment is created twice
+	err = c.CreateComment(ctx, comment)
+
+	// THEN
+	var exists CommentAlreadyExistsError
+	assert.ErrorAs(t, err, &exists)
+
+	// WHEN the comment is hidden
+	require.NoError(t, c.SetCommentHidden(ctx, 10, true))
+	comments, err = c.ListComments(ctx, 1)
+
+	// THEN
+	require.NoError(t, err)
+	assert.Empty(t, comments)
+
+	// WHEN the comment is deleted
+	require.NoError(t, c.DeleteComment(ctx, 10, ""))
+	err = c.DeleteComment(ctx, 10, "")
+
+	// THEN
+	var notFound CommentNotFoundError
+	assert.ErrorAs(t, err, &notFound)
+}
+
+func TestErrorMessage(t *testing.T) {
+	// GIVEN
+	c := newTestClient(t, newService())
+
+	// WHEN
+	err := c.CreateComment(context.Background(), model.Comment{Id: 1, PostId: 1, Comment: "c", CreationDate: testDate})
+
+	// THEN
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+	assert.Equal(t, "Could not deserialize comment JSON payload", apiErr.Message)
+}
+
+func TestErrorMessageOfV1Response(t *testing.T) {
+	// GIVEN
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"Message": "Wrong id path variable: abc", "Status": 400}`))
+	}))
+
+	// WHEN
+	_, err := c.GetPost(context.Background(), 1)
+
+	// THEN
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, &Error{Status: http.StatusBadRequest, Message: "Wrong id path variable: abc"}, apiErr)
+}
+
+func TestVersionMismatchErrorsWithoutCause(t *testing.T) {
+	assert.Equal(t, "Post with id: 1 has been modified", PostVersionMismatchError{Id: 1}.Error())
+	assert.Equal(t, "Comment with id: 2 has been modified", CommentVersionMismatchError{Id: 2}.Error())
+	assert.True(t, PostVersionMismatchError{}.Unwrap() == nil)
+	assert.Equal(t, 0, StatusOf(CommentVersionMismatchError{}))
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		testName         string
+		failures         int32
+		retries          int
+		expectedAttempts int32
+		expectedStatus   int
+	}{
+		{testName: "succeeds after transient failures", failures: 2, retries: 3, expectedAttempts: 3},
+		{testName: "gives up after the last retry", failures: 5, retries: 2, expectedAttempts: 3, expectedStatus: http.StatusServiceUnavailable},
+		{testName: "does not retry when retries are disabled", failures: 1, retries: 0, expectedAttempts: 1, expectedStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN a service failing the first requests
+			var attempts int32
+			svc := newService()
+			flaky := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&attempts, 1) <= tc.failures {
+					http.Error(w, "try later", http.StatusServiceUnavailable)
+					return
+				}
+				svc.ServeHTTP(w, r)
+			})
+			c := newTestClient(t, flaky, WithRetries(tc.retries, time.Millisecond))
+
+			// WHEN
+			err := c.CreatePost(context.Background(), model.Post{Id: 1, Title: "t", Content: "c", Author: "a", CreationDate: testDate})
+
+			// THEN
+			assert.Equal(t, tc.expectedAttempts, atomic.LoadInt32(&attempts))
+			assert.Equal(t, tc.expectedStatus, StatusOf(err))
+		})
+	}
+}
+
+func TestRetriesReplayCreates(t *testing.T) {
+	// GIVEN a service whose first response is lost after the post is created
+	var attempts int32
+	svc := newService()
+	lossy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			svc.ServeHTTP(httptest.NewRecorder(), r)
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		svc.ServeHTTP(w, r)
+	})
+	c := newTestClient(t, lossy)
+
+	// WHEN
+	err := c.CreatePost(context.Background(), model.Post{Id: 1, Title: "t", Content: "c", Author: "a", CreationDate: testDate})
+
+	// THEN the retry is answered with the response of the first attempt
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestContextCancellation(t *testing.T) {
+	// GIVEN a service asking to retry much later
+	unavailable := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "try later", http.StatusTooManyRequests)
+	})
+	c := newTestClient(t, unavailable)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// WHEN
+	start := time.Now()
+	_, err := c.GetPost(ctx, 1)
+
+	// THEN
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestAuth(t *testing.T) {
+	// GIVEN
+	handler := newService(
+		service.WithPolicy(auth.DefaultPolicy()),
+		service.WithAuthenticators(auth.NewApiKeyAuthenticator([]config.ApiKeyConfig{
+			{Key: "alice-key", Subject: "alice", Role: string(auth.RoleAuthor)},
+		})),
+	)
+	post := model.Post{Id: 1, Title: "t", Content: "c", CreationDate: testDate}
+
+	// WHEN
+	anonymous := newTestClient(t, handler)
+	err := anonymous.CreatePost(context.Background(), post)
+
+	// THEN
+	assert.Equal(t, http.StatusUnauthorized, StatusOf(err))
+
+	// WHEN
+	alice := newTestClient(t, handler, WithAuth(ApiKey("alice-key")))
+	require.NoError(t, alice.CreatePost(context.Background(), post))
+	created, err := alice.GetPost(context.Background(), 1)
+
+	// THEN the author defaults to the caller
+	require.NoError(t, err)
+	assert.Equal(t, "alice", created.Author)
+}
+
+func TestNextCursor(t *testing.T) {
+	header := http.Header{}
+	assert.Equal(t, "", nextCursor(header))
+
+	header.Add("Link", `</api/v1/comments?postId=1>; rel="successor-version"`)
+	header.Add("Link", `</api/v2/comments?cursor=abc&postId=1>; rel="next"`)
+	assert.Equal(t, "abc", nextCursor(header))
+}
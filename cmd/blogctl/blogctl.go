@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/client"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Exit codes. Error responses of the API exit with their status minus 300, e.g. 104 for 404 Not
+// Found, so that scripts can tell them apart without parsing the output.
+const (
+	exitOk      = 0
+	exitFailure = 1
+	exitUsage   = 2
+	statusShift = 300
+)
+
+const usage = `Usage: blogctl [flags] <command> [arguments] [flags]
+
+Commands:
+  posts create -id ID -title TITLE -content CONTENT [-author AUTHOR] [-created RFC3339]
+  posts get ID
+  posts list
+  posts update ID -title TITLE -content CONTENT [-if-match ETAG]
+  posts delete ID [-if-match ETAG]
+  comments add -id ID -post-id POST_ID -body BODY -author AUTHOR [-created RFC3339]
+  comments list -post-id POST_ID
+  comments delete ID [-if-match ETAG]
+
+Flags:
+`
+
+// usageError is a command line that could not be parsed.
+type usageError struct {
+	message string
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
+// globals are the flags accepted by every command.
+type globals struct {
+	configPath string
+	profile    string
+	baseUrl    string
+	apiKey     string
+	output     string
+}
+
+// register adds the global flags to flags, with defaults taken from g.
+func (g *globals) register(flags *flag.FlagSet) {
+	flags.StringVar(&g.configPath, "config", g.configPath, "path to the profile file")
+	flags.StringVar(&g.profile, "profile", g.profile, "name of the profile to use")
+	flags.StringVar(&g.baseUrl, "base-url", g.baseUrl, "base URL of the API, overriding the profile")
+	flags.StringVar(&g.apiKey, "api-key", g.apiKey, "API key, overriding the profile")
+	flags.StringVar(&g.output, "output", g.output, "output format: table, json or yaml")
+}
+
+// command runs a subcommand with its positional arguments.
+type command func(ctx context.Context, c *client.Client, out printer, args []string) error
+
+// run executes a command line and returns the exit code of blogctl.
+func run(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	g := globals{configPath: defaultConfigPath(), profile: firstOf(os.Getenv("BLOGCTL_PROFILE"), defaultProfile)}
+	root := flag.NewFlagSet("blogctl", flag.ContinueOnError)
+	root.SetOutput(stderr)
+	g.register(root)
+	root.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		root.PrintDefaults()
+	}
+	if err := root.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOk
+		}
+		return exitUsage
+	}
+	if root.NArg() < 2 {
+		root.Usage()
+		return exitUsage
+	}
+
+	flags := flag.NewFlagSet("blogctl "+root.Arg(0)+" "+root.Arg(1), flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	// Global flags may also follow the command; the values given before it are the defaults.
+	g.register(flags)
+	cmd, err := lookup(root.Arg(0), root.Arg(1), flags)
+	if err == nil {
+		var positional []string
+		positional, err = parse(flags, root.Args()[2:])
+		if err == nil {
+			err = execute(ctx, g, cmd, positional, stdout)
+		}
+	}
+	return report(err, stderr)
+}
+
+func lookup(resource string, action string, flags *flag.FlagSet) (command, error) {
+	switch resource + " " + action {
+	case "posts create":
+		return createPost(flags), nil
+	case "posts get":
+		return getPost, nil
+	case "posts list":
+		return listPosts, nil
+	case "posts update":
+		return updatePost(flags), nil
+	case "posts delete":
+		return deletePost(flags), nil
+	case "comments add":
+		return addComment(flags), nil
+	case "comments list":
+		return listComments(flags), nil
+	case "comments delete":
+		return deleteComment(flags), nil
+	}
+	return nil, usageError{fmt.Sprintf("unknown command %q, see blogctl -help", resource+" "+action)}
+}
+
+// parse parses flags wherever they appear among the positional arguments, which it returns.
+func parse(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, usageError{err.Error()}
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+func execute(ctx context.Context, g globals, cmd command, args []string, stdout io.Writer) error {
+	profile, err := loadProfile(g.configPath, g.profile)
+	if err != nil {
+		return err
+	}
+	baseUrl := firstOf(g.baseUrl, profile.BaseUrl, defaultBaseUrl)
+	apiKey := firstOf(g.apiKey, profile.ApiKey)
+	output := firstOf(g.output, profile.Output, outputTable)
+	if output != outputTable && output != outputJson && output != outputYaml {
+		return usageError{fmt.Sprintf("unknown output format %q, expected table, json or yaml", output)}
+	}
+
+	var opts []client.Option
+	if apiKey != "" {
+		opts = append(opts, client.WithAuth(client.ApiKey(apiKey)))
+	}
+	c, err := client.New(baseUrl, opts...)
+	if err != nil {
+		return err
+	}
+	return cmd(ctx, c, printer{w: stdout, format: output}, args)
+}
+
+// report prints err and returns the exit code it stands for.
+func report(err error, stderr io.Writer) int {
+	if err == nil {
+		return exitOk
+	}
+	fmt.Fprintln(stderr, "blogctl:", err)
+	var usageErr usageError
+	if errors.As(err, &usageErr) {
+		return exitUsage
+	}
+	if status := client.StatusOf(err); status >= http.StatusBadRequest && status-statusShift <= 255 {
+		return status - statusShift
+	}
+	return exitFailure
+}
+
+func firstOf(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// id parses the single positional argument of a command, the id of a post or a comment.
+func id(args []string) (uint64, error) {
+	if len(args) != 1 {
+		return 0, usageError{"expected a single ID argument"}
+	}
+	return parseId("ID", args[0])
+}
+
+func parseId(name string, value string) (uint64, error) {
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || parsed == 0 {
+		return 0, usageError{fmt.Sprintf("invalid %s %q", name, value)}
+	}
+	return parsed, nil
+}
+
+func noArgs(args []string) error {
+	if len(args) > 0 {
+		return usageError{"unexpected arguments: " + strings.Join(args, " ")}
+	}
+	return nil
+}
+
+// creationDate parses the -created flag, now when left out.
+func creationDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now().UTC().Truncate(time.Second), nil
+	}
+	created, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, usageError{fmt.Sprintf("invalid -created %q, expected an RFC 3339 date-time", value)}
+	}
+	return created, nil
+}
+
+func createPost(flags *flag.FlagSet) command {
+	postId := flags.String("id", "", "id of the post")
+	title := flags.String("title", "", "title of the post")
+	content := flags.String("content", "", "content of the post")
+	author := flags.String("author", "", "author of the post, the caller by default")
+	created := flags.String("created", "", "creation date of the post, now by default")
+	return func(ctx context.Context, c *client.Client, out printer, args []string) error {
+		if err := noArgs(args); err != nil {
+			return err
+		}
+		id, err := parseId("-id", *postId)
+		if err != nil {
+			return err
+		}
+		date, err := creationDate(*created)
+		if err != nil {
+			return err
+		}
+		post := model.Post{Id: id, Title: *title, Content: *content, Author: *author, CreationDate: date}
+		if err := c.CreatePost(ctx, post); err != nil {
+			return err
+		}
+		return out.ack(http.StatusOK, fmt.Sprintf("Post with id: %d successfully added", id))
+	}
+}
+
+func getPost(ctx context.Context, c *client.Client, out printer, args []string) error {
+	id, err := id(args)
+	if err != nil {
+		return err
+	}
+	post, err := c.GetPost(ctx, id)
+	if err != nil {
+		return err
+	}
+	return out.post(post.Post, post.ETag)
+}
+
+func listPosts(ctx context.Context, c *client.Client, out printer, args []string) error {
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	posts, err := c.ListPosts(ctx)
+	if err != nil {
+		return err
+	}
+	return out.posts(posts)
+}
+
+func updatePost(flags *flag.FlagSet) command {
+	title := flags.String("title", "", "new title of the post")
+	content := flags.String("content", "", "new content of the post")
+	ifMatch := flags.String("if-match", "", "ETag the post must still have, see posts get")
+	return func(ctx context.Context, c *client.Client, out printer, args []string) error {
+		id, err := id(args)
+		if err != nil {
+			return err
+		}
+		if _, err := c.UpdatePost(ctx, id, client.PostUpdate{Title: *title, Content: *content, IfMatch: *ifMatch}); err != nil {
+			return err
+		}
+		return out.ack(http.StatusOK, fmt.Sprintf("Post with id: %d successfully updated", id))
+	}
+}
+
+func deletePost(flags *flag.FlagSet) command {
+	ifMatch := flags.String("if-match", "", "ETag the post must still have, see posts get")
+	return func(ctx context.Context, c *client.Client, out printer, args []string) error {
+		id, err := id(args)
+		if err != nil {
+			return err
+		}
+		if err := c.DeletePost(ctx, id, *ifMatch); err != nil {
+			return err
+		}
+		return out.ack(http.StatusOK, fmt.Sprintf("Post with id: %d successfully deleted", id))
+	}
+}
+
+func addComment(flags *flag.FlagSet) command {
+	commentId := flags.String("id", "", "id of the comment")
+	postId := flags.String("post-id", "", "id of the post commented on")
+	body := flags.String("body", "", "text of the comment")
+	author := flags.String("author", "", "author of the comment")
+	created := flags.String("created", "", "creation date of the comment, now by default")
+	return func(ctx context.Context, c *client.Client, out printer, args []string) error {
+		if err := noArgs(args); err != nil {
+			return err
+		}
+		id, err := parseId("-id", *commentId)
+		if err != nil {
+			return err
+		}
+		post, err := parseId("-post-id", *postId)
+		if err != nil {
+			return err
+		}
+		date, err := creationDate(*created)
+		if err != nil {
+			return err
+		}
+		comment := model.Comment{Id: id, PostId: post, Comment: *body, Author: *author, CreationDate: date}
+		if err := c.CreateComment(ctx, comment); err != nil {
+			return err
+		}
+		return out.ack(http.StatusOK, fmt.Sprintf("Comment with id: %d successfully added", id))
+	}
+}
+
+func listComments(flags *flag.FlagSet) command {
+	postId := flags.String("post-id", "", "id of the post")
+	return func(ctx context.Context, c *client.Client, out printer, args []string) error {
+		if err := noArgs(args); err != nil {
+			return err
+		}
+		post, err := parseId("-post-id", *postId)
+		if err != nil {
+			return err
+		}
+		comments, err := c.ListComments(ctx, post)
+		if err != nil {
+			return err
+		}
+		return out.comments(comments)
+	}
+}
+
+func deleteComment(flags *flag.FlagSet) command {
+	ifMatch := flags.String("if-match", "", "ETag the comment must still have")
+	return func(ctx context.Context, c *client.Client, out printer, args []string) error {
+		id, err := id(args)
+		if err != nil {
+			return err
+		}
+		if err := c.DeleteComment(ctx, id, *ifMatch); err != nil {
+			return err
+		}
+		return out.ack(http.StatusOK, fmt.Sprintf("Comment with id: %d successfully deleted", id))
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/config"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/service"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newServer serves a blog on which alice-key authenticates an author and admin-key an admin, and
+// writes a profile file pointing at it. It returns the path of that file and the URL of the blog.
+func newServer(t *testing.T) (string, string) {
+	svc := service.NewRestApiService(
+		service.WithPolicy(auth.DefaultPolicy()),
+		service.WithAuthenticators(auth.NewApiKeyAuthenticator([]config.ApiKeyConfig{
+			{Key: "alice-key", Subject: "alice", Role: string(auth.RoleAuthor)},
+			{Key: "admin-key", Subject: "root", Role: string(auth.RoleAdmin)},
+		})),
+	)
+	server := httptest.NewServer(svc.Handler())
+	t.Cleanup(server.Close)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	profiles := `{"profiles": {
+		"default": {"baseUrl": "` + server.URL + `", "apiKey": "alice-key"},
+		"admin": {"baseUrl": "` + server.URL + `", "apiKey": "admin-key", "output": "json"},
+		"anonymous": {"baseUrl": "` + server.URL + `"}
+	}}`
+	require.NoError(t, os.WriteFile(path, []byte(profiles), 0o600))
+	return path, server.URL
+}
+
+func runCommand(configPath string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), append([]string{"-config", configPath}, args...), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCommands(t *testing.T) {
+	configPath, _ := newServer(t)
+
+	tests := []struct {
+		testName       string
+		args           string
+		expectedCode   int
+		expectedOutput string
+	}{
+		{"createPost", "posts create -id 1 -title hello -content world -created 2018-09-16T12:00:00Z", 0,
+			"Post with id: 1 successfully added\n"},
+		{"createExistingPost", "posts create -id 1 -title hello -content world", 409 - 300, ""},
+		{"anonymousCannotCreate", "-profile anonymous posts create -id 2 -title t -content c", 401 - 300, ""},
+		{"listPosts", "posts list", 0,
+			"ID  TITLE  AUTHOR  CREATED               MODIFIED  VERSION\n" +
+				"1   hello  alice   2018-09-16T12:00:00Z  -         0\n"},
+		{"listPostsAsJson", "posts list -output json", 0, `[
+  {
+    "id": 1,
+    "title": "hello",
+    "content": "world",
+    "author": "alice",
+    "createdAt": "2018-09-16T12:00:00Z",
+    "version": 0,
+    "slug": "hello",
+    "status": "published"
+  }
+]
+`},
+		{"getPostAsYaml", "posts get 1 -output yaml", 0, `id: 1
+title: hello
+content: world
+author: alice
+createdAt: "2018-09-16T12:00:00Z"
+version: 0
+slug: hello
+status: published
+`},
+		{"getMissingPost", "posts get 7", 404 - 300, ""},
+		{"updatePost", "posts update 1 -title changed -content c", 0, "Post with id: 1 successfully updated\n"},
+		{"updatePostWithStaleETag", "posts update 1 -title t -content c -if-match 0-abc", 412 - 300, ""},
+		{"addComment", "comments add -id 10 -post-id 1 -body nice -author bob -created 2018-09-16T12:00:00Z", 0,
+			"Comment with id: 10 successfully added\n"},
+		{"listComments", "comments list -post-id 1", 0,
+			"ID  POST  AUTHOR  CREATED               COMMENT\n" +
+				"10  1     bob     2018-09-16T12:00:00Z  nice\n"},
+		{"profileOutputFormat", "-profile admin comments delete 10", 0,
+			"{\n  \"message\": \"Comment with id: 10 successfully deleted\",\n  \"status\": 200\n}\n"},
+		{"deleteMissingComment", "-profile admin comments delete 10", 404 - 300, ""},
+		{"authorCannotDeleteComments", "comments delete 10", 403 - 300, ""},
+		{"deletePost", "-profile admin -output table posts delete 1", 0, "Post with id: 1 successfully deleted\n"},
+		{"missingId", "posts get", 2, ""},
+		{"invalidId", "posts delete abc", 2, ""},
+		{"unknownCommand", "posts publish 1", 2, ""},
+		{"unknownOutput", "posts list -output xml", 2, ""},
+		{"unknownProfile", "-profile nobody posts list", 1, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// WHEN
+			code, stdout, stderr := runCommand(configPath, strings.Fields(tc.args)...)
+
+			// THEN
+			assert.Equal(t, tc.expectedCode, code, stderr)
+			assert.Equal(t, tc.expectedOutput, stdout)
+			if tc.expectedCode != 0 {
+				assert.NotEmpty(t, stderr)
+			}
+		})
+	}
+}
+
+func TestGetPost(t *testing.T) {
+	// GIVEN
+	configPath, _ := newServer(t)
+	code, _, _ := runCommand(configPath, "posts", "create", "-id", "1", "-title", "hello", "-content", "long content")
+	require.Equal(t, 0, code)
+
+	// WHEN
+	code, stdout, _ := runCommand(configPath, "posts", "get", "1")
+
+	// THEN
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "TITLE:     hello\n")
+	assert.Contains(t, stdout, "ETAG:      \"0-")
+	assert.True(t, strings.HasSuffix(stdout, "\nlong content\n"))
+}
+
+func TestBaseUrlFlagOverridesProfile(t *testing.T) {
+	// GIVEN a profile file pointing at a server that is not running
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"profiles": {"default": {"baseUrl": "http://127.0.0.1:1"}}}`), 0o600))
+	_, server := newServer(t)
+
+	// WHEN
+	code, stdout, stderr := runCommand(path, "-base-url", server, "posts", "list", "-output", "json")
+
+	// THEN
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, "[]\n", stdout)
+}
+
+func TestUsage(t *testing.T) {
+	code, _, stderr := runCommand("", "posts")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "Usage: blogctl")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/codec"
+	v2 "gitlab.com/devskiller-tasks/rest-api-blog-golang/dto/v2"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats. JSON and YAML print the v2 wire format of the API.
+const (
+	outputTable = "table"
+	outputJson  = "json"
+	outputYaml  = "yaml"
+)
+
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func (p printer) encode(v interface{}) error {
+	if p.format == outputYaml {
+		return codec.YAML{}.Encode(p.w, v)
+	}
+	encoder := json.NewEncoder(p.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func (p printer) ack(status int, message string) error {
+	if p.format != outputTable {
+		return p.encode(v2.Ack{Message: message, Status: status})
+	}
+	_, err := fmt.Fprintln(p.w, message)
+	return err
+}
+
+func (p printer) post(post model.Post, etag string) error {
+	if p.format != outputTable {
+		return p.encode(v2.FromPost(post))
+	}
+	table := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(table, "ID:\t%d\n", post.Id)
+	fmt.Fprintf(table, "TITLE:\t%s\n", post.Title)
+	fmt.Fprintf(table, "AUTHOR:\t%s\n", post.Author)
+	fmt.Fprintf(table, "CREATED:\t%s\n", formatTime(post.CreationDate))
+	fmt.Fprintf(table, "MODIFIED:\t%s\n", formatTime(post.ModificationDate))
+	fmt.Fprintf(table, "VERSION:\t%d\n", post.Version)
+	fmt.Fprintf(table, "ETAG:\t%s\n", etag)
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(p.w, "\n%s\n", post.Content)
+	return err
+}
+
+func (p printer) posts(posts []model.Post) error {
+	if p.format != outputTable {
+		return p.encode(v2.FromPosts(posts))
+	}
+	table := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tTITLE\tAUTHOR\tCREATED\tMODIFIED\tVERSION")
+	for _, post := range posts {
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%s\t%d\n", post.Id, post.Title, post.Author,
+			formatTime(post.CreationDate), formatTime(post.ModificationDate), post.Version)
+	}
+	return table.Flush()
+}
+
+func (p printer) comments(comments []model.Comment) error {
+	if p.format != outputTable {
+		return p.encode(v2.FromComments(comments))
+	}
+	table := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tPOST\tAUTHOR\tCREATED\tCOMMENT")
+	for _, comment := range comments {
+		fmt.Fprintf(table, "%d\t%d\t%s\t%s\t%s\n", comment.Id, comment.PostId, comment.Author,
+			formatTime(comment.CreationDate), comment.Comment)
+	}
+	return table.Flush()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
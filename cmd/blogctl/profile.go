@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	defaultProfile = "default"
+	defaultBaseUrl = "http://localhost:8080"
+)
+
+// ProfileFile is the configuration file of blogctl, e.g.:
+//
+//	{ "profiles": { "default": { "baseUrl": "https://blog.example.com", "apiKey": "alice-key" } } }
+type ProfileFile struct {
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+type Profile struct {
+	BaseUrl string `json:"baseUrl"`
+	ApiKey  string `json:"apiKey"`
+	// Output is the default output format: "table", "json" or "yaml".
+	Output string `json:"output"`
+}
+
+// defaultConfigPath is $BLOGCTL_CONFIG, or blogctl/config.json in the user configuration directory.
+func defaultConfigPath() string {
+	if path := os.Getenv("BLOGCTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "blogctl", "config.json")
+}
+
+// loadProfile reads the named profile from the file at path. A missing file is only an error when a
+// profile other than the default one is asked for.
+func loadProfile(path string, name string) (Profile, error) {
+	if path == "" {
+		return Profile{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && name == defaultProfile {
+		return Profile{}, nil
+	}
+	if err != nil {
+		return Profile{}, fmt.Errorf("could not read config file %s: %w", path, err)
+	}
+
+	var file ProfileFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return Profile{}, fmt.Errorf("could not parse config file %s: %w", path, err)
+	}
+	profile, ok := file.Profiles[name]
+	if !ok && name != defaultProfile {
+		return Profile{}, fmt.Errorf("profile %q is not defined in %s", name, path)
+	}
+	return profile, nil
+}
@@ -0,0 +1,145 @@
+// Package codec selects and applies response encoders based on the Accept header.
+package codec
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Encoder writes values in one representation.
+type Encoder interface {
+	// Name identifies the representation, e.g. "xml"; it is used to tell entity tags apart.
+	Name() string
+	// ContentType is sent in the Content-Type header of responses written by this encoder.
+	ContentType() string
+	// MediaTypes lists the media types, as they appear in Accept headers, served by this encoder.
+	MediaTypes() []string
+	// Supports reports whether v can be written in this representation.
+	Supports(v interface{}) bool
+	Encode(w io.Writer, v interface{}) error
+}
+
+type Registry struct {
+	encoders []Encoder
+}
+
+func NewRegistry(encoders ...Encoder) *Registry {
+	return &Registry{encoders: encoders}
+}
+
+// Default returns a registry with JSON (used when the client expresses no preference), XML, YAML,
+// CSV (lists only) and MessagePack encoders.
+func Default() *Registry {
+	return NewRegistry(JSON{}, XML{}, YAML{}, CSV{}, MessagePack{})
+}
+
+func (r *Registry) Register(encoder Encoder) {
+	r.encoders = append(r.encoders, encoder)
+}
+
+// Supporting lists the registered encoders able to encode v.
+func (r *Registry) Supporting(v interface{}) []Encoder {
+	var encoders []Encoder
+	for _, encoder := range r.encoders {
+		if encoder.Supports(v) {
+			encoders = append(encoders, encoder)
+		}
+	}
+	return encoders
+}
+
+// MediaTypes lists the media types of all registered encoders.
+func (r *Registry) MediaTypes() []string {
+	var mediaTypes []string
+	for _, encoder := range r.encoders {
+		mediaTypes = append(mediaTypes, encoder.MediaTypes()[0])
+	}
+	return mediaTypes
+}
+
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		if mediaType == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// weight returns the quality the client gives to mediaType: that of the most specific matching range.
+func weight(ranges []mediaRange, mediaType string) float64 {
+	mainType, _, _ := strings.Cut(mediaType, "/")
+	best, specificity := 0.0, 0
+	for _, r := range ranges {
+		s := 0
+		switch r.mediaType {
+		case mediaType:
+			s = 3
+		case mainType + "/*":
+			s = 2
+		case "*/*":
+			s = 1
+		}
+		if s > specificity {
+			best, specificity = r.q, s
+		}
+	}
+	return best
+}
+
+// Negotiate picks the encoder for v the client prefers according to the Accept header. Ties go to
+// the encoder registered first. It reports false when no acceptable encoder can represent v.
+func (r *Registry) Negotiate(accept string, v interface{}) (Encoder, bool) {
+	ranges := parseAccept(accept)
+	var best Encoder
+	bestWeight := 0.0
+	for _, encoder := range r.encoders {
+		if !encoder.Supports(v) {
+			continue
+		}
+		if len(ranges) == 0 {
+			return encoder, true
+		}
+		for _, mediaType := range encoder.MediaTypes() {
+			if w := weight(ranges, mediaType); w > bestWeight {
+				best, bestWeight = encoder, w
+			}
+		}
+	}
+	return best, best != nil
+}
+
+// TagETag marks an entity tag as belonging to the representation written by encoder. JSON, the
+// default representation, keeps the tag unchanged.
+func TagETag(etag string, encoder Encoder) string {
+	if encoder.Name() == "json" || !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + "+" + encoder.Name() + `"`
+}
+
+// UntagETags removes the marks added by TagETag from a list of entity tags.
+func (r *Registry) UntagETags(header string) string {
+	for _, encoder := range r.encoders {
+		header = strings.ReplaceAll(header, "+"+encoder.Name()+`"`, `"`)
+	}
+	return header
+}
@@ -0,0 +1,116 @@
+package codec
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+	"testing"
+	"time"
+)
+
+type item struct {
+	Id      uint64
+	Name    string `json:"name"`
+	Skipped string `json:"-" xml:"-"`
+	Date    time.Time
+}
+
+var items = []item{
+	{Id: 1, Name: "first, quoted \"name\"", Date: time.Date(2018, time.September, 16, 12, 0, 0, 0, time.UTC)},
+	{Id: 2, Name: "second", Date: time.Date(2018, time.September, 17, 12, 0, 0, 0, time.UTC)},
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept   string
+		value    interface{}
+		expected string
+	}{
+		{"", items[0], "json"},
+		{"*/*", items[0], "json"},
+		{"application/xml", items[0], "xml"},
+		{"text/*", items[0], "xml"},
+		{"application/json;q=0.5, application/x-yaml", items[0], "yaml"},
+		{"text/csv", items, "csv"},
+		{"text/csv, application/json;q=0.1", items[0], "json"},
+		{"application/vnd.msgpack", items[0], "msgpack"},
+		{"application/*;q=0.2, application/xml;q=0", items[0], "json"},
+		{"text/csv", items[0], ""},
+		{"image/png", items, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.accept, func(t *testing.T) {
+			encoder, ok := Default().Negotiate(tc.accept, tc.value)
+			if tc.expected == "" {
+				assert.False(t, ok)
+				return
+			}
+			assert.True(t, ok)
+			assert.Equal(t, tc.expected, encoder.Name())
+		})
+	}
+}
+
+func TestEncoders(t *testing.T) {
+	tests := []struct {
+		encoder  Encoder
+		value    interface{}
+		expected string
+	}{
+		{XML{}, items[1], "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+			"<item><Id>2</Id><Name>second</Name><Date>2018-09-17T12:00:00Z</Date></item>\n"},
+		{XML{}, items[1:], "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+			"<items><item><Id>2</Id><Name>second</Name><Date>2018-09-17T12:00:00Z</Date></item></items>\n"},
+		{YAML{}, items[1], "Id: 2\nname: second\nDate: \"2018-09-17T12:00:00Z\"\n"},
+		{CSV{}, items, "Id,name,Date\n1,\"first, quoted \"\"name\"\"\",2018-09-16T12:00:00Z\n2,second,2018-09-17T12:00:00Z\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.encoder.Name(), func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.NoError(t, tc.encoder.Encode(&buf, tc.value))
+			assert.Equal(t, tc.expected, buf.String())
+		})
+	}
+}
+
+func TestCsvNeutralizesFormulas(t *testing.T) {
+	// GIVEN
+	formulas := []item{
+		{Id: 1, Name: "=HYPERLINK(\"http://evil\")"},
+		{Id: 2, Name: "+1"},
+		{Id: 3, Name: "-1"},
+		{Id: 4, Name: "@SUM(A1)"},
+		{Id: 5, Name: "a=b"},
+	}
+	var buf bytes.Buffer
+
+	// WHEN
+	err := CSV{}.Encode(&buf, formulas)
+
+	// THEN
+	assert.NoError(t, err)
+	assert.Equal(t, "Id,name,Date\n"+
+		"1,\"'=HYPERLINK(\"\"http://evil\"\")\",0001-01-01T00:00:00Z\n"+
+		"2,'+1,0001-01-01T00:00:00Z\n"+
+		"3,'-1,0001-01-01T00:00:00Z\n"+
+		"4,'@SUM(A1),0001-01-01T00:00:00Z\n"+
+		"5,a=b,0001-01-01T00:00:00Z\n", buf.String())
+}
+
+func TestMessagePackUsesJsonNames(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, MessagePack{}.Encode(&buf, items[1]))
+
+	var decoded map[string]interface{}
+	assert.NoError(t, msgpack.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, "second", decoded["name"])
+	assert.NotContains(t, decoded, "Skipped")
+}
+
+func TestETagTags(t *testing.T) {
+	assert.Equal(t, `"1-abc"`, TagETag(`"1-abc"`, JSON{}))
+	assert.Equal(t, `"1-abc+xml"`, TagETag(`"1-abc"`, XML{}))
+	assert.Equal(t, `"1-abc", "2-def"`, Default().UntagETags(`"1-abc+yaml", "2-def+msgpack"`))
+}
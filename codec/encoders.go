@@ -0,0 +1,217 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type JSON struct{}
+
+func (JSON) Name() string                { return "json" }
+func (JSON) ContentType() string         { return "application/json" }
+func (JSON) MediaTypes() []string        { return []string{"application/json"} }
+func (JSON) Supports(v interface{}) bool { return true }
+
+func (JSON) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// XML writes structs as elements named after their type, and slices wrapped in an element named
+// after the plural of their element type, e.g. <Comments><Comment>...</Comment></Comments>.
+type XML struct{}
+
+func (XML) Name() string                { return "xml" }
+func (XML) ContentType() string         { return "application/xml; charset=utf-8" }
+func (XML) MediaTypes() []string        { return []string{"application/xml", "text/xml"} }
+func (XML) Supports(v interface{}) bool { return true }
+
+func (XML) Encode(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	if err := encodeXml(encoder, v); err != nil {
+		return err
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func encodeXml(encoder *xml.Encoder, v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Slice {
+		return encoder.Encode(v)
+	}
+
+	list := xml.StartElement{Name: xml.Name{Local: t.Elem().Name() + "s"}}
+	if err := encoder.EncodeToken(list); err != nil {
+		return err
+	}
+	slice := reflect.ValueOf(v)
+	for i := 0; i < slice.Len(); i++ {
+		if err := encoder.Encode(slice.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(list.End())
+}
+
+// YAML writes the same fields, in the same order, as the JSON representation.
+type YAML struct{}
+
+func (YAML) Name() string        { return "yaml" }
+func (YAML) ContentType() string { return "application/yaml" }
+func (YAML) MediaTypes() []string {
+	return []string{"application/yaml", "application/x-yaml", "text/yaml"}
+}
+func (YAML) Supports(v interface{}) bool { return true }
+
+func (YAML) Encode(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// JSON is valid YAML; decoding it into a node keeps the field order, and resetting the styles
+	// turns the JSON flow style into the usual block style.
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	resetStyle(&node)
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
+
+// CSV writes slices of structs, one row per element under a header row of the JSON field names.
+type CSV struct{}
+
+func (CSV) Name() string         { return "csv" }
+func (CSV) ContentType() string  { return "text/csv; charset=utf-8" }
+func (CSV) MediaTypes() []string { return []string{"text/csv"} }
+
+func (CSV) Supports(v interface{}) bool {
+	t := reflect.TypeOf(v)
+	return t != nil && t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct
+}
+
+type csvColumn struct {
+	name  string
+	index int
+}
+
+func csvColumns(t reflect.Type) []csvColumn {
+	var columns []csvColumn
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		columns = append(columns, csvColumn{name: name, index: i})
+	}
+	return columns
+}
+
+// csvFormulaPrefixes start the cells spreadsheets evaluate as formulas.
+const csvFormulaPrefixes = "=+-@\t\r"
+
+func csvValue(v reflect.Value) (string, error) {
+	switch value := v.Interface().(type) {
+	case time.Time:
+		return value.Format(time.RFC3339Nano), nil
+	case string:
+		// Strings come from users: a leading quote keeps spreadsheets from running them as formulas.
+		if value != "" && strings.ContainsRune(csvFormulaPrefixes, rune(value[0])) {
+			return "'" + value, nil
+		}
+		return value, nil
+	}
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return fmt.Sprint(v.Interface()), nil
+	}
+	data, err := json.Marshal(v.Interface())
+	return string(bytes.TrimSpace(data)), err
+}
+
+func (c CSV) Encode(w io.Writer, v interface{}) error {
+	if !c.Supports(v) {
+		return fmt.Errorf("csv: cannot encode %T", v)
+	}
+	slice := reflect.ValueOf(v)
+	columns := csvColumns(slice.Type().Elem())
+
+	writer := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for i := 0; i < slice.Len(); i++ {
+		record := make([]string, len(columns))
+		for j, column := range columns {
+			value, err := csvValue(slice.Index(i).Field(column.index))
+			if err != nil {
+				return err
+			}
+			record[j] = value
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// MessagePack uses the JSON field names as map keys.
+type MessagePack struct{}
+
+func (MessagePack) Name() string              { return "msgpack" }
+func (MessagePack) ContentType() string       { return "application/msgpack" }
+func (MessagePack) Supports(interface{}) bool { return true }
+
+func (MessagePack) MediaTypes() []string {
+	return []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}
+}
+
+func (MessagePack) Encode(w io.Writer, v interface{}) error {
+	encoder := msgpack.NewEncoder(w)
+	encoder.SetCustomStructTag("json")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,165 @@
+// Package compression negotiates content codings and provides their encoders and decoders.
+package compression
+
+import (
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	Gzip   = "gzip"
+	Brotli = "br"
+	Zstd   = "zstd"
+)
+
+// Supported lists the response codings this package can produce, in order of preference.
+var Supported = []string{Zstd, Brotli, Gzip}
+
+func IsSupported(coding string) bool {
+	for _, supported := range Supported {
+		if coding == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// Negotiate picks the coding to use for a response given the request's Accept-Encoding header and
+// the codings offered, in order of preference. It returns "" when the response should not be encoded.
+func Negotiate(acceptEncoding string, offered []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if coding == "*" {
+			wildcard = q
+		} else {
+			weights[coding] = q
+		}
+	}
+
+	best, bestWeight := "", 0.0
+	for _, coding := range offered {
+		weight, ok := weights[coding]
+		if !ok {
+			weight = wildcard
+		}
+		if weight > bestWeight {
+			best, bestWeight = coding, weight
+		}
+	}
+	return best
+}
+
+// Writer is an encoder writing to an underlying writer. Flush sends what has been written so far
+// through the encoder; Close ends the stream without closing the underlying writer.
+type Writer interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// encoder is what gzip, brotli and zstd writers have in common.
+type encoder interface {
+	Writer
+	Reset(w io.Writer)
+}
+
+// encoders keeps the encoders of each coding for reuse: they allocate large windows, zstd in
+// particular, which are too costly to set up for every response.
+var encoders = map[string]*sync.Pool{
+	Gzip:   {New: func() interface{} { return gzip.NewWriter(nil) }},
+	Brotli: {New: func() interface{} { return brotli.NewWriterLevel(nil, brotli.DefaultCompression) }},
+	Zstd: {New: func() interface{} {
+		encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			panic(err)
+		}
+		return encoder
+	}},
+}
+
+// NewWriter returns an encoder for coding, gzip when it is not supported, writing to w. Closing it
+// returns the encoder to its pool; it must not be used afterwards.
+func NewWriter(coding string, w io.Writer) Writer {
+	pool, ok := encoders[coding]
+	if !ok {
+		pool = encoders[Gzip]
+	}
+	e := pool.Get().(encoder)
+	e.Reset(w)
+	return &pooledWriter{encoder: e, pool: pool}
+}
+
+type pooledWriter struct {
+	encoder
+	pool *sync.Pool
+}
+
+func (pw *pooledWriter) Close() error {
+	if pw.encoder == nil {
+		return nil
+	}
+	err := pw.encoder.Close()
+	// Let go of w until the encoder is reused.
+	pw.encoder.Reset(io.Discard)
+	pw.pool.Put(pw.encoder)
+	pw.encoder = nil
+	return err
+}
+
+type UnsupportedEncodingError struct {
+	Coding string
+}
+
+func (e UnsupportedEncodingError) Error() string {
+	return "Unsupported content coding: " + e.Coding
+}
+
+// NewReader returns a decoder for a request body sent with the given Content-Encoding. Only gzip
+// request bodies are accepted.
+func NewReader(coding string, r io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(coding) {
+	case "", "identity":
+		return io.NopCloser(r), nil
+	case Gzip, "x-gzip":
+		return gzip.NewReader(r)
+	default:
+		return nil, UnsupportedEncodingError{Coding: coding}
+	}
+}
+
+// TagETag marks an entity tag as belonging to the representation encoded with coding, since a
+// compressed response is a different representation than the uncompressed one.
+func TagETag(etag string, coding string) string {
+	if !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + "+" + coding + `"`
+}
+
+// UntagETags removes the marks added by TagETag from a list of entity tags, as sent in If-Match or
+// If-None-Match, so they can be compared against the tags of the unencoded representation.
+func UntagETags(header string) string {
+	for _, coding := range Supported {
+		header = strings.ReplaceAll(header, "+"+coding+`"`, `"`)
+	}
+	return header
+}
@@ -0,0 +1,102 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", Gzip},
+		{"gzip, br", Brotli},
+		{"gzip, br, zstd", Zstd},
+		{"gzip;q=1.0, br;q=0.5", Gzip},
+		{"zstd;q=0, gzip", Gzip},
+		{"*", Zstd},
+		{"*;q=0.1, gzip;q=0.5", Gzip},
+		{"br;q=0, *", Zstd},
+		{"deflate", ""},
+		{"GZIP", Gzip},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.acceptEncoding, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Negotiate(tc.acceptEncoding, Supported))
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(Gzip, &buf)
+	w.Write([]byte("hello hello hello"))
+	w.Close()
+
+	r, err := NewReader("gzip", &buf)
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(r)
+	assert.Equal(t, "hello hello hello", string(data))
+
+	_, err = NewReader("br", &buf)
+	assert.EqualError(t, err, "Unsupported content coding: br")
+}
+
+func TestPooledWriters(t *testing.T) {
+	for _, coding := range Supported {
+		t.Run(coding, func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				// GIVEN
+				var buf bytes.Buffer
+				w := NewWriter(coding, &buf)
+
+				// WHEN
+				w.Write([]byte("first "))
+				assert.NoError(t, w.Flush())
+				flushed := buf.Len()
+				w.Write([]byte("second"))
+				assert.NoError(t, w.Close())
+				assert.NoError(t, w.Close())
+
+				// THEN
+				assert.Greater(t, flushed, 0)
+				assert.Equal(t, "first second", decode(t, coding, &buf))
+			}
+		})
+	}
+}
+
+func decode(t *testing.T, coding string, r io.Reader) string {
+	var decoder io.Reader
+	switch coding {
+	case Gzip:
+		gz, err := gzip.NewReader(r)
+		assert.NoError(t, err)
+		decoder = gz
+	case Brotli:
+		decoder = brotli.NewReader(r)
+	case Zstd:
+		zr, err := zstd.NewReader(r)
+		assert.NoError(t, err)
+		defer zr.Close()
+		decoder = zr
+	}
+	data, err := io.ReadAll(decoder)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestETagTags(t *testing.T) {
+	assert.Equal(t, `"1-abc+gzip"`, TagETag(`"1-abc"`, Gzip))
+	assert.Equal(t, `W/"abc+br"`, TagETag(`W/"abc"`, Brotli))
+	assert.Equal(t, `"1-abc", W/"def"`, UntagETags(`"1-abc+gzip", W/"def+zstd"`))
+}
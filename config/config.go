@@ -0,0 +1,144 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+type Config struct {
+	ApiKeys []ApiKeyConfig `json:"apiKeys"`
+	Rbac    *RbacConfig    `json:"rbac"`
+	Oidc    *OidcConfig    `json:"oidc"`
+	// RateLimits maps a route pattern, e.g. "POST /api/comments", onto its token-bucket budget.
+	RateLimits  map[string]RateLimitConfig `json:"rateLimits"`
+	Idempotency IdempotencyConfig          `json:"idempotency"`
+	// RequireIfMatch makes updates and deletes without an If-Match header fail with 428.
+	RequireIfMatch bool `json:"requireIfMatch"`
+	// CacheControl maps a route pattern, e.g. "GET /api/posts/{postId}", onto its Cache-Control header.
+	CacheControl map[string]string  `json:"cacheControl"`
+	Compression  *CompressionConfig `json:"compression"`
+	// Deprecations maps an API version, e.g. "v1", onto the dates announced in its Deprecation and
+	// Sunset headers.
+	Deprecations map[string]DeprecationConfig `json:"deprecations"`
+	// DisableRequestValidation lets requests that do not conform to the OpenAPI document reach the handlers.
+	DisableRequestValidation bool `json:"disableRequestValidation"`
+	// ValidateResponses logs responses that do not conform to the OpenAPI document.
+	ValidateResponses bool `json:"validateResponses"`
+	// BatchLimit is how many posts or comments a batch create accepts, 100 by default.
+	BatchLimit int `json:"batchLimit"`
+	// PublishInterval is how often scheduled posts are checked for publication, 1m by default.
+	PublishInterval Duration `json:"publishInterval"`
+	// Revisions bounds the revisions kept of each post, the last 100 by default.
+	Revisions *RevisionsConfig `json:"revisions"`
+}
+
+// RevisionsConfig keeps at most the latest MaxCount revisions of each post, none older than MaxAge.
+// Zero fields do not bound; the latest revision of a post is always kept.
+type RevisionsConfig struct {
+	MaxCount int      `json:"maxCount"`
+	MaxAge   Duration `json:"maxAge"`
+}
+
+type DeprecationConfig struct {
+	Date   time.Time `json:"date"`
+	Sunset time.Time `json:"sunset"`
+}
+
+type CompressionConfig struct {
+	// MinSize is the smallest response, in bytes, worth compressing.
+	MinSize int `json:"minSize"`
+	// Encodings lists the response codings offered, in order of preference: "zstd", "br" and "gzip".
+	// An empty list disables response compression.
+	Encodings []string `json:"encodings"`
+}
+
+type IdempotencyConfig struct {
+	// Ttl is how long responses to requests with an Idempotency-Key are kept, 24h by default.
+	Ttl Duration `json:"ttl"`
+}
+
+type ApiKeyConfig struct {
+	Key     string `json:"key"`
+	Subject string `json:"subject"`
+	Role    string `json:"role"`
+}
+
+type RbacConfig struct {
+	// Roles maps a role name onto the list of permissions granted to it.
+	// A permission has the form "resource:action" (e.g. "posts:update"), optionally suffixed
+	// with ":own" to restrict it to resources owned by the caller. "*" grants everything.
+	Roles map[string][]string `json:"roles"`
+}
+
+type OidcConfig struct {
+	// Issuer is the identity provider URL; its /.well-known/openid-configuration document is used for discovery.
+	Issuer       string   `json:"issuer"`
+	ClientId     string   `json:"clientId"`
+	ClientSecret string   `json:"clientSecret"`
+	RedirectUrl  string   `json:"redirectUrl"`
+	Scopes       []string `json:"scopes"`
+	// SubjectClaim names the ID token claim used as the caller's subject, "sub" by default.
+	SubjectClaim string `json:"subjectClaim"`
+	// RoleClaim names the ID token claim (a string or a list of strings) matched against RoleMappings.
+	RoleClaim    string        `json:"roleClaim"`
+	RoleMappings []RoleMapping `json:"roleMappings"`
+	// DefaultRole is assigned when no role mapping matches.
+	DefaultRole string   `json:"defaultRole"`
+	SessionTtl  Duration `json:"sessionTtl"`
+}
+
+// RateLimitConfig allows Requests requests every Per on average, in bursts of up to Burst requests
+// (Requests when omitted).
+type RateLimitConfig struct {
+	Requests int      `json:"requests"`
+	Per      Duration `json:"per"`
+	Burst    int      `json:"burst"`
+}
+
+// RoleMapping assigns Role to callers whose role claim contains Value. The first matching mapping wins.
+type RoleMapping struct {
+	Value string `json:"value"`
+	Role  string `json:"role"`
+}
+
+// Duration is a time.Duration written in configuration files as a string such as "90s" or "12h".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func Default() Config {
+	return Config{}
+}
+
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("could not read config file %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("could not parse config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
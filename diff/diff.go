@@ -0,0 +1,120 @@
+// Package diff compares texts line by line with the Myers algorithm, which finds the shortest edit
+// script: the fewest lines deleted and inserted.
+package diff
+
+import (
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"strings"
+)
+
+// maxEdits bounds the search for the shortest edit script, which takes quadratic time in its length.
+// Texts further apart are reported as the lines of one replaced by those of the other.
+const maxEdits = 1000
+
+// Lines returns the edit script from one text to the other: every line of both, in order, kept,
+// deleted from from or inserted in to. Texts are split at newlines, CRLF or LF, and a final newline
+// does not make an empty last line.
+func Lines(from string, to string) []model.DiffLine {
+	a, b := split(from), split(to)
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	result := make([]model.DiffLine, 0, len(a)+len(b)-prefix-suffix)
+	result = appendLines(result, model.DiffEqual, a[:prefix])
+	result = append(result, edits(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	return appendLines(result, model.DiffEqual, a[len(a)-suffix:])
+}
+
+func split(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+func appendLines(result []model.DiffLine, op model.DiffOp, lines []string) []model.DiffLine {
+	for _, line := range lines {
+		result = append(result, model.DiffLine{Op: op, Text: line})
+	}
+	return result
+}
+
+// edits finds the shortest edit script from a to b. It follows the furthest reaching path on each
+// diagonal k = x - y for d = 0, 1, ... edits until one reaches the end of both, then walks back along
+// the paths recorded for each d.
+func edits(a []string, b []string) []model.DiffLine {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return appendLines(appendLines(nil, model.DiffDelete, a), model.DiffInsert, b)
+	}
+	max := n + m
+	if max > maxEdits {
+		max = maxEdits
+	}
+	// v[offset+k] is the furthest x reached on diagonal k. trace[d] keeps the diagonals -d-1 to d+1 of
+	// v as it was before the paths with d edits, the only ones those paths extend.
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+	return appendLines(appendLines(nil, model.DiffDelete, a), model.DiffInsert, b)
+}
+
+func backtrack(a []string, b []string, trace [][]int) []model.DiffLine {
+	var reversed []model.DiffLine
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := func(k int) int { return trace[d][k+d+1] }
+		k := x - y
+		previous := k - 1
+		if k == -d || (k != d && v(k-1) < v(k+1)) {
+			previous = k + 1
+		}
+		previousX := v(previous)
+		previousY := previousX - previous
+		for x > previousX && y > previousY {
+			x, y = x-1, y-1
+			reversed = append(reversed, model.DiffLine{Op: model.DiffEqual, Text: a[x]})
+		}
+		if d > 0 {
+			if x == previousX {
+				y--
+				reversed = append(reversed, model.DiffLine{Op: model.DiffInsert, Text: b[y]})
+			} else {
+				x--
+				reversed = append(reversed, model.DiffLine{Op: model.DiffDelete, Text: a[x]})
+			}
+		}
+	}
+
+	result := make([]model.DiffLine, len(reversed))
+	for i, line := range reversed {
+		result[len(reversed)-1-i] = line
+	}
+	return result
+}
@@ -0,0 +1,123 @@
+package diff
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	equal := func(text string) model.DiffLine { return model.DiffLine{Op: model.DiffEqual, Text: text} }
+	deleted := func(text string) model.DiffLine { return model.DiffLine{Op: model.DiffDelete, Text: text} }
+	inserted := func(text string) model.DiffLine { return model.DiffLine{Op: model.DiffInsert, Text: text} }
+
+	tests := []struct {
+		testName      string
+		from          string
+		to            string
+		expectedLines []model.DiffLine
+	}{
+		{
+			testName:      "testEqual",
+			from:          "a\nb\n",
+			to:            "a\r\nb",
+			expectedLines: []model.DiffLine{equal("a"), equal("b")},
+		},
+		{
+			testName:      "testEmpty",
+			from:          "",
+			to:            "",
+			expectedLines: []model.DiffLine{},
+		},
+		{
+			testName:      "testInsertedIntoEmpty",
+			from:          "",
+			to:            "a\nb",
+			expectedLines: []model.DiffLine{inserted("a"), inserted("b")},
+		},
+		{
+			testName:      "testDeletedAll",
+			from:          "a\nb",
+			to:            "",
+			expectedLines: []model.DiffLine{deleted("a"), deleted("b")},
+		},
+		{
+			testName:      "testChangedLine",
+			from:          "one\ntwo\nthree",
+			to:            "one\n2\nthree",
+			expectedLines: []model.DiffLine{equal("one"), deleted("two"), inserted("2"), equal("three")},
+		},
+		{
+			testName: "testShortestScript",
+			from:     "a\nb\nc\na\nb\nb\na",
+			to:       "c\nb\na\nb\na\nc",
+			expectedLines: []model.DiffLine{
+				deleted("a"), deleted("b"), equal("c"), inserted("b"), equal("a"), equal("b"), deleted("b"), equal("a"), inserted("c"),
+			},
+		},
+		{
+			testName:      "testMovedLine",
+			from:          "title\nfirst\nsecond\nthird",
+			to:            "title\nsecond\nthird\nfirst",
+			expectedLines: []model.DiffLine{equal("title"), deleted("first"), equal("second"), equal("third"), inserted("first")},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// WHEN
+			lines := Lines(tc.from, tc.to)
+
+			// THEN
+			assert.Equal(t, tc.expectedLines, lines)
+		})
+	}
+}
+
+func TestLinesReproduceBothTexts(t *testing.T) {
+	tests := []struct {
+		testName string
+		from     string
+		to       string
+	}{
+		{testName: "testInterleaved", from: "1\n2\n3\n4\n5\n6\n7\n8", to: "0\n2\n4\n4\n6\n8\n9"},
+		{testName: "testRepeated", from: strings.Repeat("x\ny\n", 50), to: strings.Repeat("y\nx\n", 40)},
+		{testName: "testBeyondMaxEdits", from: numbered("a", 700), to: numbered("b", 700)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// WHEN
+			lines := Lines(tc.from, tc.to)
+
+			// THEN
+			var from, to []string
+			edits := 0
+			for _, line := range lines {
+				if line.Op != model.DiffInsert {
+					from = append(from, line.Text)
+				}
+				if line.Op != model.DiffDelete {
+					to = append(to, line.Text)
+				}
+				if line.Op != model.DiffEqual {
+					edits++
+				}
+			}
+			assert.Equal(t, split(tc.from), from)
+			assert.Equal(t, split(tc.to), to)
+			assert.LessOrEqual(t, edits, len(split(tc.from))+len(split(tc.to)))
+		})
+	}
+}
+
+func numbered(prefix string, n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteString(prefix)
+		b.WriteString(strings.Repeat(".", i%7))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,215 @@
+// Package dto maps the domain model to and from the wire format of each API version, so that the
+// model can change without breaking clients.
+package dto
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	v1 "gitlab.com/devskiller-tasks/rest-api-blog-golang/dto/v1"
+	v2 "gitlab.com/devskiller-tasks/rest-api-blog-golang/dto/v2"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/search"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/transfer"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Version int
+
+const (
+	V1 Version = 1
+	V2 Version = 2
+
+	Latest = V2
+)
+
+type UnsupportedVersionError struct {
+	Version string
+}
+
+func (e UnsupportedVersionError) Error() string {
+	return "Unsupported API version: " + e.Version
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("v%d", int(v))
+}
+
+// ParseVersion parses a version written as by Version.String, e.g. "v2".
+func ParseVersion(s string) (Version, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(s, "v"))
+	if err != nil || !strings.HasPrefix(s, "v") || n < int(V1) || n > int(Latest) {
+		return 0, UnsupportedVersionError{Version: s}
+	}
+	return Version(n), nil
+}
+
+type versionKey struct{}
+
+func WithVersion(ctx context.Context, version Version) context.Context {
+	return context.WithValue(ctx, versionKey{}, version)
+}
+
+// VersionFromContext returns the API version a request was routed to, V1 when it has not been set.
+func VersionFromContext(ctx context.Context) Version {
+	if version, ok := ctx.Value(versionKey{}).(Version); ok {
+		return version
+	}
+	return V1
+}
+
+func Post(version Version, post model.Post) interface{} {
+	if version == V2 {
+		return v2.FromPost(post)
+	}
+	return v1.FromPost(post)
+}
+
+func Posts(version Version, posts []model.Post) interface{} {
+	if version == V2 {
+		return v2.FromPosts(posts)
+	}
+	return v1.FromPosts(posts)
+}
+
+func Comment(version Version, comment model.Comment) interface{} {
+	if version == V2 {
+		return v2.FromComment(comment)
+	}
+	return v1.FromComment(comment)
+}
+
+func Comments(version Version, comments []model.Comment) interface{} {
+	if version == V2 {
+		return v2.FromComments(comments)
+	}
+	return v1.FromComments(comments)
+}
+
+func CommentTree(version Version, nodes []model.CommentNode) interface{} {
+	if version == V2 {
+		return v2.FromCommentTree(nodes)
+	}
+	return v1.FromCommentTree(nodes)
+}
+
+func SearchHits(version Version, hits []search.Hit) interface{} {
+	if version == V2 {
+		return v2.FromSearchHits(hits)
+	}
+	return v1.FromSearchHits(hits)
+}
+
+func Tags(version Version, tags []model.Tag) interface{} {
+	if version == V2 {
+		return v2.FromTags(tags)
+	}
+	return v1.FromTags(tags)
+}
+
+func Revisions(version Version, revisions []model.Revision) interface{} {
+	if version == V2 {
+		return v2.FromRevisions(revisions)
+	}
+	return v1.FromRevisions(revisions)
+}
+
+func Revision(version Version, revision model.Revision) interface{} {
+	if version == V2 {
+		return v2.FromRevision(revision)
+	}
+	return v1.FromRevision(revision)
+}
+
+func RevisionDiff(version Version, diff model.RevisionDiff) interface{} {
+	if version == V2 {
+		return v2.FromRevisionDiff(diff)
+	}
+	return v1.FromRevisionDiff(diff)
+}
+
+func ImportReport(version Version, report transfer.Report) interface{} {
+	if version == V2 {
+		result := v2.ImportReport{
+			DryRun:   report.DryRun,
+			Posts:    v2.ImportCounts(report.Posts),
+			Comments: v2.ImportCounts(report.Comments),
+			Errors:   make([]v2.ImportError, len(report.Errors)),
+			Aborted:  report.Aborted,
+		}
+		for i, e := range report.Errors {
+			result.Errors[i] = v2.ImportError{Line: e.Line, Status: e.Status, Detail: e.Message}
+		}
+		return result
+	}
+	result := v1.ImportReport{
+		DryRun:   report.DryRun,
+		Posts:    v1.ImportCounts(report.Posts),
+		Comments: v1.ImportCounts(report.Comments),
+		Errors:   make([]v1.ImportError, len(report.Errors)),
+		Aborted:  report.Aborted,
+	}
+	for i, e := range report.Errors {
+		result.Errors[i] = v1.ImportError{Line: e.Line, Message: e.Message, Status: e.Status}
+	}
+	return result
+}
+
+// Ack is the v2 (and later) body of a response that carries no resource: problem details for errors.
+// The v1 acknowledgement is defined by the service itself.
+func Ack(version Version, status int, message string) interface{} {
+	if status >= 400 {
+		return v2.NewProblem(status, message)
+	}
+	return v2.Ack{Message: message, Status: status}
+}
+
+// PostPayload and CommentPayload are the request payloads of a version, mapped to the domain model.
+type PostPayload interface {
+	Model() model.Post
+}
+
+type CommentPayload interface {
+	Model() model.Comment
+}
+
+func NewCreatePost(version Version) PostPayload {
+	if version == V2 {
+		return &v2.CreatePost{}
+	}
+	return &v1.CreatePost{}
+}
+
+func NewUpdatePost(version Version) PostPayload {
+	if version == V2 {
+		return &v2.UpdatePost{}
+	}
+	return &v1.UpdatePost{}
+}
+
+func NewCreateComment(version Version) CommentPayload {
+	if version == V2 {
+		return &v2.CreateComment{}
+	}
+	return &v1.CreateComment{}
+}
+
+func DecodeCreatePost(version Version, r io.Reader) (model.Post, error) {
+	payload := NewCreatePost(version)
+	err := json.NewDecoder(r).Decode(payload)
+	return payload.Model(), err
+}
+
+func DecodeUpdatePost(version Version, r io.Reader) (model.Post, error) {
+	payload := NewUpdatePost(version)
+	err := json.NewDecoder(r).Decode(payload)
+	return payload.Model(), err
+}
+
+func DecodeCreateComment(version Version, r io.Reader) (model.Comment, error) {
+	payload := NewCreateComment(version)
+	err := json.NewDecoder(r).Decode(payload)
+	return payload.Model(), err
+}
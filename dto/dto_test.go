@@ -0,0 +1,113 @@
+package dto
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	v1 "gitlab.com/devskiller-tasks/rest-api-blog-golang/dto/v1"
+	v2 "gitlab.com/devskiller-tasks/rest-api-blog-golang/dto/v2"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testDate = time.Date(2018, time.September, 16, 12, 0, 0, 0, time.UTC)
+
+func TestVersionFromContext(t *testing.T) {
+	assert.Equal(t, V1, VersionFromContext(context.Background()))
+	assert.Equal(t, V2, VersionFromContext(WithVersion(context.Background(), V2)))
+	assert.Equal(t, "v2", V2.String())
+}
+
+func TestPost(t *testing.T) {
+	post := model.Post{Id: 1, Title: "title", Content: "content", Author: "alice", CreationDate: testDate, Version: 3}
+	modified := post
+	modified.ModificationDate = testDate.Add(time.Hour)
+	modifiedAt := modified.ModificationDate
+
+	assert.Equal(t, v1.Post{Id: 1, Title: "title", Content: "content", Author: "alice", CreationDate: testDate, Version: 3}, Post(V1, post))
+	assert.Equal(t, v2.Post{Id: 1, Title: "title", Content: "content", Author: "alice", Created: testDate, Version: 3}, Post(V2, post))
+	assert.Equal(t, &modifiedAt, Post(V2, modified).(v2.Post).Modified)
+}
+
+func TestComments(t *testing.T) {
+	comments := []model.Comment{{Id: 1, PostId: 2, Comment: "text", Author: "bob", CreationDate: testDate, Hidden: true}}
+
+	assert.Equal(t, []v1.Comment{{Id: 1, PostId: 2, Comment: "text", Author: "bob", CreationDate: testDate, Hidden: true}}, Comments(V1, comments))
+	assert.Equal(t, []v2.Comment{{Id: 1, PostId: 2, Body: "text", Author: "bob", Created: testDate, Hidden: true}}, Comments(V2, comments))
+	assert.Equal(t, v2.Comment{Id: 1, PostId: 2, Body: "text", Author: "bob", Created: testDate, Hidden: true}, Comment(V2, comments[0]))
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		testName string
+		version  Version
+		payload  string
+		decode   func(Version, string) (interface{}, error)
+		expected interface{}
+	}{
+		{
+			testName: "testCreatePostV1",
+			version:  V1,
+			payload:  `{"Id": 1, "Title": "t", "Content": "c", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z", "Version": 9}`,
+			decode:   decodeCreatePost,
+			expected: model.Post{Id: 1, Title: "t", Content: "c", Author: "a", CreationDate: testDate},
+		},
+		{
+			testName: "testCreatePostV2",
+			version:  V2,
+			payload:  `{"id": 1, "title": "t", "content": "c", "author": "a", "createdAt": "2018-09-16T12:00:00Z"}`,
+			decode:   decodeCreatePost,
+			expected: model.Post{Id: 1, Title: "t", Content: "c", Author: "a", CreationDate: testDate},
+		},
+		{
+			testName: "testUpdatePostV2",
+			version:  V2,
+			payload:  `{"title": "t", "content": "c", "author": "mallory"}`,
+			decode:   decodeUpdatePost,
+			expected: model.Post{Title: "t", Content: "c"},
+		},
+		{
+			testName: "testCreateCommentV1",
+			version:  V1,
+			payload:  `{"Id": 1, "PostId": 2, "Comment": "x", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z", "Hidden": true}`,
+			decode:   decodeCreateComment,
+			expected: model.Comment{Id: 1, PostId: 2, Comment: "x", Author: "a", CreationDate: testDate},
+		},
+		{
+			testName: "testCreateCommentV2",
+			version:  V2,
+			payload:  `{"id": 1, "postId": 2, "body": "x", "author": "a", "createdAt": "2018-09-16T12:00:00Z"}`,
+			decode:   decodeCreateComment,
+			expected: model.Comment{Id: 1, PostId: 2, Comment: "x", Author: "a", CreationDate: testDate},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// WHEN
+			result, err := tc.decode(tc.version, tc.payload)
+
+			// THEN
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestDecodeInvalidPayload(t *testing.T) {
+	_, err := DecodeCreateComment(V2, strings.NewReader(`{"id": "one"}`))
+	assert.Error(t, err)
+}
+
+func decodeCreatePost(version Version, payload string) (interface{}, error) {
+	return DecodeCreatePost(version, strings.NewReader(payload))
+}
+
+func decodeUpdatePost(version Version, payload string) (interface{}, error) {
+	return DecodeUpdatePost(version, strings.NewReader(payload))
+}
+
+func decodeCreateComment(version Version, payload string) (interface{}, error) {
+	return DecodeCreateComment(version, strings.NewReader(payload))
+}
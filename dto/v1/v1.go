@@ -0,0 +1,280 @@
+// Package v1 is the wire format of the first release of the API. The JSON names are those the domain
+// model had at the time and must never change, whatever happens to the model.
+package v1
+
+import (
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/search"
+	"time"
+)
+
+type Post struct {
+	Id               uint64     `json:"Id"`
+	Title            string     `json:"Title"`
+	Content          string     `json:"Content"`
+	Author           string     `json:"Author"`
+	CreationDate     time.Time  `json:"CreationDate"`
+	ModificationDate time.Time  `json:"ModificationDate"`
+	Version          uint64     `json:"Version"`
+	Slug             string     `json:"Slug,omitempty" xml:"Slug,omitempty"`
+	Tags             []string   `json:"Tags,omitempty" xml:"Tag,omitempty"`
+	Category         string     `json:"Category,omitempty" xml:"Category,omitempty"`
+	Status           string     `json:"Status,omitempty" xml:"Status,omitempty"`
+	PublishAt        *time.Time `json:"PublishAt,omitempty" xml:"PublishAt,omitempty"`
+	ContentFormat    string     `json:"ContentFormat,omitempty" xml:"ContentFormat,omitempty"`
+	// ContentHtml is only sent when asked for with the contentHtml query parameter.
+	ContentHtml string `json:"ContentHtml,omitempty" xml:"ContentHtml,omitempty"`
+}
+
+func FromPost(post model.Post) Post {
+	return Post{
+		Id:               post.Id,
+		Title:            post.Title,
+		Content:          post.Content,
+		Author:           post.Author,
+		CreationDate:     post.CreationDate,
+		ModificationDate: post.ModificationDate,
+		Version:          post.Version,
+		Slug:             post.Slug,
+		Tags:             post.Tags,
+		Category:         post.Category,
+		Status:           string(post.Status),
+		PublishAt:        post.PublishAt,
+		ContentFormat:    string(post.ContentFormat),
+		ContentHtml:      post.ContentHtml,
+	}
+}
+
+func FromPosts(posts []model.Post) []Post {
+	result := make([]Post, len(posts))
+	for i, post := range posts {
+		result[i] = FromPost(post)
+	}
+	return result
+}
+
+type Comment struct {
+	Id           uint64    `json:"Id"`
+	PostId       uint64    `json:"PostId"`
+	Comment      string    `json:"Comment"`
+	Author       string    `json:"Author"`
+	CreationDate time.Time `json:"CreationDate"`
+	Hidden       bool      `json:"Hidden"`
+	Version      uint64    `json:"Version"`
+	ParentId     uint64    `json:"ParentId,omitempty" xml:"ParentId,omitempty"`
+	// CommentHtml is only sent when asked for with the commentHtml query parameter.
+	CommentHtml string `json:"CommentHtml,omitempty" xml:"CommentHtml,omitempty"`
+}
+
+func FromComment(comment model.Comment) Comment {
+	return Comment{
+		Id:           comment.Id,
+		PostId:       comment.PostId,
+		Comment:      comment.Comment,
+		Author:       comment.Author,
+		CreationDate: comment.CreationDate,
+		Hidden:       comment.Hidden,
+		Version:      comment.Version,
+		ParentId:     comment.ParentId,
+		CommentHtml:  comment.CommentHtml,
+	}
+}
+
+func FromComments(comments []model.Comment) []Comment {
+	result := make([]Comment, len(comments))
+	for i, comment := range comments {
+		result[i] = FromComment(comment)
+	}
+	return result
+}
+
+// CommentNode is an element of the response of GET /api/comments?view=tree.
+type CommentNode struct {
+	Comment
+	Replies []CommentNode `json:"Replies" xml:"Reply"`
+}
+
+func FromCommentTree(nodes []model.CommentNode) []CommentNode {
+	result := make([]CommentNode, len(nodes))
+	for i, node := range nodes {
+		result[i] = CommentNode{Comment: FromComment(node.Comment), Replies: FromCommentTree(node.Replies)}
+	}
+	return result
+}
+
+// CreatePost is the payload of POST /api/posts. The version and modification date are maintained by
+// the service and cannot be set by clients. The author defaults to the caller and, like the creation
+// date, may be left out.
+type CreatePost struct {
+	Id           uint64    `json:"Id"`
+	Title        string    `json:"Title"`
+	Content      string    `json:"Content"`
+	Author       string    `json:"Author,omitempty"`
+	CreationDate time.Time `json:"CreationDate,omitempty"`
+	Tags         []string  `json:"Tags,omitempty"`
+	Category     string    `json:"Category,omitempty"`
+	// Status defaults to published; scheduled posts need a PublishAt.
+	Status    string     `json:"Status,omitempty"`
+	PublishAt *time.Time `json:"PublishAt,omitempty"`
+	// ContentFormat is one of plain, markdown and html, plain by default.
+	ContentFormat string `json:"ContentFormat,omitempty"`
+}
+
+func (p CreatePost) Model() model.Post {
+	return model.Post{
+		Id: p.Id, Title: p.Title, Content: p.Content, Author: p.Author, CreationDate: p.CreationDate,
+		Tags: p.Tags, Category: p.Category, Status: model.PostStatus(p.Status), PublishAt: p.PublishAt,
+		ContentFormat: model.ContentFormat(p.ContentFormat),
+	}
+}
+
+// UpdatePost is the payload of PUT /api/posts/{postId}. Tags, category, status and content format are
+// kept when left out.
+type UpdatePost struct {
+	Title         string     `json:"Title"`
+	Content       string     `json:"Content"`
+	Tags          []string   `json:"Tags,omitempty"`
+	Category      string     `json:"Category,omitempty"`
+	Status        string     `json:"Status,omitempty"`
+	PublishAt     *time.Time `json:"PublishAt,omitempty"`
+	ContentFormat string     `json:"ContentFormat,omitempty"`
+}
+
+func (p UpdatePost) Model() model.Post {
+	return model.Post{
+		Title: p.Title, Content: p.Content, Tags: p.Tags, Category: p.Category,
+		Status: model.PostStatus(p.Status), PublishAt: p.PublishAt, ContentFormat: model.ContentFormat(p.ContentFormat),
+	}
+}
+
+// SearchHit is an element of the response of GET /api/search. The snippet is HTML.
+type SearchHit struct {
+	Type    string  `json:"Type"`
+	Id      uint64  `json:"Id"`
+	PostId  uint64  `json:"PostId"`
+	Score   float64 `json:"Score"`
+	Snippet string  `json:"Snippet"`
+}
+
+func FromSearchHits(hits []search.Hit) []SearchHit {
+	result := make([]SearchHit, len(hits))
+	for i, hit := range hits {
+		result[i] = SearchHit{Type: string(hit.Kind), Id: hit.Id, PostId: hit.PostId, Score: hit.Score, Snippet: hit.Snippet}
+	}
+	return result
+}
+
+// Tag is an element of the response of GET /api/tags.
+type Tag struct {
+	Name  string `json:"Name"`
+	Posts int    `json:"Posts"`
+}
+
+func FromTags(tags []model.Tag) []Tag {
+	result := make([]Tag, len(tags))
+	for i, tag := range tags {
+		result[i] = Tag(tag)
+	}
+	return result
+}
+
+// CreateComment is the payload of POST /api/comments. Comments are never hidden when created.
+type CreateComment struct {
+	Id           uint64    `json:"Id"`
+	PostId       uint64    `json:"PostId"`
+	Comment      string    `json:"Comment"`
+	Author       string    `json:"Author"`
+	CreationDate time.Time `json:"CreationDate"`
+	ParentId     uint64    `json:"ParentId,omitempty"`
+}
+
+func (c CreateComment) Model() model.Comment {
+	return model.Comment{Id: c.Id, PostId: c.PostId, Comment: c.Comment, Author: c.Author, CreationDate: c.CreationDate, ParentId: c.ParentId}
+}
+
+// Revision is an element of the response of GET /api/posts/{postId}/revisions.
+type Revision struct {
+	PostId        uint64    `json:"PostId"`
+	Number        uint64    `json:"Number"`
+	Version       uint64    `json:"Version"`
+	Title         string    `json:"Title"`
+	Content       string    `json:"Content"`
+	ContentFormat string    `json:"ContentFormat,omitempty" xml:"ContentFormat,omitempty"`
+	Editor        string    `json:"Editor"`
+	Date          time.Time `json:"Date"`
+	RestoredFrom  uint64    `json:"RestoredFrom,omitempty" xml:"RestoredFrom,omitempty"`
+}
+
+func FromRevision(revision model.Revision) Revision {
+	return Revision{
+		PostId:        revision.PostId,
+		Number:        revision.Number,
+		Version:       revision.Version,
+		Title:         revision.Title,
+		Content:       revision.Content,
+		ContentFormat: string(revision.ContentFormat),
+		Editor:        revision.Editor,
+		Date:          revision.Date,
+		RestoredFrom:  revision.RestoredFrom,
+	}
+}
+
+func FromRevisions(revisions []model.Revision) []Revision {
+	result := make([]Revision, len(revisions))
+	for i, revision := range revisions {
+		result[i] = FromRevision(revision)
+	}
+	return result
+}
+
+// RevisionDiff is the response of GET /api/posts/{postId}/revisions/diff.
+type RevisionDiff struct {
+	PostId  uint64     `json:"PostId"`
+	From    uint64     `json:"From"`
+	To      uint64     `json:"To"`
+	Title   []DiffLine `json:"Title" xml:"Title"`
+	Content []DiffLine `json:"Content" xml:"Content"`
+}
+
+// DiffLine is a line kept, deleted or inserted: Op is one of equal, delete and insert.
+type DiffLine struct {
+	Op   string `json:"Op"`
+	Text string `json:"Text"`
+}
+
+func FromRevisionDiff(diff model.RevisionDiff) RevisionDiff {
+	return RevisionDiff{
+		PostId: diff.PostId, From: diff.From, To: diff.To,
+		Title: fromDiffLines(diff.Title), Content: fromDiffLines(diff.Content),
+	}
+}
+
+func fromDiffLines(lines []model.DiffLine) []DiffLine {
+	result := make([]DiffLine, len(lines))
+	for i, line := range lines {
+		result[i] = DiffLine{Op: string(line.Op), Text: line.Text}
+	}
+	return result
+}
+
+// ImportReport is the response of POST /api/admin/import.
+type ImportReport struct {
+	DryRun   bool          `json:"DryRun"`
+	Posts    ImportCounts  `json:"Posts"`
+	Comments ImportCounts  `json:"Comments"`
+	Errors   []ImportError `json:"Errors"`
+	Aborted  bool          `json:"Aborted"`
+}
+
+type ImportCounts struct {
+	Created     int `json:"Created"`
+	Overwritten int `json:"Overwritten"`
+	Skipped     int `json:"Skipped"`
+}
+
+// ImportError reports a line that was not imported, in the style of an `AckJsonResponse`.
+type ImportError struct {
+	Line    int    `json:"Line"`
+	Message string `json:"Message"`
+	Status  int    `json:"Status"`
+}
@@ -0,0 +1,341 @@
+// Package v2 is the camelCase wire format of the second release of the API.
+package v2
+
+import (
+	"encoding/xml"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/search"
+	"net/http"
+	"time"
+)
+
+type Post struct {
+	Id      uint64    `json:"id" xml:"id"`
+	Title   string    `json:"title" xml:"title"`
+	Content string    `json:"content" xml:"content"`
+	Author  string    `json:"author" xml:"author"`
+	Created time.Time `json:"createdAt" xml:"createdAt"`
+	// Modified is left out until the post is first updated.
+	Modified      *time.Time `json:"modifiedAt,omitempty" xml:"modifiedAt,omitempty"`
+	Version       uint64     `json:"version" xml:"version"`
+	Slug          string     `json:"slug,omitempty" xml:"slug,omitempty"`
+	Tags          []string   `json:"tags,omitempty" xml:"tag,omitempty"`
+	Category      string     `json:"category,omitempty" xml:"category,omitempty"`
+	Status        string     `json:"status,omitempty" xml:"status,omitempty"`
+	PublishAt     *time.Time `json:"publishAt,omitempty" xml:"publishAt,omitempty"`
+	ContentFormat string     `json:"contentFormat,omitempty" xml:"contentFormat,omitempty"`
+	// ContentHtml is only sent when asked for with the contentHtml query parameter.
+	ContentHtml string `json:"contentHtml,omitempty" xml:"contentHtml,omitempty"`
+}
+
+func FromPost(post model.Post) Post {
+	result := Post{
+		Id:        post.Id,
+		Title:     post.Title,
+		Content:   post.Content,
+		Author:    post.Author,
+		Created:   post.CreationDate,
+		Version:   post.Version,
+		Slug:      post.Slug,
+		Tags:      post.Tags,
+		Category:  post.Category,
+		Status:    string(post.Status),
+		PublishAt: post.PublishAt,
+
+		ContentFormat: string(post.ContentFormat),
+		ContentHtml:   post.ContentHtml,
+	}
+	if !post.ModificationDate.IsZero() {
+		modified := post.ModificationDate
+		result.Modified = &modified
+	}
+	return result
+}
+
+func (p Post) Model() model.Post {
+	post := model.Post{
+		Id:           p.Id,
+		Title:        p.Title,
+		Content:      p.Content,
+		Author:       p.Author,
+		CreationDate: p.Created,
+		Version:      p.Version,
+		Slug:         p.Slug,
+		Tags:         p.Tags,
+		Category:     p.Category,
+		Status:       model.PostStatus(p.Status),
+		PublishAt:    p.PublishAt,
+
+		ContentFormat: model.ContentFormat(p.ContentFormat),
+	}
+	if p.Modified != nil {
+		post.ModificationDate = *p.Modified
+	}
+	return post
+}
+
+func FromPosts(posts []model.Post) []Post {
+	result := make([]Post, len(posts))
+	for i, post := range posts {
+		result[i] = FromPost(post)
+	}
+	return result
+}
+
+type Comment struct {
+	Id       uint64    `json:"id" xml:"id"`
+	PostId   uint64    `json:"postId" xml:"postId"`
+	Body     string    `json:"body" xml:"body"`
+	Author   string    `json:"author" xml:"author"`
+	Created  time.Time `json:"createdAt" xml:"createdAt"`
+	Hidden   bool      `json:"hidden" xml:"hidden"`
+	Version  uint64    `json:"version" xml:"version"`
+	ParentId uint64    `json:"parentId,omitempty" xml:"parentId,omitempty"`
+	// BodyHtml is only sent when asked for with the commentHtml query parameter.
+	BodyHtml string `json:"bodyHtml,omitempty" xml:"bodyHtml,omitempty"`
+}
+
+func FromComment(comment model.Comment) Comment {
+	return Comment{
+		Id:       comment.Id,
+		PostId:   comment.PostId,
+		Body:     comment.Comment,
+		Author:   comment.Author,
+		Created:  comment.CreationDate,
+		Hidden:   comment.Hidden,
+		Version:  comment.Version,
+		ParentId: comment.ParentId,
+		BodyHtml: comment.CommentHtml,
+	}
+}
+
+func (c Comment) Model() model.Comment {
+	return model.Comment{
+		Id:           c.Id,
+		PostId:       c.PostId,
+		Comment:      c.Body,
+		Author:       c.Author,
+		CreationDate: c.Created,
+		Hidden:       c.Hidden,
+		Version:      c.Version,
+		ParentId:     c.ParentId,
+	}
+}
+
+func FromComments(comments []model.Comment) []Comment {
+	result := make([]Comment, len(comments))
+	for i, comment := range comments {
+		result[i] = FromComment(comment)
+	}
+	return result
+}
+
+// CommentNode is an element of the response of GET /api/comments?view=tree.
+type CommentNode struct {
+	Comment
+	Replies []CommentNode `json:"replies" xml:"reply"`
+}
+
+func FromCommentTree(nodes []model.CommentNode) []CommentNode {
+	result := make([]CommentNode, len(nodes))
+	for i, node := range nodes {
+		result[i] = CommentNode{Comment: FromComment(node.Comment), Replies: FromCommentTree(node.Replies)}
+	}
+	return result
+}
+
+// CreatePost is the payload of POST /api/posts. The version and modification date are maintained by
+// the service and cannot be set by clients. The author defaults to the caller and, like the creation
+// date, may be left out.
+type CreatePost struct {
+	Id       uint64    `json:"id"`
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	Author   string    `json:"author,omitempty"`
+	Created  time.Time `json:"createdAt,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	Category string    `json:"category,omitempty"`
+	// Status defaults to published; scheduled posts need a publishAt.
+	Status    string     `json:"status,omitempty"`
+	PublishAt *time.Time `json:"publishAt,omitempty"`
+	// ContentFormat is one of plain, markdown and html, plain by default.
+	ContentFormat string `json:"contentFormat,omitempty"`
+}
+
+func (p CreatePost) Model() model.Post {
+	return model.Post{
+		Id: p.Id, Title: p.Title, Content: p.Content, Author: p.Author, CreationDate: p.Created,
+		Tags: p.Tags, Category: p.Category, Status: model.PostStatus(p.Status), PublishAt: p.PublishAt,
+		ContentFormat: model.ContentFormat(p.ContentFormat),
+	}
+}
+
+// UpdatePost is the payload of PUT /api/posts/{postId}. Tags, category, status and content format are
+// kept when left out.
+type UpdatePost struct {
+	Title         string     `json:"title"`
+	Content       string     `json:"content"`
+	Tags          []string   `json:"tags,omitempty"`
+	Category      string     `json:"category,omitempty"`
+	Status        string     `json:"status,omitempty"`
+	PublishAt     *time.Time `json:"publishAt,omitempty"`
+	ContentFormat string     `json:"contentFormat,omitempty"`
+}
+
+func (p UpdatePost) Model() model.Post {
+	return model.Post{
+		Title: p.Title, Content: p.Content, Tags: p.Tags, Category: p.Category,
+		Status: model.PostStatus(p.Status), PublishAt: p.PublishAt, ContentFormat: model.ContentFormat(p.ContentFormat),
+	}
+}
+
+// SearchHit is an element of the response of GET /api/search. The snippet is HTML.
+type SearchHit struct {
+	Type    string  `json:"type" xml:"type"`
+	Id      uint64  `json:"id" xml:"id"`
+	PostId  uint64  `json:"postId" xml:"postId"`
+	Score   float64 `json:"score" xml:"score"`
+	Snippet string  `json:"snippet" xml:"snippet"`
+}
+
+func FromSearchHits(hits []search.Hit) []SearchHit {
+	result := make([]SearchHit, len(hits))
+	for i, hit := range hits {
+		result[i] = SearchHit{Type: string(hit.Kind), Id: hit.Id, PostId: hit.PostId, Score: hit.Score, Snippet: hit.Snippet}
+	}
+	return result
+}
+
+// Tag is an element of the response of GET /api/tags.
+type Tag struct {
+	Name  string `json:"name" xml:"name"`
+	Posts int    `json:"posts" xml:"posts"`
+}
+
+func FromTags(tags []model.Tag) []Tag {
+	result := make([]Tag, len(tags))
+	for i, tag := range tags {
+		result[i] = Tag(tag)
+	}
+	return result
+}
+
+// Revision is an element of the response of GET /api/posts/{postId}/revisions.
+type Revision struct {
+	PostId        uint64    `json:"postId" xml:"postId"`
+	Number        uint64    `json:"number" xml:"number"`
+	Version       uint64    `json:"version" xml:"version"`
+	Title         string    `json:"title" xml:"title"`
+	Content       string    `json:"content" xml:"content"`
+	ContentFormat string    `json:"contentFormat,omitempty" xml:"contentFormat,omitempty"`
+	Editor        string    `json:"editor" xml:"editor"`
+	Edited        time.Time `json:"editedAt" xml:"editedAt"`
+	RestoredFrom  uint64    `json:"restoredFrom,omitempty" xml:"restoredFrom,omitempty"`
+}
+
+func FromRevision(revision model.Revision) Revision {
+	return Revision{
+		PostId:        revision.PostId,
+		Number:        revision.Number,
+		Version:       revision.Version,
+		Title:         revision.Title,
+		Content:       revision.Content,
+		ContentFormat: string(revision.ContentFormat),
+		Editor:        revision.Editor,
+		Edited:        revision.Date,
+		RestoredFrom:  revision.RestoredFrom,
+	}
+}
+
+func FromRevisions(revisions []model.Revision) []Revision {
+	result := make([]Revision, len(revisions))
+	for i, revision := range revisions {
+		result[i] = FromRevision(revision)
+	}
+	return result
+}
+
+// RevisionDiff is the response of GET /api/posts/{postId}/revisions/diff.
+type RevisionDiff struct {
+	PostId  uint64     `json:"postId" xml:"postId"`
+	From    uint64     `json:"from" xml:"from"`
+	To      uint64     `json:"to" xml:"to"`
+	Title   []DiffLine `json:"title" xml:"title"`
+	Content []DiffLine `json:"content" xml:"content"`
+}
+
+// DiffLine is a line kept, deleted or inserted: Op is one of equal, delete and insert.
+type DiffLine struct {
+	Op   string `json:"op" xml:"op"`
+	Text string `json:"text" xml:"text"`
+}
+
+func FromRevisionDiff(diff model.RevisionDiff) RevisionDiff {
+	return RevisionDiff{
+		PostId: diff.PostId, From: diff.From, To: diff.To,
+		Title: fromDiffLines(diff.Title), Content: fromDiffLines(diff.Content),
+	}
+}
+
+func fromDiffLines(lines []model.DiffLine) []DiffLine {
+	result := make([]DiffLine, len(lines))
+	for i, line := range lines {
+		result[i] = DiffLine{Op: string(line.Op), Text: line.Text}
+	}
+	return result
+}
+
+// CreateComment is the payload of POST /api/comments. Comments are never hidden when created.
+type CreateComment struct {
+	Id       uint64    `json:"id"`
+	PostId   uint64    `json:"postId"`
+	Body     string    `json:"body"`
+	Author   string    `json:"author"`
+	Created  time.Time `json:"createdAt"`
+	ParentId uint64    `json:"parentId,omitempty"`
+}
+
+func (c CreateComment) Model() model.Comment {
+	return model.Comment{Id: c.Id, PostId: c.PostId, Comment: c.Body, Author: c.Author, CreationDate: c.Created, ParentId: c.ParentId}
+}
+
+// Ack acknowledges a successful command.
+type Ack struct {
+	Message string `json:"message" xml:"message"`
+	Status  int    `json:"status" xml:"status"`
+}
+
+// Problem is an RFC 9457 problem details object, the format of every v2 error response.
+type Problem struct {
+	XMLName xml.Name `json:"-" xml:"urn:ietf:rfc:7807 problem"`
+	Type    string   `json:"type" xml:"type"`
+	Title   string   `json:"title" xml:"title"`
+	Status  int      `json:"status" xml:"status"`
+	Detail  string   `json:"detail" xml:"detail"`
+}
+
+func NewProblem(status int, detail string) Problem {
+	return Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// ImportReport is the response of POST /api/admin/import.
+type ImportReport struct {
+	DryRun   bool          `json:"dryRun" xml:"dryRun"`
+	Posts    ImportCounts  `json:"posts" xml:"posts"`
+	Comments ImportCounts  `json:"comments" xml:"comments"`
+	Errors   []ImportError `json:"errors" xml:"errors>error"`
+	Aborted  bool          `json:"aborted" xml:"aborted"`
+}
+
+type ImportCounts struct {
+	Created     int `json:"created" xml:"created"`
+	Overwritten int `json:"overwritten" xml:"overwritten"`
+	Skipped     int `json:"skipped" xml:"skipped"`
+}
+
+// ImportError reports a line that was not imported, with the status and detail of the problem.
+type ImportError struct {
+	Line   int    `json:"line" xml:"line"`
+	Status int    `json:"status" xml:"status"`
+	Detail string `json:"detail" xml:"detail"`
+}
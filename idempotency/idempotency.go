@@ -0,0 +1,94 @@
+// Package idempotency stores responses to requests sent with an Idempotency-Key header so that
+// retries of the same request can be answered without executing it again.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Record is a stored response together with the fingerprint of the request that produced it.
+type Record struct {
+	Fingerprint string
+	Status      int
+	Header      http.Header
+	Body        []byte
+}
+
+var ErrInFlight = errors.New("a request with this idempotency key is still in progress")
+
+// Store keeps records until their TTL expires. Implementations shared between instances must make
+// Reserve atomic per key.
+type Store interface {
+	// Reserve claims key for a new request. It returns the stored record when the key has been used
+	// before, and ErrInFlight when the request holding the key has not completed yet.
+	Reserve(ctx context.Context, key string, ttl time.Duration) (*Record, error)
+	// Save stores the response for a key claimed with Reserve.
+	Save(ctx context.Context, key string, record Record, ttl time.Duration) error
+	// Release gives up a key claimed with Reserve without storing a response, so it can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+type entry struct {
+	record  *Record
+	expires time.Time
+}
+
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+const sweepInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]entry), now: time.Now}
+}
+
+func (s *MemoryStore) Reserve(_ context.Context, key string, ttl time.Duration) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.sweep(now)
+	}
+
+	if e, ok := s.entries[key]; ok && !now.After(e.expires) {
+		if e.record == nil {
+			return nil, ErrInFlight
+		}
+		return e.record, nil
+	}
+	s.entries[key] = entry{expires: now.Add(ttl)}
+	return nil, nil
+}
+
+// sweep drops the entries that have expired. Until then, Reserve ignores them.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func (s *MemoryStore) Save(_ context.Context, key string, record Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = entry{record: &record, expires: s.now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
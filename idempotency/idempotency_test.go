@@ -0,0 +1,61 @@
+package idempotency
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Unix(10000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	record, err := store.Reserve(ctx, "key", time.Hour)
+	assert.Nil(t, record)
+	assert.NoError(t, err)
+
+	_, err = store.Reserve(ctx, "key", time.Hour)
+	assert.ErrorIs(t, err, ErrInFlight)
+
+	saved := Record{Fingerprint: "abc", Status: 200, Body: []byte("{}")}
+	store.Save(ctx, "key", saved, time.Hour)
+	record, err = store.Reserve(ctx, "key", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, &saved, record)
+
+	now = now.Add(2 * time.Hour)
+	record, err = store.Reserve(ctx, "key", time.Hour)
+	assert.Nil(t, record)
+	assert.NoError(t, err)
+}
+
+func TestMemoryStoreSweepsExpiredEntries(t *testing.T) {
+	now := time.Unix(10000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	store.Reserve(ctx, "short", time.Second)
+	now = now.Add(2 * time.Second)
+	store.Reserve(ctx, "other", time.Hour)
+	assert.Len(t, store.entries, 2)
+
+	now = now.Add(sweepInterval)
+	store.Reserve(ctx, "another", time.Hour)
+	assert.Len(t, store.entries, 2)
+	assert.NotContains(t, store.entries, "short")
+}
+
+func TestReleasedKeyCanBeReserved(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	store.Reserve(ctx, "key", time.Hour)
+	store.Release(ctx, "key")
+	record, err := store.Reserve(ctx, "key", time.Hour)
+	assert.Nil(t, record)
+	assert.NoError(t, err)
+}
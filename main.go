@@ -1,13 +1,22 @@
 package main
 
 import (
+	"flag"
 	"gitlab.com/devskiller-tasks/rest-api-blog-golang/bootstrap"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/config"
 	"log"
 )
 
 func main() {
 	defaultPort := 8080
-	if err := bootstrap.Init(defaultPort); err != nil {
+	configPath := flag.String("config", "", "path to a JSON configuration file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Service will be shutdown because error ocurred:  %+v", err.Error())
+	}
+	if err := bootstrap.Init(defaultPort, cfg); err != nil {
 		log.Fatalf("Service will be shutdown because error ocurred:  %+v", err.Error())
 	}
 }
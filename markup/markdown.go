@@ -0,0 +1,60 @@
+package markup
+
+import (
+	"bytes"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// postMarkdown renders CommonMark with the GFM extensions, see https://github.github.com/gfm. Table
+// cells are aligned with the align attribute, which the sanitizer keeps unlike styles, and the HTML of
+// documents is passed through, to be sanitized with the rest.
+var postMarkdown = goldmark.New(
+	goldmark.WithExtensions(
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		extension.Strikethrough,
+		extension.Linkify,
+		extension.TaskList,
+	),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+// commentMarkdown renders CommonMark with GFM strikethrough, and without HTML blocks and inline HTML,
+// so that the HTML of comments renders as its text.
+var commentMarkdown = goldmark.New(
+	goldmark.WithExtensions(extension.Strikethrough),
+	goldmark.WithParser(parser.NewParser(
+		parser.WithBlockParsers(
+			util.Prioritized(parser.NewSetextHeadingParser(), 100),
+			util.Prioritized(parser.NewThematicBreakParser(), 200),
+			util.Prioritized(parser.NewListParser(), 300),
+			util.Prioritized(parser.NewListItemParser(), 400),
+			util.Prioritized(parser.NewCodeBlockParser(), 500),
+			util.Prioritized(parser.NewATXHeadingParser(), 600),
+			util.Prioritized(parser.NewFencedCodeBlockParser(), 700),
+			util.Prioritized(parser.NewBlockquoteParser(), 800),
+			util.Prioritized(parser.NewParagraphParser(), 1000),
+		),
+		parser.WithInlineParsers(
+			util.Prioritized(parser.NewCodeSpanParser(), 100),
+			util.Prioritized(parser.NewLinkParser(), 200),
+			util.Prioritized(parser.NewAutoLinkParser(), 300),
+			util.Prioritized(parser.NewEmphasisParser(), 500),
+		),
+		parser.WithParagraphTransformers(parser.DefaultParagraphTransformers()...),
+	)),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+// renderMarkdown renders a Markdown document to HTML, which still needs sanitizing.
+func renderMarkdown(markdown goldmark.Markdown, source string) string {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		// Rendering to a buffer does not fail.
+		panic(err)
+	}
+	return buf.String()
+}
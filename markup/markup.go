@@ -0,0 +1,101 @@
+// Package markup renders the content of posts to HTML, in the format the content is written in, and
+// sanitizes the result so that it is safe to embed in a page.
+package markup
+
+import (
+	"container/list"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"html"
+	"strings"
+	"sync"
+)
+
+// Render renders content written in a format to sanitized HTML. Plain text keeps its paragraphs and
+// line breaks, Markdown is rendered as GitHub Flavored Markdown, and HTML is only sanitized.
+func Render(format model.ContentFormat, content string) string {
+	switch format {
+	case model.Markdown:
+		return Sanitize(renderMarkdown(postMarkdown, content))
+	case model.Html:
+		return Sanitize(content)
+	}
+	var sb strings.Builder
+	content = strings.ReplaceAll(strings.ReplaceAll(content, "\r\n", "\n"), "\r", "\n")
+	for _, paragraph := range strings.Split(content, "\n\n") {
+		if paragraph = strings.Trim(paragraph, "\n"); paragraph != "" {
+			sb.WriteString("<p>" + strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>\n") + "</p>\n")
+		}
+	}
+	return sb.String()
+}
+
+// RenderComment renders the Markdown of a comment to sanitized HTML. Comments are limited to
+// paragraphs, emphasis, strikethrough, code, links, quotes and lists: other Markdown renders as its
+// text, and HTML is escaped. Links get rel="nofollow ugc noopener".
+func RenderComment(comment string) string {
+	return commentPolicy.sanitize(renderMarkdown(commentMarkdown, comment))
+}
+
+type cacheEntry struct {
+	id      uint64
+	version uint64
+	html    string
+}
+
+// Cache keeps the renderings of the most recently rendered posts, for as long as their version is
+// current. It implements repository.PostListener to drop the renderings of changed posts.
+type Cache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[uint64]*list.Element
+	// recent lists the entries, most recently used first.
+	recent *list.List
+}
+
+func NewCache(capacity int) *Cache {
+	return &Cache{capacity: capacity, entries: make(map[uint64]*list.Element), recent: list.New()}
+}
+
+// Render returns the rendering of the content of a post, from the cache when the post has not changed
+// since it was last rendered.
+func (c *Cache) Render(post model.Post) string {
+	c.mu.Lock()
+	if element, ok := c.entries[post.Id]; ok && element.Value.(*cacheEntry).version == post.Version {
+		c.recent.MoveToFront(element)
+		c.mu.Unlock()
+		return element.Value.(*cacheEntry).html
+	}
+	c.mu.Unlock()
+
+	rendered := Render(post.ContentFormat, post.Content)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evict(post.Id)
+	if c.capacity > 0 {
+		c.entries[post.Id] = c.recent.PushFront(&cacheEntry{id: post.Id, version: post.Version, html: rendered})
+		for c.recent.Len() > c.capacity {
+			c.evict(c.recent.Back().Value.(*cacheEntry).id)
+		}
+	}
+	return rendered
+}
+
+func (c *Cache) PostStored(post model.Post) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evict(post.Id)
+}
+
+func (c *Cache) PostDeleted(id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evict(id)
+}
+
+func (c *Cache) evict(id uint64) {
+	if element, ok := c.entries[id]; ok {
+		c.recent.Remove(element)
+		delete(c.entries, id)
+	}
+}
@@ -0,0 +1,239 @@
+package markup
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		testName     string
+		markdown     string
+		expectedHtml string
+	}{
+		{
+			testName:     "testParagraphs",
+			markdown:     "Hello *world*, this is **bold**\nand ~~gone~~ `code <b>`.\n\nSecond  \nline\\\nthird",
+			expectedHtml: "<p>Hello <em>world</em>, this is <strong>bold</strong>\nand <del>gone</del> <code>code &lt;b&gt;</code>.</p>\n<p>Second<br>\nline<br>\nthird</p>\n",
+		},
+		{
+			testName:     "testHeadings",
+			markdown:     "# Title #\nSub\n---\n\n### Third",
+			expectedHtml: "<h1>Title</h1>\n<h2>Sub</h2>\n<h3>Third</h3>\n",
+		},
+		{
+			testName:     "testLinksAndImages",
+			markdown:     `[a *link*](https://example.com "Title") ![alt *text*](/img.png) <https://go.dev> [not a link]`,
+			expectedHtml: `<p><a href="https://example.com" title="Title">a <em>link</em></a> <img src="/img.png" alt="alt text"> <a href="https://go.dev">https://go.dev</a> [not a link]</p>` + "\n",
+		},
+		{
+			testName:     "testFencedCode",
+			markdown:     "```go\nfunc main() {\n\tfmt.Println(\"<hi>\")\n}\n```\n\n~~~\nplain\n~~~",
+			expectedHtml: "<pre><code class=\"language-go\">func main() {\n\tfmt.Println(&#34;&lt;hi&gt;&#34;)\n}\n</code></pre>\n<pre><code>plain\n</code></pre>\n",
+		},
+		{
+			testName:     "testIndentedCode",
+			markdown:     "Code:\n\n    x := 1\n    y := 2",
+			expectedHtml: "<p>Code:</p>\n<pre><code>x := 1\ny := 2\n</code></pre>\n",
+		},
+		{
+			testName:     "testLists",
+			markdown:     "- one\n- two\n  - nested\n\n3. three\n4. four",
+			expectedHtml: "<ul>\n<li>one</li>\n<li>two\n<ul>\n<li>nested</li>\n</ul>\n</li>\n</ul>\n<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>\n",
+		},
+		{
+			testName:     "testLooseList",
+			markdown:     "* one\n\n* two",
+			expectedHtml: "<ul>\n<li>\n<p>one</p>\n</li>\n<li>\n<p>two</p>\n</li>\n</ul>\n",
+		},
+		{
+			testName:     "testBlockquote",
+			markdown:     "> quoted\nlazy\n> > nested",
+			expectedHtml: "<blockquote>\n<p>quoted\nlazy</p>\n<blockquote>\n<p>nested</p>\n</blockquote>\n</blockquote>\n",
+		},
+		{
+			testName:     "testThematicBreak",
+			markdown:     "above\n\n***\n\nbelow",
+			expectedHtml: "<p>above</p>\n<hr>\n<p>below</p>\n",
+		},
+		{
+			testName: "testTable",
+			markdown: "| Name | Size |   |\n|:-----|-----:|:-:|\n| a \\| b | `1` | x |\n| c |",
+			expectedHtml: "<table>\n<thead>\n<tr>\n<th align=\"left\">Name</th>\n<th align=\"right\">Size</th>\n<th align=\"center\"></th>\n</tr>\n</thead>\n" +
+				"<tbody>\n<tr>\n<td align=\"left\">a | b</td>\n<td align=\"right\"><code>1</code></td>\n<td align=\"center\">x</td>\n</tr>\n" +
+				"<tr>\n<td align=\"left\">c</td>\n<td></td>\n<td></td>\n</tr>\n</tbody>\n</table>\n",
+		},
+		{
+			testName:     "testTaskList",
+			markdown:     "- [x] done\n- [ ] todo",
+			expectedHtml: "<ul>\n<li><input checked=\"\" disabled=\"\" type=\"checkbox\"> done</li>\n<li><input disabled=\"\" type=\"checkbox\"> todo</li>\n</ul>\n",
+		},
+		{
+			testName:     "testAutolinkedUrls",
+			markdown:     "Visit www.commonmark.org/help or https://go.dev.",
+			expectedHtml: "<p>Visit <a href=\"http://www.commonmark.org/help\">www.commonmark.org/help</a> or <a href=\"https://go.dev\">https://go.dev</a>.</p>\n",
+		},
+		{
+			testName:     "testUnsafeMarkdown",
+			markdown:     "[x](javascript:alert(1)) <img src=x onerror=alert(1)>\n\n<script>\nalert(1)\n</script>",
+			expectedHtml: "<p><a>x</a> <img src=\"x\"></p>\n",
+		},
+		{
+			testName:     "testEscapes",
+			markdown:     `\*not em\* 1 < 2 & snake_case_word AT&amp;T`,
+			expectedHtml: "<p>*not em* 1 &lt; 2 &amp; snake_case_word AT&amp;T</p>\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expectedHtml, Render(model.Markdown, tc.markdown))
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		testName     string
+		html         string
+		expectedHtml string
+	}{
+		{
+			testName:     "testScript",
+			html:         `<p>hi<script>alert(1)</script></p><SCRIPT src=x></SCRIPT>`,
+			expectedHtml: `<p>hi</p>`,
+		},
+		{
+			testName:     "testEventHandlers",
+			html:         `<img src="/a.png" onerror="alert(1)" alt='x'><p style="color:red" onclick=alert(1)>text</p>`,
+			expectedHtml: `<img src="/a.png" alt="x"><p>text</p>`,
+		},
+		{
+			testName:     "testScriptUrls",
+			html:         `<a href="javascript:alert(1)">a</a><a href=" JaVa&#x09;Script:alert(1)">b</a><a href="java&#10;script:x">c</a><img src="data:image/png;base64,AA">`,
+			expectedHtml: `<a>a</a><a>b</a><a>c</a><img>`,
+		},
+		{
+			testName:     "testSafeUrls",
+			html:         `<a href="https://go.dev/?a=1&amp;b=2">go</a><a href="mailto:me@example.com">me</a><a href="/posts/1#c:2">rel</a>`,
+			expectedHtml: `<a href="https://go.dev/?a=1&amp;b=2">go</a><a href="mailto:me@example.com">me</a><a href="/posts/1#c:2">rel</a>`,
+		},
+		{
+			testName:     "testUnknownElements",
+			html:         `<div><form action="/x"><input value="v">kept</form></div><iframe src="https://evil">gone</iframe><!-- comment -->`,
+			expectedHtml: `kept`,
+		},
+		{
+			testName:     "testUnbalancedTags",
+			html:         `<p><em>open <strong>nested</p></em> text`,
+			expectedHtml: `<p><em>open <strong>nested</strong></em></p> text`,
+		},
+		{
+			testName:     "testAttributeValues",
+			html:         `<code class="evil">x</code><code class="language-go">y</code><td align="justify">z</td><ol start="3x"></ol>`,
+			expectedHtml: `<code>x</code><code class="language-go">y</code><td>z</td><ol></ol>`,
+		},
+		{
+			testName:     "testInputs",
+			html:         `<input type="checkbox" checked name="x"><input type="text" value="v"><input type="image" src="/a.png">`,
+			expectedHtml: `<input type="checkbox" checked="">`,
+		},
+		{
+			testName:     "testBrokenMarkup",
+			html:         `a < b <p title="unterminated`,
+			expectedHtml: `a &lt; b `,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expectedHtml, Sanitize(tc.html))
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	// GIVEN
+	content := "<b>1 < 2</b>\n\n*second*\nline"
+
+	// WHEN
+	plain := Render(model.PlainText, content)
+	markdown := Render(model.Markdown, content)
+	html := Render(model.Html, content)
+
+	// THEN
+	assert.Equal(t, "<p>&lt;b&gt;1 &lt; 2&lt;/b&gt;</p>\n<p>*second*<br>\nline</p>\n", plain)
+	assert.Equal(t, plain, Render("", content))
+	assert.Equal(t, "<p><b>1 &lt; 2</b></p>\n<p><em>second</em>\nline</p>\n", markdown)
+	assert.Equal(t, "<b>1 &lt; 2</b>\n\n*second*\nline", html)
+}
+
+func TestRenderComment(t *testing.T) {
+	tests := []struct {
+		testName     string
+		comment      string
+		expectedHtml string
+	}{
+		{
+			testName:     "testSubset",
+			comment:      "**Nice**, see [the docs](https://go.dev/doc \"Docs\") and `go vet`:\n\n> quoted\n\n- a\n- b",
+			expectedHtml: "<p><strong>Nice</strong>, see <a href=\"https://go.dev/doc\" title=\"Docs\" rel=\"nofollow ugc noopener\">the docs</a> and <code>go vet</code>:</p>\n<blockquote>\n<p>quoted</p>\n</blockquote>\n<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n",
+		},
+		{
+			testName:     "testAutolink",
+			comment:      "<https://example.com>",
+			expectedHtml: "<p><a href=\"https://example.com\" rel=\"nofollow ugc noopener\">https://example.com</a></p>\n",
+		},
+		{
+			testName:     "testHtmlEscaped",
+			comment:      "<script>alert(1)</script> <b onclick=x>bold</b>",
+			expectedHtml: "<p>&lt;script&gt;alert(1)&lt;/script&gt; &lt;b onclick=x&gt;bold&lt;/b&gt;</p>\n",
+		},
+		{
+			testName:     "testOutsideSubset",
+			comment:      "# Title\n\n![logo](https://example.com/logo.png) [x](javascript:alert(1))",
+			expectedHtml: "Title\n<p> <a rel=\"nofollow ugc noopener\">x</a></p>\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expectedHtml, RenderComment(tc.comment))
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	// GIVEN
+	cache := NewCache(2)
+	post := model.Post{Id: 1, Version: 1, Content: "*one*", ContentFormat: model.Markdown}
+
+	// WHEN
+	first := cache.Render(post)
+	post.Content = "*changed without a new version*"
+	cached := cache.Render(post)
+	post.Version = 2
+	updated := cache.Render(post)
+
+	// THEN
+	assert.Equal(t, "<p><em>one</em></p>\n", first)
+	assert.Equal(t, first, cached)
+	assert.Equal(t, "<p><em>changed without a new version</em></p>\n", updated)
+
+	// WHEN
+	cache.Render(model.Post{Id: 2, Version: 1})
+	cache.Render(model.Post{Id: 3, Version: 1})
+
+	// THEN
+	assert.Len(t, cache.entries, 2)
+	assert.NotContains(t, cache.entries, uint64(1))
+
+	// WHEN
+	cache.PostStored(model.Post{Id: 2})
+	cache.PostDeleted(3)
+
+	// THEN
+	assert.Empty(t, cache.entries)
+	assert.Zero(t, cache.recent.Len())
+}
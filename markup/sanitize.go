@@ -0,0 +1,203 @@
+package markup
+
+import (
+	"golang.org/x/net/html"
+	"regexp"
+	"strings"
+)
+
+// policy lists the elements a sanitizer keeps and the attributes it keeps on each. Other elements
+// are dropped with their tags, keeping their text.
+type policy struct {
+	elements map[string][]string
+	// linkRel, when set, is the rel attribute of every link.
+	linkRel string
+}
+
+// postPolicy keeps the elements of Markdown documents and a few more common inline ones.
+var postPolicy = policy{elements: map[string][]string{
+	"a": {"href", "title"}, "abbr": {"title"}, "b": nil, "blockquote": nil, "br": nil, "code": {"class"},
+	"del": nil, "em": nil, "h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil, "hr": nil,
+	"i": nil, "img": {"src", "alt", "title"}, "input": {"type", "checked", "disabled"}, "kbd": nil, "li": nil, "ol": {"start"}, "p": nil, "pre": nil,
+	"s": nil, "strong": nil, "sub": nil, "sup": nil, "table": nil, "tbody": nil, "td": {"align"},
+	"th": {"align"}, "thead": nil, "tr": nil, "ul": nil,
+}}
+
+// commentPolicy keeps the elements of the Markdown subset of comments. Links in comments are user
+// generated content, and search engines should not credit their targets, see
+// https://developers.google.com/search/docs/crawling-indexing/qualify-outbound-links.
+var commentPolicy = policy{elements: map[string][]string{
+	"a": {"href", "title"}, "blockquote": nil, "br": nil, "code": {"class"}, "del": nil, "em": nil, "li": nil,
+	"ol": {"start"}, "p": nil, "pre": nil, "strong": nil, "ul": nil,
+}, linkRel: "nofollow ugc noopener"}
+
+// voidElements have no content and no end tag.
+var voidElements = map[string]bool{"br": true, "hr": true, "img": true, "input": true}
+
+// droppedElements are dropped with their content.
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true, "noscript": true,
+	"noembed": true, "noframes": true, "textarea": true, "title": true, "xmp": true, "template": true,
+	"svg": true, "math": true,
+}
+
+var (
+	languagePattern = regexp.MustCompile(`^language-[a-zA-Z0-9_+#.-]+$`)
+	alignPattern    = regexp.MustCompile(`^(left|center|right)$`)
+	numberPattern   = regexp.MustCompile(`^[0-9]{1,9}$`)
+)
+
+// Sanitize keeps the elements and attributes of an HTML fragment that cannot run scripts or change
+// the page around it, and balances their tags. Links and images may only point at http, https and
+// relative URLs, links at mailto URLs as well.
+func Sanitize(fragment string) string {
+	return postPolicy.sanitize(fragment)
+}
+
+func (p policy) sanitize(fragment string) string {
+	var sb strings.Builder
+	var open []string
+	// dropped is the element being dropped with its content, nested counts its nested namesakes.
+	dropped, nested := "", 0
+	tokenizer := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			return closeAll(&sb, open)
+		}
+		token := tokenizer.Token()
+		name, closing := token.Data, tokenType == html.EndTagToken
+
+		if dropped != "" {
+			switch {
+			case tokenType == html.StartTagToken && name == dropped:
+				nested++
+			case closing && name == dropped && nested > 0:
+				nested--
+			case closing && name == dropped:
+				dropped = ""
+			}
+			continue
+		}
+
+		switch {
+		case tokenType == html.TextToken:
+			sb.WriteString(html.EscapeString(token.Data))
+		case tokenType == html.CommentToken || tokenType == html.DoctypeToken:
+			// Comments and doctypes are dropped.
+		case droppedElements[name] && tokenType == html.StartTagToken:
+			dropped = name
+		case droppedElements[name] || !p.allows(name) || name == "input" && !isCheckbox(token.Attr):
+			// The tag is dropped, its content kept.
+		case closing:
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == name {
+					for _, element := range reversed(open[i:]) {
+						sb.WriteString("</" + element + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
+		default:
+			sb.WriteString("<" + name)
+			p.writeAttributes(&sb, name, token.Attr)
+			if name == "a" && p.linkRel != "" {
+				sb.WriteString(` rel="` + p.linkRel + `"`)
+			}
+			sb.WriteString(">")
+			if !voidElements[name] {
+				open = append(open, name)
+			}
+		}
+	}
+}
+
+// isCheckbox reports whether the attributes of an input make it a checkbox, the only inputs kept,
+// for the task lists of Markdown.
+func isCheckbox(attributes []html.Attribute) bool {
+	for _, attribute := range attributes {
+		if attribute.Key == "type" {
+			return attribute.Val == "checkbox"
+		}
+	}
+	return false
+}
+
+func (p policy) allows(name string) bool {
+	_, ok := p.elements[name]
+	return ok
+}
+
+func (p policy) writeAttributes(sb *strings.Builder, element string, attributes []html.Attribute) {
+	seen := make(map[string]bool)
+	for _, attribute := range attributes {
+		name := attribute.Key
+		if attribute.Namespace != "" || seen[name] || !contains(p.elements[element], name) {
+			continue
+		}
+		seen[name] = true
+		if !allowedValue(element, name, attribute.Val) {
+			continue
+		}
+		sb.WriteString(" " + name + `="` + html.EscapeString(attribute.Val) + `"`)
+	}
+}
+
+func allowedValue(element string, attribute string, value string) bool {
+	switch attribute {
+	case "href":
+		return safeUrl(value, "http", "https", "mailto")
+	case "src":
+		return safeUrl(value, "http", "https")
+	case "class":
+		return languagePattern.MatchString(value)
+	case "align":
+		return alignPattern.MatchString(value)
+	case "start":
+		return numberPattern.MatchString(value)
+	case "type":
+		return value == "checkbox"
+	}
+	return true
+}
+
+// safeUrl reports whether a URL is relative or has one of the schemes given. Browsers ignore tabs and
+// newlines in URLs, so they cannot hide a scheme.
+func safeUrl(url string, schemes ...string) bool {
+	url = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(url))
+	colon := strings.IndexByte(url, ':')
+	if colon < 0 || strings.ContainsAny(url[:colon], "/?#") {
+		return true
+	}
+	return contains(schemes, strings.ToLower(url[:colon]))
+}
+
+func closeAll(sb *strings.Builder, open []string) string {
+	for _, element := range reversed(open) {
+		sb.WriteString("</" + element + ">")
+	}
+	return sb.String()
+}
+
+func reversed(elements []string) []string {
+	result := make([]string, len(elements))
+	for i, element := range elements {
+		result[len(elements)-1-i] = element
+	}
+	return result
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -8,11 +8,114 @@ type Comment struct {
 	Comment      string
 	Author       string
 	CreationDate time.Time
+	Hidden       bool
+	Version      uint64
+	// ParentId is the comment this one replies to, 0 for top-level comments.
+	ParentId uint64 `json:",omitempty"`
+	// CommentHtml is the sanitized rendering of the comment, filled in on request and never stored.
+	CommentHtml string `json:"-"`
+}
+
+// CommentNode is a comment with its replies, oldest first.
+type CommentNode struct {
+	Comment
+	Replies []CommentNode
 }
 
 type Post struct {
-	Id           uint64
-	Title        string
-	Content      string
-	CreationDate time.Time
+	Id               uint64
+	Title            string
+	Content          string
+	Author           string
+	CreationDate     time.Time
+	ModificationDate time.Time
+	Version          uint64
+	// Slug is unique among posts, generated from the title, see slug.Make.
+	Slug string `json:",omitempty"`
+	// Tags are normalized to lower case, without duplicates. Posts without tags or a category are
+	// serialized as before they had any.
+	Tags     []string   `json:",omitempty"`
+	Category string     `json:",omitempty"`
+	Status   PostStatus `json:",omitempty"`
+	// PublishAt is when a scheduled post gets published.
+	PublishAt *time.Time `json:",omitempty"`
+	// ContentFormat is the format the content is written in, plain text when empty.
+	ContentFormat ContentFormat `json:",omitempty"`
+	// ContentHtml is the sanitized rendering of the content, filled in on request and never stored.
+	ContentHtml string `json:"-"`
+}
+
+// Revision is a post as it was after being created, updated or restored. Revisions are immutable and
+// numbered from 1 for each post.
+type Revision struct {
+	PostId uint64
+	Number uint64
+	// Version is the version of the post the revision was made at.
+	Version       uint64
+	Title         string
+	Content       string
+	ContentFormat ContentFormat `json:",omitempty"`
+	Editor        string
+	Date          time.Time
+	// RestoredFrom is the revision restored by this one, 0 for edits.
+	RestoredFrom uint64 `json:",omitempty"`
+}
+
+// RevisionDiff is the line by line difference between two revisions of a post.
+type RevisionDiff struct {
+	PostId  uint64
+	From    uint64
+	To      uint64
+	Title   []DiffLine
+	Content []DiffLine
+}
+
+// DiffLine is a line kept, deleted or inserted on the way from one text to another.
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+type DiffOp string
+
+const (
+	DiffEqual  DiffOp = "equal"
+	DiffDelete DiffOp = "delete"
+	DiffInsert DiffOp = "insert"
+)
+
+// ContentFormat is the markup language of the content of a post.
+type ContentFormat string
+
+const (
+	PlainText ContentFormat = "plain"
+	Markdown  ContentFormat = "markdown"
+	Html      ContentFormat = "html"
+)
+
+// Valid reports whether the format is known. The empty format is plain text.
+func (f ContentFormat) Valid() bool {
+	return f == "" || f == PlainText || f == Markdown || f == Html
+}
+
+// PostStatus is the stage of a post in the publishing workflow. Posts stored before the workflow
+// existed have no status and are published.
+type PostStatus string
+
+const (
+	Draft     PostStatus = "draft"
+	Scheduled PostStatus = "scheduled"
+	Published PostStatus = "published"
+	Archived  PostStatus = "archived"
+)
+
+// Public reports whether posts at the status may be read by anyone.
+func (s PostStatus) Public() bool {
+	return s == "" || s == Published || s == Archived
+}
+
+// Tag is a tag along with the number of posts tagged with it.
+type Tag struct {
+	Name  string
+	Posts int
 }
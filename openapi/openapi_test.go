@@ -0,0 +1,202 @@
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testAuthor struct {
+	Name string
+}
+
+type testPost struct {
+	Id       uint64     `json:"id"`
+	Title    string     `json:"title"`
+	Score    float64    `json:"score,omitempty"`
+	Created  time.Time  `json:"createdAt"`
+	Modified *time.Time `json:"modifiedAt,omitempty"`
+	Tags     []string   `json:"tags"`
+	Author   testAuthor `json:"author"`
+	Ignored  string     `json:"-"`
+	internal string
+}
+
+func TestSchemaOf(t *testing.T) {
+	minimum := 0.0
+	expected := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":         {Type: "integer", Format: "int64", Minimum: &minimum},
+			"title":      {Type: "string"},
+			"score":      {Type: "number"},
+			"createdAt":  {Type: "string", Format: "date-time"},
+			"modifiedAt": {Type: "string", Format: "date-time"},
+			"tags":       {Type: "array", Items: &Schema{Type: "string"}},
+			"author": {
+				Type:       "object",
+				Properties: map[string]*Schema{"Name": {Type: "string"}},
+				Required:   []string{"Name"},
+			},
+		},
+		Required: []string{"id", "title", "createdAt", "tags", "author"},
+	}
+
+	assert.Equal(t, expected, SchemaOf(reflect.TypeOf(&testPost{})))
+}
+
+func TestAddSchema(t *testing.T) {
+	var components Components
+
+	ref := components.AddSchema("Author", testAuthor{})
+
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/Author"}, ref)
+	assert.Equal(t, SchemaOf(reflect.TypeOf(testAuthor{})), components.Schemas["Author"])
+	assert.Equal(t, &Schema{Type: "array", Items: ref}, ArrayOf(ref))
+}
+
+type testNode struct {
+	testAuthor
+	Id       uint64      `json:"id"`
+	Children []*testNode `json:"children,omitempty"`
+}
+
+func TestAddRecursiveSchema(t *testing.T) {
+	var components Components
+	minimum := 0.0
+
+	ref := components.AddSchema("Node", testNode{})
+
+	// Embedded fields are promoted, and the type refers to itself.
+	assert.Equal(t, &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"Name":     {Type: "string"},
+			"id":       {Type: "integer", Format: "int64", Minimum: &minimum},
+			"children": {Type: "array", Items: ref},
+		},
+		Required: []string{"Name", "id"},
+	}, components.Schemas["Node"])
+	assert.EqualError(t, components.Validate(ref, map[string]interface{}{
+		"Name": "root", "id": json.Number("1"), "children": []interface{}{map[string]interface{}{"Name": "leaf"}},
+	}), "/children/0: missing required property id")
+}
+
+func TestValidate(t *testing.T) {
+	var components Components
+	ref := components.AddSchema("Post", testPost{})
+	tests := []struct {
+		testName      string
+		value         string
+		expectedError string
+	}{
+		{
+			testName: "testValid",
+			value:    `{"id": 1, "title": "t", "createdAt": "2018-09-16T12:00:00Z", "tags": ["a"], "author": {"Name": "n"}, "extra": null}`,
+		},
+		{
+			testName:      "testNotAnObject",
+			value:         `[]`,
+			expectedError: "expected object, got array",
+		},
+		{
+			testName:      "testMissingProperty",
+			value:         `{"id": 1, "title": "t", "createdAt": "2018-09-16T12:00:00Z", "tags": []}`,
+			expectedError: "missing required property author",
+		},
+		{
+			testName:      "testNotAnInteger",
+			value:         `{"id": 1.5, "title": "t", "createdAt": "2018-09-16T12:00:00Z", "tags": [], "author": {"Name": "n"}}`,
+			expectedError: "/id: expected integer",
+		},
+		{
+			testName:      "testNestedArray",
+			value:         `{"id": 1, "title": "t", "createdAt": "2018-09-16T12:00:00Z", "tags": ["a", 2], "author": {"Name": "n"}}`,
+			expectedError: "/tags/1: expected string, got number",
+		},
+		{
+			testName:      "testNested",
+			value:         `{"id": 1, "title": "t", "createdAt": "2018-09-16T12:00:00Z", "tags": [], "author": {"Name": null}}`,
+			expectedError: "/author/Name: expected string, got null",
+		},
+		{
+			testName:      "testDateTime",
+			value:         `{"id": 1, "title": "t", "createdAt": "2018-09-16", "tags": [], "author": {"Name": "n"}}`,
+			expectedError: "/createdAt: expected an RFC 3339 date-time",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			decoder := json.NewDecoder(strings.NewReader(tc.value))
+			decoder.UseNumber()
+			var value interface{}
+			assert.NoError(t, decoder.Decode(&value))
+
+			// WHEN
+			err := components.Validate(ref, value)
+
+			// THEN
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestValidateMaxItems(t *testing.T) {
+	// GIVEN
+	var components Components
+	maxItems := 2
+	schema := &Schema{Type: "array", Items: &Schema{Type: "boolean"}, MaxItems: &maxItems}
+
+	// WHEN
+	valid := components.Validate(schema, []interface{}{true, false})
+	invalid := components.Validate(schema, []interface{}{true, false, true})
+
+	// THEN
+	assert.NoError(t, valid)
+	assert.EqualError(t, invalid, "expected at most 2 items")
+}
+
+func TestValidateAnyOf(t *testing.T) {
+	// GIVEN
+	var components Components
+	schema := &Schema{AnyOf: []*Schema{{Type: "boolean"}, ArrayOf(&Schema{Type: "boolean"})}}
+
+	// WHEN
+	single := components.Validate(schema, true)
+	list := components.Validate(schema, []interface{}{true})
+	invalid := components.Validate(schema, "true")
+
+	// THEN
+	assert.NoError(t, single)
+	assert.NoError(t, list)
+	assert.EqualError(t, invalid, "expected boolean, got string")
+}
+
+func TestValidateParameter(t *testing.T) {
+	var components Components
+	id := Parameter{Name: "id", In: "path", Schema: SchemaOf(reflect.TypeOf(uint64(0)))}
+	minLength := 3
+	query := Parameter{Name: "q", In: "query", Schema: &Schema{Type: "string", MinLength: &minLength}}
+
+	assert.NoError(t, components.ValidateParameter(id, "42"))
+	assert.EqualError(t, components.ValidateParameter(id, "-1"), "expected a value of at least 0")
+	assert.EqualError(t, components.ValidateParameter(id, "x"), "expected integer")
+	assert.NoError(t, components.ValidateParameter(query, "abc"))
+	assert.EqualError(t, components.ValidateParameter(query, "ab"), "expected at least 3 characters")
+
+	enum := Parameter{Name: "mode", In: "query", Schema: &Schema{Type: "string", Enum: []string{"a", "b"}}}
+	assert.NoError(t, components.ValidateParameter(enum, "b"))
+	assert.EqualError(t, components.ValidateParameter(enum, "c"), "expected one of a, b")
+	flag := Parameter{Name: "flag", In: "query", Schema: &Schema{Type: "boolean"}}
+	assert.NoError(t, components.ValidateParameter(flag, "true"))
+	assert.EqualError(t, components.ValidateParameter(flag, "yes"), "expected boolean")
+}
@@ -0,0 +1,192 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ValidationError reports the first part of a value that does not conform to its schema. Pointer is
+// the JSON pointer of that part, empty for the value itself.
+type ValidationError struct {
+	Pointer string
+	Reason  string
+}
+
+func (e ValidationError) Error() string {
+	if e.Pointer == "" {
+		return e.Reason
+	}
+	return e.Pointer + ": " + e.Reason
+}
+
+// Validate checks a value decoded from JSON, with numbers decoded as json.Number, against schema.
+// References are resolved against the component schemas.
+func (c *Components) Validate(schema *Schema, value interface{}) error {
+	return c.validate(schema, value, "")
+}
+
+// ValidateParameter checks the raw value of a path, query or header parameter against its schema.
+func (c *Components) ValidateParameter(parameter Parameter, raw string) error {
+	schema := c.resolve(parameter.Schema)
+	var value interface{} = raw
+	switch schema.Type {
+	case "integer", "number":
+		value = json.Number(raw)
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return ValidationError{Reason: "expected boolean"}
+		}
+		value = b
+	}
+	return c.validate(schema, value, "")
+}
+
+func (c *Components) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = c.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	if schema == nil {
+		return &Schema{}
+	}
+	return schema
+}
+
+func (c *Components) validate(schema *Schema, value interface{}, pointer string) error {
+	schema = c.resolve(schema)
+	fail := func(format string, args ...interface{}) error {
+		return ValidationError{Pointer: pointer, Reason: fmt.Sprintf(format, args...)}
+	}
+	if len(schema.AnyOf) > 0 {
+		// The error of the first alternative is reported when the value matches none of them.
+		var first error
+		for _, alternative := range schema.AnyOf {
+			err := c.validate(alternative, value, pointer)
+			if err == nil {
+				return nil
+			}
+			if first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+
+	switch schema.Type {
+	case "":
+		return nil
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fail("expected object, got %s", typeOf(value))
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				return fail("missing required property %s", name)
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := schema.Properties[name]; ok {
+				if err := c.validate(property, object[name], pointer+"/"+escapePointer(name)); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return fail("expected array, got %s", typeOf(value))
+		}
+		if schema.MaxItems != nil && len(array) > *schema.MaxItems {
+			return fail("expected at most %d items", *schema.MaxItems)
+		}
+		for i, item := range array {
+			if err := c.validate(schema.Items, item, pointer+"/"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fail("expected string, got %s", typeOf(value))
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return fail("expected an RFC 3339 date-time")
+			}
+		}
+		if len(schema.Enum) > 0 && !contains(schema.Enum, s) {
+			return fail("expected one of %s", strings.Join(schema.Enum, ", "))
+		}
+		if length := utf8.RuneCountInString(s); schema.MinLength != nil && length < *schema.MinLength {
+			return fail("expected at least %d characters", *schema.MinLength)
+		} else if schema.MaxLength != nil && length > *schema.MaxLength {
+			return fail("expected at most %d characters", *schema.MaxLength)
+		}
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			return fail("expected %s, got %s", schema.Type, typeOf(value))
+		}
+		f, err := number.Float64()
+		if err != nil {
+			return fail("expected %s", schema.Type)
+		}
+		if schema.Type == "integer" {
+			if _, err := strconv.ParseInt(number.String(), 10, 64); err != nil {
+				if _, err := strconv.ParseUint(number.String(), 10, 64); err != nil {
+					return fail("expected integer")
+				}
+			}
+		}
+		if schema.Minimum != nil && f < *schema.Minimum {
+			return fail("expected a value of at least %v", *schema.Minimum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fail("expected boolean, got %s", typeOf(value))
+		}
+	}
+	return nil
+}
+
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number, float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
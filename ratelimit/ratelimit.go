@@ -0,0 +1,148 @@
+// Package ratelimit implements token-bucket rate limiting with per-route budgets and pluggable state.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests requests every Per on average, with bursts of up to Burst requests.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// rate returns the number of tokens added to the bucket per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is the time until the bucket is full again.
+	ResetAfter time.Duration
+	// RetryAfter is the time until the next request would be allowed; zero when Allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the token buckets. Implementations shared between instances must make Take atomic per key.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket will have refilled completely; past that point it can be forgotten.
+	full time.Time
+}
+
+// MemoryStore keeps buckets in process memory. Buckets that have refilled completely are dropped
+// periodically, so memory is bounded by the number of recently active clients.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+const sweepInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.sweep(now)
+	}
+
+	capacity, rate := limit.capacity(), limit.rate()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	result := Result{Limit: int(capacity)}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.ResetAfter = seconds((capacity - b.tokens) / rate)
+	b.full = now.Add(result.ResetAfter)
+	return result, nil
+}
+
+// sweep drops buckets that have refilled completely; they are indistinguishable from new ones.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+type InvalidLimitError struct {
+	route string
+}
+
+func (e InvalidLimitError) Error() string {
+	return "Invalid rate limit for route: " + e.route
+}
+
+// Limiter applies a separate budget to every route, keyed by the route pattern it was registered
+// with (e.g. "POST /api/comments"). Routes without a limit are not throttled.
+type Limiter struct {
+	store  Store
+	limits map[string]Limit
+}
+
+func NewLimiter(store Store, limits map[string]Limit) (*Limiter, error) {
+	for route, limit := range limits {
+		if limit.Requests <= 0 || limit.Per <= 0 || limit.Burst < 0 {
+			return nil, InvalidLimitError{route: route}
+		}
+	}
+	return &Limiter{store: store, limits: limits}, nil
+}
+
+func (l *Limiter) Limited(route string) bool {
+	_, ok := l.limits[route]
+	return ok
+}
+
+// Take consumes a token from the bucket of client on route.
+func (l *Limiter) Take(ctx context.Context, route, client string) (Result, error) {
+	limit, ok := l.limits[route]
+	if !ok {
+		return Result{Allowed: true}, nil
+	}
+	return l.store.Take(ctx, route+" "+client, limit)
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newTestStore(now *time.Time) *MemoryStore {
+	s := NewMemoryStore()
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(10000, 0)
+	store := newTestStore(&now)
+	limit := Limit{Requests: 1, Per: 10 * time.Second, Burst: 2}
+
+	first, _ := store.Take(context.Background(), "client", limit)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, ResetAfter: 10 * time.Second}, first)
+
+	second, _ := store.Take(context.Background(), "client", limit)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 0, ResetAfter: 20 * time.Second}, second)
+
+	third, _ := store.Take(context.Background(), "client", limit)
+	assert.False(t, third.Allowed)
+	assert.Equal(t, 10*time.Second, third.RetryAfter)
+
+	now = now.Add(10 * time.Second)
+	fourth, _ := store.Take(context.Background(), "client", limit)
+	assert.True(t, fourth.Allowed)
+
+	other, _ := store.Take(context.Background(), "other client", limit)
+	assert.True(t, other.Allowed)
+}
+
+func TestSweepForgetsFullBuckets(t *testing.T) {
+	now := time.Unix(10000, 0)
+	store := newTestStore(&now)
+	limit := Limit{Requests: 1, Per: time.Second}
+
+	store.Take(context.Background(), "a", limit)
+	now = now.Add(time.Hour)
+	store.Take(context.Background(), "b", limit)
+
+	assert.Len(t, store.buckets, 1)
+	assert.Contains(t, store.buckets, "b")
+}
+
+func TestLimiterBudgetsArePerRoute(t *testing.T) {
+	limiter, err := NewLimiter(NewMemoryStore(), map[string]Limit{
+		"POST /api/comments": {Requests: 1, Per: time.Minute},
+	})
+	assert.NoError(t, err)
+
+	result, _ := limiter.Take(context.Background(), "POST /api/comments", "ip:1.2.3.4")
+	assert.True(t, result.Allowed)
+	result, _ = limiter.Take(context.Background(), "POST /api/comments", "ip:1.2.3.4")
+	assert.False(t, result.Allowed)
+	result, _ = limiter.Take(context.Background(), "POST /api/posts", "ip:1.2.3.4")
+	assert.True(t, result.Allowed)
+	assert.False(t, limiter.Limited("POST /api/posts"))
+
+	_, err = NewLimiter(NewMemoryStore(), map[string]Limit{"POST /api/posts": {Requests: 1}})
+	assert.EqualError(t, err, "Invalid rate limit for route: POST /api/posts")
+}
@@ -3,10 +3,31 @@ package repository
 import (
 	"fmt"
 	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"math"
+	"sort"
+	"sync"
+	"time"
 )
 
+// AnyVersion may be passed wherever an expected version is required to skip the version check.
+const AnyVersion uint64 = math.MaxUint64
+
+// zeroValueMu guards repositories that were not created with a constructor.
+var zeroValueMu sync.RWMutex
+
+// CommentListener is told about the comments stored in and deleted from a repository, e.g. to index
+// them. It is called with the repository locked and must not call back into it.
+type CommentListener interface {
+	CommentStored(comment model.Comment)
+	CommentDeleted(id uint64)
+}
+
 type CommentRepository struct {
+	mu         *sync.RWMutex
 	repository []model.Comment
+	// modified records when the set of comments of each post last changed.
+	modified  map[uint64]time.Time
+	listeners []CommentListener
 }
 
 func NewCommentRepository() *CommentRepository {
@@ -15,7 +36,7 @@ func NewCommentRepository() *CommentRepository {
 }
 
 func CustomCommentRepository(mockStorage []model.Comment) CommentRepository {
-	return CommentRepository{repository: mockStorage}
+	return CommentRepository{mu: &sync.RWMutex{}, repository: mockStorage}
 }
 
 type CommentAlreadyExistsError struct {
@@ -34,20 +55,100 @@ func (e CommentNotFoundError) Error() string {
 	return fmt.Sprintf("Comment with id: %v does not exist", e.id)
 }
 
+type CommentVersionMismatchError struct {
+	id      uint64
+	Current uint64
+}
+
+func (e CommentVersionMismatchError) Error() string {
+	return fmt.Sprintf("Comment with id: %v has been modified, current version is %v", e.id, e.Current)
+}
+
+func (c *CommentRepository) lock() *sync.RWMutex {
+	if c.mu == nil {
+		return &zeroValueMu
+	}
+	return c.mu
+}
+
+func (c *CommentRepository) indexOf(id uint64) int {
+	for i := range c.repository {
+		if c.repository[i].Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Listen registers a listener told about every later change of the repository.
+func (c *CommentRepository) Listen(listener CommentListener) {
+	c.lock().Lock()
+	defer c.lock().Unlock()
+	c.listeners = append(c.listeners, listener)
+}
+
+func (c *CommentRepository) stored(comment model.Comment) {
+	for _, listener := range c.listeners {
+		listener.CommentStored(comment)
+	}
+}
+
+func (c *CommentRepository) touch(postId uint64) {
+	if c.modified == nil {
+		c.modified = make(map[uint64]time.Time)
+	}
+	c.modified[postId] = time.Now()
+}
+
+// checkVersion returns the index of the comment with given id, provided its version is the expected one.
+func (c *CommentRepository) checkVersion(id uint64, version uint64) (int, error) {
+	i := c.indexOf(id)
+	if i < 0 {
+		return i, CommentNotFoundError{id}
+	}
+	if version != AnyVersion && c.repository[i].Version != version {
+		return i, CommentVersionMismatchError{id: id, Current: c.repository[i].Version}
+	}
+	return i, nil
+}
+
 func (c *CommentRepository) Insert(comment model.Comment) error {
 	// Insert should insert a comment passed as an argument to the persistent in memory repository.
 	// The method should return an error as an instance of `CommentAlreadyExistsError` struct
 	// when a comment with given id already exists in the repository.
-	_, err := c.GetById(comment.Id)
-	if err == nil {
+	c.lock().Lock()
+	defer c.lock().Unlock()
+
+	if c.indexOf(comment.Id) >= 0 {
 		return CommentAlreadyExistsError{id: comment.Id}
 	}
 
-	if _, ok := err.(CommentNotFoundError); !ok {
-		return err
+	c.repository = append(c.repository, comment)
+	c.touch(comment.PostId)
+	c.stored(comment)
+	return nil
+}
+
+func (c *CommentRepository) InsertAll(comments []model.Comment) error {
+	// InsertAll inserts either every comment passed as an argument or, when any of their ids is already
+	// taken (by a stored comment or by another of the comments), none of them.
+	// The method should return an error as an instance of `CommentAlreadyExistsError` struct for the first such id.
+	c.lock().Lock()
+	defer c.lock().Unlock()
+
+	ids := make(map[uint64]bool, len(comments))
+	for _, comment := range comments {
+		if ids[comment.Id] || c.indexOf(comment.Id) >= 0 {
+			return CommentAlreadyExistsError{id: comment.Id}
+		}
+		ids[comment.Id] = true
 	}
 
-	c.repository = append(c.repository, comment)
+	for _, comment := range comments {
+		c.repository = append(c.repository, comment)
+		c.touch(comment.PostId)
+		c.stored(comment)
+	}
 	return nil
 }
 
@@ -55,10 +156,12 @@ func (c *CommentRepository) GetById(id uint64) (*model.Comment, error) {
 	// GetById should return a comment from a repository that has a given id.
 	// If there's no comment with given id, this function should return a (nil, CommentNotFoundError) pair
 	// with CommentNotFound instance having id member variable set with id passed to this method.
-	for i := range c.repository {
-		if c.repository[i].Id == id {
-			return &c.repository[i], nil
-		}
+	c.lock().RLock()
+	defer c.lock().RUnlock()
+
+	if i := c.indexOf(id); i >= 0 {
+		comment := c.repository[i]
+		return &comment, nil
 	}
 
 	return nil, CommentNotFoundError{id}
@@ -68,6 +171,9 @@ func (c *CommentRepository) GetAllByPostId(id uint64) []model.Comment {
 	// GetAllByPostId should return a slice of all comments that have PostId member variable
 	// equal to given id.
 	// The method should return an empty slice when there are no comments with given id in the repository.
+	c.lock().RLock()
+	defer c.lock().RUnlock()
+
 	var result []model.Comment
 
 	for _, comment := range c.repository {
@@ -79,12 +185,203 @@ func (c *CommentRepository) GetAllByPostId(id uint64) []model.Comment {
 	return result
 }
 
+// CommentOrder orders comments by creation date, ties broken by id.
+type CommentOrder string
+
+const (
+	OldestFirst CommentOrder = "oldest"
+	NewestFirst CommentOrder = "newest"
+)
+
+// CommentCursor points at a comment of a listing, which continues after it.
+type CommentCursor struct {
+	CreationDate time.Time
+	Id           uint64
+}
+
+// CommentQuery selects a page of the comments of a post; zero fields select every comment.
+type CommentQuery struct {
+	PostId uint64
+	Author string
+	// Since and Until bound the creation dates, Since inclusively and Until exclusively.
+	Since, Until time.Time
+	// Visible leaves out hidden comments.
+	Visible bool
+	Order   CommentOrder
+	After   *CommentCursor
+	Limit   int
+}
+
+func (q CommentQuery) matches(comment model.Comment) bool {
+	return comment.PostId == q.PostId &&
+		(q.Author == "" || comment.Author == q.Author) &&
+		(q.Since.IsZero() || !comment.CreationDate.Before(q.Since)) &&
+		(q.Until.IsZero() || comment.CreationDate.Before(q.Until)) &&
+		!(q.Visible && comment.Hidden)
+}
+
+// before reports whether a comment at a comes before one at b in the order of the query.
+func (q CommentQuery) before(a CommentCursor, b CommentCursor) bool {
+	if q.Order == NewestFirst {
+		a, b = b, a
+	}
+	if !a.CreationDate.Equal(b.CreationDate) {
+		return a.CreationDate.Before(b.CreationDate)
+	}
+	return a.Id < b.Id
+}
+
+// CommentPage is a page of comments. Next points at its last comment when more follow.
+type CommentPage struct {
+	Comments []model.Comment
+	Next     *CommentCursor
+}
+
+func cursorOf(comment model.Comment) CommentCursor {
+	return CommentCursor{CreationDate: comment.CreationDate, Id: comment.Id}
+}
+
+func (c *CommentRepository) Find(query CommentQuery) CommentPage {
+	// Find returns the comments selected by the query, oldest first unless ordered otherwise, starting
+	// after its cursor and up to its limit.
+	c.lock().RLock()
+	defer c.lock().RUnlock()
+
+	result := make([]model.Comment, 0)
+	for _, comment := range c.repository {
+		if query.matches(comment) && (query.After == nil || query.before(*query.After, cursorOf(comment))) {
+			result = append(result, comment)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return query.before(cursorOf(result[i]), cursorOf(result[j])) })
+
+	page := CommentPage{Comments: result}
+	if query.Limit > 0 && len(result) > query.Limit {
+		next := cursorOf(result[query.Limit-1])
+		page.Comments, page.Next = result[:query.Limit], &next
+	}
+	return page
+}
+
+func (c *CommentRepository) GetAll() []model.Comment {
+	// GetAll returns every comment, hidden ones included, ordered by id.
+	c.lock().RLock()
+	defer c.lock().RUnlock()
+
+	result := make([]model.Comment, len(c.repository))
+	copy(result, c.repository)
+	sort.Slice(result, func(i, j int) bool { return result[i].Id < result[j].Id })
+	return result
+}
+
+func (c *CommentRepository) Update(comment model.Comment) (*model.Comment, error) {
+	// Update replaces the stored comment that has the same id as the comment passed as an argument, provided
+	// the stored comment is still at comment.Version (compare-and-swap), and returns the comment at its new version.
+	// The method should return an error as an instance of `CommentNotFoundError` struct
+	// when there's no comment with given id, and `CommentVersionMismatchError` when its version differs.
+	c.lock().Lock()
+	defer c.lock().Unlock()
+
+	i, err := c.checkVersion(comment.Id, comment.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	c.touch(c.repository[i].PostId)
+	comment.Version = c.repository[i].Version + 1
+	c.repository[i] = comment
+	c.touch(comment.PostId)
+	c.stored(comment)
+	return &comment, nil
+}
+
+func (c *CommentRepository) Delete(id uint64, version uint64) error {
+	// Delete removes the comment with given id from the repository, provided it is still at the given version.
+	// The method should return an error as an instance of `CommentNotFoundError` struct
+	// when there's no comment with given id, and `CommentVersionMismatchError` when its version differs.
+	c.lock().Lock()
+	defer c.lock().Unlock()
+
+	i, err := c.checkVersion(id, version)
+	if err != nil {
+		return err
+	}
+
+	c.touch(c.repository[i].PostId)
+	c.repository = append(c.repository[:i], c.repository[i+1:]...)
+	for _, listener := range c.listeners {
+		listener.CommentDeleted(id)
+	}
+	return nil
+}
+
+func (c *CommentRepository) SetHidden(id uint64, hidden bool, version uint64) (*model.Comment, error) {
+	// SetHidden marks the comment with given id as hidden (or visible again) for readers, provided it is
+	// still at the given version, and returns the comment at its new version.
+	// The method should return an error as an instance of `CommentNotFoundError` struct
+	// when there's no comment with given id, and `CommentVersionMismatchError` when its version differs.
+	c.lock().Lock()
+	defer c.lock().Unlock()
+
+	i, err := c.checkVersion(id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	c.repository[i].Hidden = hidden
+	c.repository[i].Version++
+	c.touch(c.repository[i].PostId)
+	comment := c.repository[i]
+	c.stored(comment)
+	return &comment, nil
+}
+
+func (c *CommentRepository) LastModifiedByPostId(id uint64) time.Time {
+	// LastModifiedByPostId returns when a comment was last added to, removed from or hidden on the post
+	// with given id, or the zero time when that has not happened since the repository was created.
+	c.lock().RLock()
+	defer c.lock().RUnlock()
+
+	return c.modified[id]
+}
+
 type PostRepository struct {
+	mu         *sync.RWMutex
 	repository []model.Post
+	// slugs is the unique slug index: the id of the post of each current and former slug. Former slugs
+	// stay taken so that links using them keep leading to their post.
+	slugs     map[string]uint64
+	listeners []PostListener
+}
+
+// PostListener is told about the posts stored in and deleted from a repository, e.g. to index them.
+// It is called with the repository locked and must not call back into it.
+type PostListener interface {
+	PostStored(post model.Post)
+	PostDeleted(id uint64)
+}
+
+// Listen registers a listener told about every later change of the repository.
+func (c *PostRepository) Listen(listener PostListener) {
+	c.lock().Lock()
+	defer c.lock().Unlock()
+	c.listeners = append(c.listeners, listener)
+}
+
+func (c *PostRepository) stored(post model.Post) {
+	for _, listener := range c.listeners {
+		listener.PostStored(post)
+	}
 }
 
 func CustomPostRepository(mockStorage []model.Post) PostRepository {
-	return PostRepository{repository: mockStorage}
+	c := PostRepository{mu: &sync.RWMutex{}, repository: mockStorage}
+	for _, post := range mockStorage {
+		if post.Slug != "" {
+			c.index()[post.Slug] = post.Id
+		}
+	}
+	return c
 }
 
 func NewPostRepository() *PostRepository {
@@ -97,7 +394,7 @@ type PostAlreadyExistsError struct {
 }
 
 func (e PostAlreadyExistsError) Error() string {
-	return fmt.Sprintf("Post with id: %v does not exist", e.id)
+	return fmt.Sprintf("Post with id: %v already exists", e.id)
 }
 
 type PostNotFoundError struct {
@@ -105,23 +402,114 @@ type PostNotFoundError struct {
 }
 
 func (e PostNotFoundError) Error() string {
-	return fmt.Sprintf("Post with id: %v already exists", e.id)
+	return fmt.Sprintf("Post with id: %v does not exist", e.id)
+}
+
+type PostSlugNotFoundError struct {
+	slug string
+}
+
+func (e PostSlugNotFoundError) Error() string {
+	return fmt.Sprintf("Post with slug: %v does not exist", e.slug)
+}
+
+type PostVersionMismatchError struct {
+	id      uint64
+	Current uint64
+}
+
+func (e PostVersionMismatchError) Error() string {
+	return fmt.Sprintf("Post with id: %v has been modified, current version is %v", e.id, e.Current)
+}
+
+func (c *PostRepository) lock() *sync.RWMutex {
+	if c.mu == nil {
+		return &zeroValueMu
+	}
+	return c.mu
+}
+
+func (c *PostRepository) index() map[string]uint64 {
+	if c.slugs == nil {
+		c.slugs = make(map[string]uint64)
+	}
+	return c.slugs
+}
+
+// claimSlug makes the slug of a post unique by suffixing it with -2, -3, ... while another post has
+// it, and indexes it. Posts without a slug keep none.
+func (c *PostRepository) claimSlug(post *model.Post) {
+	if post.Slug == "" {
+		return
+	}
+	base := post.Slug
+	for n := 2; ; n++ {
+		if id, taken := c.index()[post.Slug]; !taken || id == post.Id {
+			break
+		}
+		post.Slug = fmt.Sprintf("%s-%d", base, n)
+	}
+	c.index()[post.Slug] = post.Id
+}
+
+func (c *PostRepository) indexOf(id uint64) int {
+	for i := range c.repository {
+		if c.repository[i].Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkVersion returns the index of the post with given id, provided its version is the expected one.
+func (c *PostRepository) checkVersion(id uint64, version uint64) (int, error) {
+	i := c.indexOf(id)
+	if i < 0 {
+		return i, PostNotFoundError{id}
+	}
+	if version != AnyVersion && c.repository[i].Version != version {
+		return i, PostVersionMismatchError{id: id, Current: c.repository[i].Version}
+	}
+	return i, nil
 }
 
 func (c *PostRepository) Insert(post model.Post) error {
 	// Insert should insert a post passed as an argument to the persistent in memory repository.
 	// The method should return an error as an instance of `PostAlreadyExistsError` struct
 	// when a post with given id already exists in the repository.
-	_, err := c.GetById(post.Id)
-	if err == nil {
+	c.lock().Lock()
+	defer c.lock().Unlock()
+
+	if c.indexOf(post.Id) >= 0 {
 		return PostAlreadyExistsError{id: post.Id}
 	}
 
-	if _, ok := err.(PostNotFoundError); !ok {
-		return err
+	c.claimSlug(&post)
+	c.repository = append(c.repository, post)
+	c.stored(post)
+	return nil
+}
+
+func (c *PostRepository) InsertAll(posts []model.Post) error {
+	// InsertAll inserts either every post passed as an argument or, when any of their ids is already
+	// taken (by a stored post or by another of the posts), none of them.
+	// The method should return an error as an instance of `PostAlreadyExistsError` struct for the first such id.
+	c.lock().Lock()
+	defer c.lock().Unlock()
+
+	ids := make(map[uint64]bool, len(posts))
+	for _, post := range posts {
+		if ids[post.Id] || c.indexOf(post.Id) >= 0 {
+			return PostAlreadyExistsError{id: post.Id}
+		}
+		ids[post.Id] = true
 	}
 
-	c.repository = append(c.repository, post)
+	for _, post := range posts {
+		c.claimSlug(&post)
+		c.repository = append(c.repository, post)
+		c.stored(post)
+	}
 	return nil
 }
 
@@ -129,11 +517,266 @@ func (c *PostRepository) GetById(id uint64) (*model.Post, error) {
 	// GetById should return a post from a repository that has a given id.
 	// If there's no post with given id, this function should return a (nil, PostNotFoundError) pair
 	// with PostNotFoundError instance having id member variable set with id passed to this method.
+	c.lock().RLock()
+	defer c.lock().RUnlock()
+
+	if i := c.indexOf(id); i >= 0 {
+		post := c.repository[i]
+		return &post, nil
+	}
+
+	return nil, PostNotFoundError{id}
+}
+
+func (c *PostRepository) GetBySlug(slug string) (*model.Post, error) {
+	// GetBySlug returns the post that has, or used to have, the given slug.
+	// If there's no such post, this function should return a (nil, PostSlugNotFoundError) pair.
+	c.lock().RLock()
+	defer c.lock().RUnlock()
+
+	if id, ok := c.slugs[slug]; ok {
+		if i := c.indexOf(id); i >= 0 {
+			post := c.repository[i]
+			return &post, nil
+		}
+	}
+	return nil, PostSlugNotFoundError{slug}
+}
+
+func (c *PostRepository) GetAll() []model.Post {
+	// GetAll returns every post, ordered by id.
+	c.lock().RLock()
+	defer c.lock().RUnlock()
+
+	result := make([]model.Post, len(c.repository))
+	copy(result, c.repository)
+	sort.Slice(result, func(i, j int) bool { return result[i].Id < result[j].Id })
+	return result
+}
+
+// PostFilter selects posts by tag and category; empty fields select every post.
+type PostFilter struct {
+	Tag      string
+	Category string
+}
+
+func (f PostFilter) matches(post model.Post) bool {
+	if f.Category != "" && post.Category != f.Category {
+		return false
+	}
+	if f.Tag == "" {
+		return true
+	}
+	for _, tag := range post.Tags {
+		if tag == f.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *PostRepository) Find(filter PostFilter) []model.Post {
+	// Find returns the posts selected by the filter, ordered by id.
+	result := make([]model.Post, 0)
+	for _, post := range c.GetAll() {
+		if filter.matches(post) {
+			result = append(result, post)
+		}
+	}
+	return result
+}
+
+func (c *PostRepository) GetTags() []model.Tag {
+	// GetTags returns every tag in use along with the number of posts tagged with it, ordered by name.
+	c.lock().RLock()
+	defer c.lock().RUnlock()
+
+	counts := make(map[string]int)
+	for _, post := range c.repository {
+		for _, tag := range post.Tags {
+			counts[tag]++
+		}
+	}
+	result := make([]model.Tag, 0, len(counts))
+	for name, posts := range counts {
+		result = append(result, model.Tag{Name: name, Posts: posts})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func (c *PostRepository) Update(post model.Post) (*model.Post, error) {
+	// Update replaces the stored post that has the same id as the post passed as an argument, provided the
+	// stored post is still at post.Version (compare-and-swap), and returns the post at its new version.
+	// The method should return an error as an instance of `PostNotFoundError` struct
+	// when there's no post with given id, and `PostVersionMismatchError` when its version differs.
+	c.lock().Lock()
+	defer c.lock().Unlock()
+
+	i, err := c.checkVersion(post.Id, post.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Posts updated without a slug keep theirs; the former slug of a post stays in the index.
+	if post.Slug == "" {
+		post.Slug = c.repository[i].Slug
+	}
+	c.claimSlug(&post)
+	post.Version = c.repository[i].Version + 1
+	c.repository[i] = post
+	c.stored(post)
+	return &post, nil
+}
+
+func (c *PostRepository) PublishDue(now time.Time) []model.Post {
+	// PublishDue publishes the scheduled posts whose PublishAt is not after now, each at its next version,
+	// and returns them. The schedule is kept with the posts, so posts due while the service was down are
+	// published by the first call.
+	c.lock().Lock()
+	defer c.lock().Unlock()
+
+	published := make([]model.Post, 0)
 	for i := range c.repository {
-		if c.repository[i].Id == id {
-			return &c.repository[i], nil
+		post := &c.repository[i]
+		if post.Status != model.Scheduled || post.PublishAt == nil || post.PublishAt.After(now) {
+			continue
 		}
+		post.Status = model.Published
+		post.ModificationDate = now
+		post.Version++
+		published = append(published, *post)
+		c.stored(*post)
 	}
+	return published
+}
 
-	return nil, PostNotFoundError{id}
+func (c *PostRepository) Delete(id uint64, version uint64) error {
+	// Delete removes the post with given id from the repository, provided it is still at the given version.
+	// The method should return an error as an instance of `PostNotFoundError` struct
+	// when there's no post with given id, and `PostVersionMismatchError` when its version differs.
+	c.lock().Lock()
+	defer c.lock().Unlock()
+
+	i, err := c.checkVersion(id, version)
+	if err != nil {
+		return err
+	}
+
+	// The slugs of a deleted post may be taken by other posts.
+	for slug, owner := range c.slugs {
+		if owner == id {
+			delete(c.slugs, slug)
+		}
+	}
+	c.repository = append(c.repository[:i], c.repository[i+1:]...)
+	for _, listener := range c.listeners {
+		listener.PostDeleted(id)
+	}
+	return nil
+}
+
+// RetentionPolicy bounds the revisions kept of each post: at most the latest MaxCount, none older than
+// MaxAge. Zero fields do not bound. The latest revision of a post is always kept.
+type RetentionPolicy struct {
+	MaxCount int
+	MaxAge   time.Duration
+}
+
+// retained returns the revisions of a post, oldest first, the policy keeps at now.
+func (p RetentionPolicy) retained(revisions []model.Revision, now time.Time) []model.Revision {
+	result := make([]model.Revision, 0, len(revisions))
+	for i, revision := range revisions {
+		latest := i == len(revisions)-1
+		tooMany := p.MaxCount > 0 && len(revisions)-i > p.MaxCount
+		tooOld := p.MaxAge > 0 && revision.Date.Before(now.Add(-p.MaxAge))
+		if latest || (!tooMany && !tooOld) {
+			result = append(result, revision)
+		}
+	}
+	return result
+}
+
+type RevisionRepository struct {
+	mu        sync.RWMutex
+	policy    RetentionPolicy
+	revisions map[uint64][]model.Revision
+	// last is the number of the latest revision of each post. Numbers are not reused once pruned.
+	last map[uint64]uint64
+}
+
+func NewRevisionRepository(policy RetentionPolicy) *RevisionRepository {
+	return &RevisionRepository{policy: policy}
+}
+
+type RevisionNotFoundError struct {
+	postId uint64
+	number uint64
+}
+
+func (e RevisionNotFoundError) Error() string {
+	return fmt.Sprintf("Revision %v of post with id: %v does not exist", e.number, e.postId)
+}
+
+func (c *RevisionRepository) add(revision model.Revision) model.Revision {
+	if c.revisions == nil {
+		c.revisions = make(map[uint64][]model.Revision)
+		c.last = make(map[uint64]uint64)
+	}
+	c.last[revision.PostId]++
+	revision.Number = c.last[revision.PostId]
+	c.revisions[revision.PostId] = c.policy.retained(append(c.revisions[revision.PostId], revision), revision.Date)
+	return revision
+}
+
+func (c *RevisionRepository) Add(revision model.Revision) model.Revision {
+	// Add numbers the revision after the latest one of its post and stores it, then prunes the revisions
+	// of the post the retention policy no longer keeps as of the date of the revision. It returns the
+	// revision as stored.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.add(revision)
+}
+
+func (c *RevisionRepository) AddFirst(revision model.Revision) bool {
+	// AddFirst adds the revision unless its post has revisions already, and reports whether it did.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.revisions[revision.PostId]) > 0 {
+		return false
+	}
+	c.add(revision)
+	return true
+}
+
+func (c *RevisionRepository) GetAllByPostId(id uint64, now time.Time) []model.Revision {
+	// GetAllByPostId returns the revisions of the post with given id the retention policy keeps at now,
+	// oldest first; an empty slice when there are none.
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.policy.retained(c.revisions[id], now)
+}
+
+func (c *RevisionRepository) GetByNumber(postId uint64, number uint64, now time.Time) (*model.Revision, error) {
+	// GetByNumber returns the revision of the post with given number, provided the retention policy
+	// keeps it at now, and a RevisionNotFoundError otherwise.
+	for _, revision := range c.GetAllByPostId(postId, now) {
+		if revision.Number == number {
+			return &revision, nil
+		}
+	}
+	return nil, RevisionNotFoundError{postId: postId, number: number}
+}
+
+func (c *RevisionRepository) DeleteByPostId(id uint64) {
+	// DeleteByPostId removes every revision of the post with given id. A post later created with the
+	// same id starts over at revision 1.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.revisions, id)
+	delete(c.last, id)
 }
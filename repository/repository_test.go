@@ -48,3 +48,322 @@ func TestInsertExistingComment(t *testing.T) {
 	err := c.Insert(comment1)
 	assert.EqualErrorf(t, err, "Comment with id: 1 already exists", "test failed because of wrong error msg: %+v", err)
 }
+
+func TestDeleteComment(t *testing.T) {
+	c := CommentRepository{}
+	c.Insert(comment1)
+	c.Insert(comment2)
+
+	assert.NoError(t, c.Delete(comment1.Id, AnyVersion))
+	assert.ElementsMatch(t, c.GetAllByPostId(comment1.PostId), []model.Comment{comment2})
+	assert.EqualError(t, c.Delete(comment1.Id, AnyVersion), "Comment with id: 1 does not exist")
+}
+
+func TestUpdatePost(t *testing.T) {
+	p := PostRepository{}
+	post := model.Post{Id: 1, Title: "title", Content: "content", CreationDate: time.Unix(10011, 0)}
+	p.Insert(post)
+
+	post.Title = "new title"
+	updated, err := p.Update(post)
+	assert.NoError(t, err)
+	stored, _ := p.GetById(1)
+	assert.Equal(t, "new title", stored.Title)
+	assert.Equal(t, uint64(1), stored.Version)
+	assert.Equal(t, stored, updated)
+	_, err = p.Update(model.Post{Id: 2})
+	assert.IsType(t, PostNotFoundError{}, err)
+	assert.EqualError(t, err, "Post with id: 2 does not exist")
+	assert.EqualError(t, p.Insert(post), "Post with id: 1 already exists")
+}
+
+func TestUpdatePostComparesVersions(t *testing.T) {
+	p := PostRepository{}
+	post := model.Post{Id: 1, Title: "title", Content: "content", CreationDate: time.Unix(10011, 0)}
+	p.Insert(post)
+	p.Update(post)
+
+	// post.Version is still 0 while the stored post is at version 1
+	_, err := p.Update(post)
+	assert.EqualError(t, err, "Post with id: 1 has been modified, current version is 1")
+	assert.EqualError(t, p.Delete(1, 7), "Post with id: 1 has been modified, current version is 1")
+	assert.NoError(t, p.Delete(1, 1))
+}
+
+func TestSetHiddenComparesVersions(t *testing.T) {
+	c := CommentRepository{}
+	c.Insert(comment1)
+
+	hidden, err := c.SetHidden(comment1.Id, true, comment1.Version)
+	assert.NoError(t, err)
+	assert.True(t, hidden.Hidden)
+	assert.Equal(t, uint64(1), hidden.Version)
+
+	_, err = c.SetHidden(comment1.Id, false, comment1.Version)
+	assert.IsType(t, CommentVersionMismatchError{}, err)
+}
+
+func TestGetAllPosts(t *testing.T) {
+	c := CustomPostRepository([]model.Post{{Id: 3, Title: "c"}, {Id: 1, Title: "a"}})
+	c.Insert(model.Post{Id: 2, Title: "b"})
+
+	result := c.GetAll()
+	assert.Equal(t, []uint64{1, 2, 3}, []uint64{result[0].Id, result[1].Id, result[2].Id})
+
+	assert.Empty(t, (&PostRepository{}).GetAll())
+}
+
+func TestFindPostsAndTags(t *testing.T) {
+	c := CustomPostRepository([]model.Post{
+		{Id: 3, Tags: []string{"go", "web"}, Category: "backend"},
+		{Id: 1, Tags: []string{"go"}},
+		{Id: 2, Category: "backend"},
+	})
+
+	ids := func(posts []model.Post) []uint64 {
+		result := make([]uint64, 0)
+		for _, post := range posts {
+			result = append(result, post.Id)
+		}
+		return result
+	}
+	assert.Equal(t, []uint64{1, 2, 3}, ids(c.Find(PostFilter{})))
+	assert.Equal(t, []uint64{1, 3}, ids(c.Find(PostFilter{Tag: "go"})))
+	assert.Equal(t, []uint64{3}, ids(c.Find(PostFilter{Tag: "go", Category: "backend"})))
+	assert.Empty(t, c.Find(PostFilter{Tag: "rust"}))
+	assert.Equal(t, []model.Tag{{Name: "go", Posts: 2}, {Name: "web", Posts: 1}}, c.GetTags())
+	assert.Empty(t, (&PostRepository{}).GetTags())
+}
+
+func TestPublishDue(t *testing.T) {
+	now := time.Date(2018, time.September, 16, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	c := CustomPostRepository([]model.Post{
+		{Id: 1, Status: model.Scheduled, PublishAt: &past},
+		{Id: 2, Status: model.Scheduled, PublishAt: &future},
+		{Id: 3, Status: model.Draft, PublishAt: &past},
+	})
+
+	published := c.PublishDue(now)
+	assert.Equal(t, []model.Post{{Id: 1, Status: model.Published, PublishAt: &past, ModificationDate: now, Version: 1}}, published)
+	assert.Empty(t, c.PublishDue(now))
+
+	published = c.PublishDue(future)
+	assert.Len(t, published, 1)
+	assert.Equal(t, uint64(2), published[0].Id)
+	post, _ := c.GetById(3)
+	assert.Equal(t, model.Draft, post.Status)
+}
+
+func TestSlugIndex(t *testing.T) {
+	c := CustomPostRepository([]model.Post{{Id: 1, Slug: "hello"}})
+
+	// Taken slugs are suffixed.
+	assert.NoError(t, c.Insert(model.Post{Id: 2, Slug: "hello"}))
+	assert.NoError(t, c.InsertAll([]model.Post{{Id: 3, Slug: "hello"}, {Id: 4, Slug: "hello-2"}}))
+	slugs := make([]string, 0)
+	for _, post := range c.GetAll() {
+		slugs = append(slugs, post.Slug)
+	}
+	assert.Equal(t, []string{"hello", "hello-2", "hello-3", "hello-2-2"}, slugs)
+
+	// Former slugs still lead to their post and stay taken.
+	updated, err := c.Update(model.Post{Id: 1, Slug: "renamed"})
+	assert.NoError(t, err)
+	assert.Equal(t, "renamed", updated.Slug)
+	post, err := c.GetBySlug("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), post.Id)
+	assert.NoError(t, c.Insert(model.Post{Id: 5, Slug: "hello"}))
+	post, _ = c.GetById(5)
+	assert.Equal(t, "hello-4", post.Slug)
+
+	// Updates without a slug keep it, and posts may take their former slugs back.
+	updated, _ = c.Update(model.Post{Id: 1, Version: 1})
+	assert.Equal(t, "renamed", updated.Slug)
+	updated, _ = c.Update(model.Post{Id: 1, Slug: "hello", Version: 2})
+	assert.Equal(t, "hello", updated.Slug)
+
+	// The slugs of deleted posts are freed.
+	assert.NoError(t, c.Delete(1, AnyVersion))
+	_, err = c.GetBySlug("renamed")
+	assert.EqualError(t, err, "Post with slug: renamed does not exist")
+	_, err = (&PostRepository{}).GetBySlug("hello")
+	assert.IsType(t, PostSlugNotFoundError{}, err)
+}
+
+func TestUpdateComment(t *testing.T) {
+	c := CommentRepository{}
+	c.Insert(comment1)
+	c.Insert(comment3)
+
+	comment := comment1
+	comment.Comment = "edited"
+	updated, err := c.Update(comment)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), updated.Version)
+	assert.Equal(t, []model.Comment{*updated, comment3}, c.GetAll())
+	assert.False(t, c.LastModifiedByPostId(comment1.PostId).IsZero())
+
+	_, err = c.Update(comment)
+	assert.EqualError(t, err, "Comment with id: 1 has been modified, current version is 1")
+	_, err = c.Update(model.Comment{Id: 7})
+	assert.IsType(t, CommentNotFoundError{}, err)
+}
+
+func TestInsertAll(t *testing.T) {
+	p := PostRepository{}
+	p.Insert(model.Post{Id: 1})
+
+	assert.IsType(t, PostAlreadyExistsError{}, p.InsertAll([]model.Post{{Id: 2}, {Id: 1}}))
+	assert.IsType(t, PostAlreadyExistsError{}, p.InsertAll([]model.Post{{Id: 2}, {Id: 2}}))
+	assert.Len(t, p.GetAll(), 1)
+	assert.NoError(t, p.InsertAll([]model.Post{{Id: 3}, {Id: 2}}))
+	assert.Len(t, p.GetAll(), 3)
+
+	c := CommentRepository{}
+	c.Insert(comment1)
+
+	assert.IsType(t, CommentAlreadyExistsError{}, c.InsertAll([]model.Comment{comment3, comment1}))
+	assert.Equal(t, []model.Comment{comment1}, c.GetAll())
+	assert.NoError(t, c.InsertAll([]model.Comment{comment3, comment2}))
+	assert.Equal(t, []model.Comment{comment1, comment2, comment3}, c.GetAll())
+}
+
+func TestFindComments(t *testing.T) {
+	c := CustomCommentRepository([]model.Comment{
+		{Id: 4, PostId: 1, Author: "bob", CreationDate: time.Unix(30, 0)},
+		{Id: 1, PostId: 1, Author: "alice", CreationDate: time.Unix(10, 0)},
+		{Id: 3, PostId: 1, Author: "alice", CreationDate: time.Unix(20, 0), Hidden: true},
+		{Id: 2, PostId: 1, Author: "alice", CreationDate: time.Unix(20, 0)},
+		{Id: 5, PostId: 2, Author: "alice", CreationDate: time.Unix(20, 0)},
+	})
+
+	ids := func(page CommentPage) []uint64 {
+		result := make([]uint64, 0)
+		for _, comment := range page.Comments {
+			result = append(result, comment.Id)
+		}
+		return result
+	}
+	assert.Equal(t, []uint64{1, 2, 3, 4}, ids(c.Find(CommentQuery{PostId: 1})))
+	assert.Equal(t, []uint64{4, 2, 1}, ids(c.Find(CommentQuery{PostId: 1, Order: NewestFirst, Visible: true})))
+	assert.Equal(t, []uint64{1, 2, 3}, ids(c.Find(CommentQuery{PostId: 1, Author: "alice"})))
+	assert.Equal(t, []uint64{2, 3}, ids(c.Find(CommentQuery{PostId: 1, Since: time.Unix(20, 0), Until: time.Unix(30, 0)})))
+
+	// Pages continue after the cursor of the previous one, also when creation dates are equal.
+	first := c.Find(CommentQuery{PostId: 1, Limit: 2})
+	second := c.Find(CommentQuery{PostId: 1, Limit: 2, After: first.Next})
+	newest := c.Find(CommentQuery{PostId: 1, Order: NewestFirst, Limit: 2})
+	assert.Equal(t, []uint64{1, 2}, ids(first))
+	assert.Equal(t, &CommentCursor{CreationDate: time.Unix(20, 0), Id: 2}, first.Next)
+	assert.Equal(t, []uint64{3, 4}, ids(second))
+	assert.Nil(t, second.Next)
+	assert.Equal(t, []uint64{4, 3}, ids(newest))
+	assert.Equal(t, []uint64{2, 1}, ids(c.Find(CommentQuery{PostId: 1, Order: NewestFirst, After: newest.Next})))
+}
+
+type recordingListener struct {
+	stored  []uint64
+	deleted []uint64
+}
+
+func (l *recordingListener) PostStored(post model.Post) { l.stored = append(l.stored, post.Id) }
+func (l *recordingListener) PostDeleted(id uint64)      { l.deleted = append(l.deleted, id) }
+func (l *recordingListener) CommentStored(comment model.Comment) {
+	l.stored = append(l.stored, comment.Id)
+}
+func (l *recordingListener) CommentDeleted(id uint64) { l.deleted = append(l.deleted, id) }
+
+func TestListeners(t *testing.T) {
+	posts, comments := NewPostRepository(), NewCommentRepository()
+	postListener, commentListener := &recordingListener{}, &recordingListener{}
+	posts.Listen(postListener)
+	comments.Listen(commentListener)
+
+	assert.NoError(t, posts.Insert(model.Post{Id: 1}))
+	assert.NoError(t, posts.InsertAll([]model.Post{{Id: 2}}))
+	_, err := posts.Update(model.Post{Id: 1, Title: "t"})
+	assert.NoError(t, err)
+	assert.Error(t, posts.Delete(3, AnyVersion))
+	assert.NoError(t, posts.Delete(2, AnyVersion))
+	assert.Equal(t, []uint64{1, 2, 1}, postListener.stored)
+	assert.Equal(t, []uint64{2}, postListener.deleted)
+
+	assert.NoError(t, comments.Insert(comment1))
+	_, err = comments.SetHidden(comment1.Id, true, AnyVersion)
+	assert.NoError(t, err)
+	assert.NoError(t, comments.Delete(comment1.Id, AnyVersion))
+	assert.Equal(t, []uint64{1, 1}, commentListener.stored)
+	assert.Equal(t, []uint64{1}, commentListener.deleted)
+}
+
+func TestRevisions(t *testing.T) {
+	c := NewRevisionRepository(RetentionPolicy{})
+	start := time.Unix(1000, 0)
+	revision := func(postId uint64, minutes int) model.Revision {
+		return model.Revision{PostId: postId, Title: "title", Date: start.Add(time.Duration(minutes) * time.Minute)}
+	}
+
+	assert.True(t, c.AddFirst(revision(1, 0)))
+	assert.False(t, c.AddFirst(revision(1, 1)))
+	assert.Equal(t, uint64(2), c.Add(revision(1, 2)).Number)
+	assert.Equal(t, uint64(1), c.Add(revision(2, 3)).Number)
+	numbers := func(revisions []model.Revision) []uint64 {
+		result := make([]uint64, 0)
+		for _, revision := range revisions {
+			result = append(result, revision.Number)
+		}
+		return result
+	}
+	assert.Equal(t, []uint64{1, 2}, numbers(c.GetAllByPostId(1, start)))
+	assert.Empty(t, c.GetAllByPostId(3, start))
+
+	stored, err := c.GetByNumber(1, 2, start)
+	assert.NoError(t, err)
+	assert.Equal(t, start.Add(2*time.Minute), stored.Date)
+	_, err = c.GetByNumber(1, 3, start)
+	assert.EqualError(t, err, "Revision 3 of post with id: 1 does not exist")
+
+	// Deleted posts start over.
+	c.DeleteByPostId(1)
+	assert.Empty(t, c.GetAllByPostId(1, start))
+	assert.Equal(t, uint64(1), c.Add(revision(1, 4)).Number)
+}
+
+func TestRevisionRetention(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		testName        string
+		policy          RetentionPolicy
+		readAt          time.Duration
+		expectedNumbers []uint64
+	}{
+		{testName: "testUnbounded", policy: RetentionPolicy{}, readAt: 24 * time.Hour, expectedNumbers: []uint64{1, 2, 3, 4, 5}},
+		{testName: "testMaxCount", policy: RetentionPolicy{MaxCount: 2}, expectedNumbers: []uint64{4, 5}},
+		{testName: "testMaxAge", policy: RetentionPolicy{MaxAge: 150 * time.Minute}, readAt: 4 * time.Hour, expectedNumbers: []uint64{3, 4, 5}},
+		{testName: "testMaxAgeWhenRead", policy: RetentionPolicy{MaxAge: 150 * time.Minute}, readAt: 5 * time.Hour, expectedNumbers: []uint64{4, 5}},
+		{testName: "testLatestIsKept", policy: RetentionPolicy{MaxAge: time.Minute}, readAt: 24 * time.Hour, expectedNumbers: []uint64{5}},
+		{testName: "testBoth", policy: RetentionPolicy{MaxCount: 4, MaxAge: 200 * time.Minute}, readAt: 4 * time.Hour, expectedNumbers: []uint64{2, 3, 4, 5}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN one revision every hour
+			c := NewRevisionRepository(tc.policy)
+			for i := 0; i < 5; i++ {
+				c.Add(model.Revision{PostId: 1, Date: start.Add(time.Duration(i) * time.Hour)})
+			}
+
+			// WHEN
+			revisions := c.GetAllByPostId(1, start.Add(tc.readAt))
+
+			// THEN
+			numbers := make([]uint64, 0)
+			for _, revision := range revisions {
+				numbers = append(numbers, revision.Number)
+			}
+			assert.Equal(t, tc.expectedNumbers, numbers)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Package scheduler publishes scheduled posts once their publication time has passed.
+package scheduler
+
+import (
+	"context"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"log"
+	"time"
+)
+
+const DefaultInterval = time.Minute
+
+// Publisher publishes the scheduled posts that are due, see repository.PostRepository.PublishDue.
+type Publisher interface {
+	PublishDue(now time.Time) []model.Post
+}
+
+type Scheduler struct {
+	posts    Publisher
+	interval time.Duration
+	now      func() time.Time
+}
+
+// New returns a scheduler checking posts for due publications every interval, DefaultInterval when zero.
+func New(posts Publisher, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Scheduler{posts: posts, interval: interval, now: time.Now}
+}
+
+// Tick publishes the posts that are due and returns them.
+func (s *Scheduler) Tick() []model.Post {
+	published := s.posts.PublishDue(s.now().UTC())
+	for _, post := range published {
+		log.Printf("Published scheduled post with id: %d", post.Id)
+	}
+	return published
+}
+
+// Run publishes the posts that became due while the scheduler was not running, then keeps publishing
+// posts as they become due until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.Tick()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/repository"
+	"testing"
+	"time"
+)
+
+var testDate = time.Date(2018, time.September, 16, 12, 0, 0, 0, time.UTC)
+
+func TestTick(t *testing.T) {
+	// GIVEN
+	due, later := testDate.Add(-time.Hour), testDate.Add(time.Hour)
+	posts := repository.CustomPostRepository([]model.Post{
+		{Id: 1, Status: model.Scheduled, PublishAt: &due},
+		{Id: 2, Status: model.Scheduled, PublishAt: &later},
+	})
+	s := New(&posts, 0)
+	s.now = func() time.Time { return testDate }
+
+	// WHEN
+	published := s.Tick()
+
+	// THEN
+	assert.Len(t, published, 1)
+	assert.Equal(t, uint64(1), published[0].Id)
+	post, _ := posts.GetById(2)
+	assert.Equal(t, model.Scheduled, post.Status)
+
+	// WHEN the second post becomes due
+	s.now = func() time.Time { return later }
+	published = s.Tick()
+
+	// THEN
+	assert.Len(t, published, 1)
+	post, _ = posts.GetById(2)
+	assert.Equal(t, model.Published, post.Status)
+}
+
+func TestRunCatchesUp(t *testing.T) {
+	// GIVEN posts that became due while the service was down
+	due := time.Now().Add(-time.Hour)
+	posts := repository.CustomPostRepository([]model.Post{{Id: 1, Status: model.Scheduled, PublishAt: &due}})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	// WHEN
+	go func() {
+		New(&posts, time.Hour).Run(ctx)
+		close(done)
+	}()
+
+	// THEN
+	assert.Eventually(t, func() bool {
+		post, _ := posts.GetById(1)
+		return post.Status == model.Published
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+}
@@ -0,0 +1,141 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// token is a word of a text: its term, and where the word is in the text, in bytes.
+type token struct {
+	term       string
+	word       string
+	start, end int
+}
+
+// tokenize splits a text into lower-cased words of letters and digits, stemmed into terms.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		wordRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if wordRune && start < 0 {
+			start = i
+		} else if !wordRune && start >= 0 {
+			tokens = append(tokens, newToken(text, start, i))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, newToken(text, start, len(text)))
+	}
+	return tokens
+}
+
+func newToken(text string, start int, end int) token {
+	word := strings.ToLower(text[start:end])
+	return token{term: stem(word), word: word, start: start, end: end}
+}
+
+// stem reduces an English word to its stem with a light suffix stripper, so that "publishing",
+// "published" and "publishes" all find "publish". Words that are not plain ASCII are kept whole.
+func stem(word string) string {
+	if len(word) <= 3 || !isAsciiLetters(word) {
+		return word
+	}
+
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		word = word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us") &&
+		!strings.HasSuffix(word, "is"):
+		word = word[:len(word)-1]
+	}
+
+	for _, suffix := range []string{"ing", "ed", "ly"} {
+		if stripped := strings.TrimSuffix(word, suffix); stripped != word && len(stripped) >= 3 && hasVowel(stripped) {
+			word = stripped
+			// running -> run, stopped -> stop
+			if n := len(word); word[n-1] == word[n-2] && !isVowel(word[n-1]) && !strings.ContainsRune("lsz", rune(word[n-1])) {
+				word = word[:n-1]
+			}
+			break
+		}
+	}
+
+	// make and making share a stem
+	if len(word) > 3 && strings.HasSuffix(word, "e") {
+		word = word[:len(word)-1]
+	}
+	return word
+}
+
+func isAsciiLetters(word string) bool {
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func hasVowel(word string) bool {
+	for i := 0; i < len(word); i++ {
+		if isVowel(word[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isVowel(c byte) bool {
+	return strings.IndexByte("aeiouy", c) >= 0
+}
+
+// clause is a part of a query every result matches: a word, a phrase of consecutive words, or the
+// prefix of a word.
+type clause struct {
+	terms  []string
+	prefix string
+}
+
+// parse splits a query into its clauses: "quoted words" are phrases, words ending with * prefixes,
+// and other words match on their stem. An unterminated quote runs to the end of the query.
+func parse(query string) []clause {
+	var clauses []clause
+	for query != "" {
+		quote := strings.IndexByte(query, '"')
+		if quote < 0 {
+			quote = len(query)
+		}
+		for _, word := range strings.Fields(query[:quote]) {
+			if prefix, ok := strings.CutSuffix(word, "*"); ok {
+				if tokens := tokenize(prefix); len(tokens) > 0 {
+					last := tokens[len(tokens)-1]
+					for _, t := range tokens[:len(tokens)-1] {
+						clauses = append(clauses, clause{terms: []string{t.term}})
+					}
+					clauses = append(clauses, clause{prefix: last.word})
+				}
+				continue
+			}
+			for _, t := range tokenize(word) {
+				clauses = append(clauses, clause{terms: []string{t.term}})
+			}
+		}
+		if quote == len(query) {
+			break
+		}
+		phrase, rest, _ := strings.Cut(query[quote+1:], `"`)
+		if tokens := tokenize(phrase); len(tokens) > 0 {
+			terms := make([]string, len(tokens))
+			for i, t := range tokens {
+				terms[i] = t.term
+			}
+			clauses = append(clauses, clause{terms: terms})
+		}
+		query = rest
+	}
+	return clauses
+}
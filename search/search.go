@@ -0,0 +1,394 @@
+// Package search is an embedded full-text index of the titles and contents of posts and of comments.
+// Queries match stemmed words, "quoted phrases" and prefix* words, and rank their results with BM25.
+package search
+
+import (
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Kind string
+
+const (
+	PostKind    Kind = "post"
+	CommentKind Kind = "comment"
+)
+
+// Ref names an indexed post or comment.
+type Ref struct {
+	Kind Kind
+	Id   uint64
+}
+
+// Hit is a search result. PostId is the post of a comment, or the post itself. The snippet is HTML:
+// the matched words are marked with <mark> and the rest of the text is escaped.
+type Hit struct {
+	Ref
+	PostId  uint64
+	Score   float64
+	Snippet string
+}
+
+const (
+	// k1 and b are the usual BM25 parameters: how fast repeated words saturate, and how much longer
+	// documents are penalized.
+	k1 = 1.2
+	b  = 0.75
+	// titleWeight counts words of a title as that many words of a content.
+	titleWeight = 2.0
+	// snippetWords is the length of a snippet, contextWords how many words it shows before a match.
+	snippetWords = 24
+	contextWords = 6
+)
+
+// field is an indexed text of a document. Fields are listed in the order snippets prefer them.
+type field struct {
+	weight float64
+	text   string
+	tokens []token
+}
+
+type position struct {
+	field int
+	index int
+}
+
+type document struct {
+	Ref
+	postId uint64
+	fields []field
+	// positions lists where each term of the document is.
+	positions map[string][]position
+	length    float64
+}
+
+// Index is an inverted index of posts and comments, safe for concurrent use. It implements
+// repository.PostListener and repository.CommentListener to follow the changes of the repositories.
+type Index struct {
+	mu        sync.RWMutex
+	documents map[Ref]*document
+	// postings lists the documents of each term, words the number of occurrences of each word, for
+	// prefix queries.
+	postings    map[string]map[Ref]bool
+	words       map[string]int
+	totalLength float64
+}
+
+func New() *Index {
+	return &Index{documents: make(map[Ref]*document), postings: make(map[string]map[Ref]bool), words: make(map[string]int)}
+}
+
+// Rebuild replaces the content of the index with the posts and comments given.
+func (x *Index) Rebuild(posts []model.Post, comments []model.Comment) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.documents = make(map[Ref]*document, len(posts)+len(comments))
+	x.postings = make(map[string]map[Ref]bool)
+	x.words = make(map[string]int)
+	x.totalLength = 0
+	for _, post := range posts {
+		x.add(postDocument(post))
+	}
+	for _, comment := range comments {
+		x.add(commentDocument(comment))
+	}
+}
+
+func (x *Index) PostStored(post model.Post) {
+	x.store(postDocument(post))
+}
+
+func (x *Index) PostDeleted(id uint64) {
+	x.delete(Ref{Kind: PostKind, Id: id})
+}
+
+func (x *Index) CommentStored(comment model.Comment) {
+	x.store(commentDocument(comment))
+}
+
+func (x *Index) CommentDeleted(id uint64) {
+	x.delete(Ref{Kind: CommentKind, Id: id})
+}
+
+func postDocument(post model.Post) *document {
+	return newDocument(Ref{Kind: PostKind, Id: post.Id}, post.Id,
+		field{weight: 1, text: post.Content}, field{weight: titleWeight, text: post.Title})
+}
+
+func commentDocument(comment model.Comment) *document {
+	return newDocument(Ref{Kind: CommentKind, Id: comment.Id}, comment.PostId, field{weight: 1, text: comment.Comment})
+}
+
+func newDocument(ref Ref, postId uint64, fields ...field) *document {
+	doc := &document{Ref: ref, postId: postId, fields: fields, positions: make(map[string][]position)}
+	for i := range doc.fields {
+		doc.fields[i].tokens = tokenize(doc.fields[i].text)
+		for j, t := range doc.fields[i].tokens {
+			doc.positions[t.term] = append(doc.positions[t.term], position{field: i, index: j})
+		}
+		doc.length += float64(len(doc.fields[i].tokens))
+	}
+	return doc
+}
+
+func (x *Index) store(doc *document) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(doc.Ref)
+	x.add(doc)
+}
+
+func (x *Index) delete(ref Ref) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(ref)
+}
+
+func (x *Index) add(doc *document) {
+	x.documents[doc.Ref] = doc
+	x.totalLength += doc.length
+	for term := range doc.positions {
+		if x.postings[term] == nil {
+			x.postings[term] = make(map[Ref]bool)
+		}
+		x.postings[term][doc.Ref] = true
+	}
+	for _, f := range doc.fields {
+		for _, t := range f.tokens {
+			x.words[t.word]++
+		}
+	}
+}
+
+func (x *Index) remove(ref Ref) {
+	doc, ok := x.documents[ref]
+	if !ok {
+		return
+	}
+	delete(x.documents, ref)
+	x.totalLength -= doc.length
+	for term := range doc.positions {
+		delete(x.postings[term], ref)
+		if len(x.postings[term]) == 0 {
+			delete(x.postings, term)
+		}
+	}
+	for _, f := range doc.fields {
+		for _, t := range f.tokens {
+			if x.words[t.word]--; x.words[t.word] == 0 {
+				delete(x.words, t.word)
+			}
+		}
+	}
+}
+
+// Search returns the documents matching every clause of the query, best first. Documents with the
+// same score are ordered posts first, then by id.
+func (x *Index) Search(query string) []Hit {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	clauses := parse(query)
+	hits := make([]Hit, 0)
+	if len(clauses) == 0 {
+		return hits
+	}
+
+	// Every clause is a set of alternative terms: prefixes stand for the terms of the words they start.
+	alternatives := make([][]string, len(clauses))
+	for i, c := range clauses {
+		alternatives[i] = x.expand(c)
+	}
+	for _, doc := range x.candidates(alternatives) {
+		matched := make(map[string]bool)
+		ok := true
+		for i, c := range clauses {
+			terms := doc.match(c, alternatives[i])
+			if len(terms) == 0 {
+				ok = false
+				break
+			}
+			for _, term := range terms {
+				matched[term] = true
+			}
+		}
+		if ok {
+			hits = append(hits, Hit{Ref: doc.Ref, PostId: doc.postId, Score: x.score(doc, matched), Snippet: doc.snippet(matched)})
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].Kind != hits[j].Kind {
+			return hits[i].Kind == PostKind
+		}
+		return hits[i].Id < hits[j].Id
+	})
+	return hits
+}
+
+func (x *Index) expand(c clause) []string {
+	if c.prefix == "" {
+		return c.terms
+	}
+	seen := make(map[string]bool)
+	var terms []string
+	for word := range x.words {
+		if !strings.HasPrefix(word, c.prefix) {
+			continue
+		}
+		if term := stem(word); !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	sort.Strings(terms)
+	return terms
+}
+
+// candidates returns the documents having a term of every clause.
+func (x *Index) candidates(alternatives [][]string) []*document {
+	var result []*document
+	// The documents of the first clause are checked against the others.
+	for ref := range x.documentsOf(alternatives[0]) {
+		doc := x.documents[ref]
+		ok := true
+		for _, terms := range alternatives[1:] {
+			if !doc.hasAny(terms) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			result = append(result, doc)
+		}
+	}
+	return result
+}
+
+func (x *Index) documentsOf(terms []string) map[Ref]bool {
+	if len(terms) == 1 {
+		return x.postings[terms[0]]
+	}
+	refs := make(map[Ref]bool)
+	for _, term := range terms {
+		for ref := range x.postings[term] {
+			refs[ref] = true
+		}
+	}
+	return refs
+}
+
+func (d *document) hasAny(terms []string) bool {
+	for _, term := range terms {
+		if len(d.positions[term]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the terms of the document matching a clause: the terms of a phrase found in a row in
+// one field, or the terms of a word or prefix found anywhere.
+func (d *document) match(c clause, alternatives []string) []string {
+	if len(c.terms) < 2 {
+		var terms []string
+		for _, term := range alternatives {
+			if len(d.positions[term]) > 0 {
+				terms = append(terms, term)
+			}
+		}
+		return terms
+	}
+	for _, start := range d.positions[c.terms[0]] {
+		tokens := d.fields[start.field].tokens
+		if start.index+len(c.terms) > len(tokens) {
+			continue
+		}
+		found := true
+		for i, term := range c.terms[1:] {
+			if tokens[start.index+1+i].term != term {
+				found = false
+				break
+			}
+		}
+		if found {
+			return c.terms
+		}
+	}
+	return nil
+}
+
+// score is the BM25 score of a document for the terms it matched, words of each field counting as
+// many times as the weight of the field.
+func (x *Index) score(doc *document, terms map[string]bool) float64 {
+	n := float64(len(x.documents))
+	average := x.totalLength / n
+	norm := k1 * (1 - b + b*doc.length/average)
+	score := 0.0
+	for term := range terms {
+		df := float64(len(x.postings[term]))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		tf := 0.0
+		for _, p := range doc.positions[term] {
+			tf += doc.fields[p.field].weight
+		}
+		score += idf * tf * (k1 + 1) / (tf + norm)
+	}
+	return score
+}
+
+// snippet is the part of the first field with a matched term around its first match, or the start of
+// the first field when none has.
+func (d *document) snippet(terms map[string]bool) string {
+	f, first := d.fields[0], -1
+	for _, candidate := range d.fields {
+		for i, t := range candidate.tokens {
+			if terms[t.term] {
+				f, first = candidate, i
+				break
+			}
+		}
+		if first >= 0 {
+			break
+		}
+	}
+	if len(f.tokens) == 0 {
+		return html.EscapeString(f.text)
+	}
+
+	// The window starts contextWords before the match, within the field, and is moved back from the end
+	// of the field so that it holds snippetWords whenever the field does.
+	from := max(first-contextWords, 0)
+	to := min(from+snippetWords, len(f.tokens))
+	from = max(to-snippetWords, 0)
+	var sb strings.Builder
+	offset := f.tokens[from].start
+	if from > 0 {
+		sb.WriteString("…")
+	} else {
+		offset = 0
+	}
+	for _, t := range f.tokens[from:to] {
+		sb.WriteString(html.EscapeString(f.text[offset:t.start]))
+		if terms[t.term] {
+			sb.WriteString("<mark>" + html.EscapeString(f.text[t.start:t.end]) + "</mark>")
+		} else {
+			sb.WriteString(html.EscapeString(f.text[t.start:t.end]))
+		}
+		offset = t.end
+	}
+	if to < len(f.tokens) {
+		sb.WriteString("…")
+	} else {
+		sb.WriteString(html.EscapeString(f.text[offset:]))
+	}
+	return sb.String()
+}
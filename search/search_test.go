@@ -0,0 +1,162 @@
+package search
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	tests := []struct {
+		words        []string
+		expectedStem string
+	}{
+		{words: []string{"publish", "publishes", "published", "publishing"}, expectedStem: "publish"},
+		{words: []string{"run", "running", "runs"}, expectedStem: "run"},
+		{words: []string{"make", "making", "makes"}, expectedStem: "mak"},
+		{words: []string{"story", "stories"}, expectedStem: "story"},
+		{words: []string{"class", "classes"}, expectedStem: "class"},
+		{words: []string{"crème"}, expectedStem: "crème"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expectedStem, func(t *testing.T) {
+			for _, word := range tc.words {
+				assert.Equal(t, tc.expectedStem, stem(word), word)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	assert.Equal(t, []clause{
+		{terms: []string{"go"}},
+		{terms: []string{"blog", "post"}},
+		{prefix: "conc"},
+		{terms: []string{"unterminat", "phras"}},
+	}, parse(`Go "blogging posts" conc* "unterminated phrase`))
+	assert.Empty(t, parse(` "" * `))
+}
+
+func TestSearch(t *testing.T) {
+	// GIVEN
+	index := New()
+	index.Rebuild([]model.Post{
+		{Id: 1, Title: "Concurrency in Go", Content: "Goroutines and channels make concurrent programs simple."},
+		{Id: 2, Title: "Cooking", Content: "A recipe for crème brûlée. Simple, but the caramel is <hot>."},
+		{Id: 3, Title: "Go tooling", Content: "The go command builds, tests and formats programs."},
+	}, []model.Comment{
+		{Id: 10, PostId: 1, Comment: "Channels are simple until they are not."},
+	})
+
+	tests := []struct {
+		testName     string
+		query        string
+		expectedRefs []Ref
+	}{
+		{
+			testName:     "testTitleRanksFirst",
+			query:        "go",
+			expectedRefs: []Ref{{PostKind, 3}, {PostKind, 1}},
+		},
+		{
+			testName:     "testStemming",
+			query:        "channel",
+			expectedRefs: []Ref{{CommentKind, 10}, {PostKind, 1}},
+		},
+		{
+			testName:     "testEveryWordMatches",
+			query:        "simple channels",
+			expectedRefs: []Ref{{CommentKind, 10}, {PostKind, 1}},
+		},
+		{
+			testName:     "testPhrase",
+			query:        `"concurrent programs"`,
+			expectedRefs: []Ref{{PostKind, 1}},
+		},
+		{
+			testName:     "testPhraseInOrder",
+			query:        `"programs concurrent"`,
+			expectedRefs: []Ref{},
+		},
+		{
+			testName:     "testPrefix",
+			query:        "concurr*",
+			expectedRefs: []Ref{{PostKind, 1}},
+		},
+		{
+			testName:     "testUnicode",
+			query:        "crème",
+			expectedRefs: []Ref{{PostKind, 2}},
+		},
+		{
+			testName:     "testNoMatch",
+			query:        "rust",
+			expectedRefs: []Ref{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// WHEN
+			hits := index.Search(tc.query)
+
+			// THEN
+			refs := make([]Ref, 0)
+			for _, hit := range hits {
+				refs = append(refs, hit.Ref)
+			}
+			assert.Equal(t, tc.expectedRefs, refs)
+		})
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	// GIVEN
+	index := New()
+	index.Rebuild([]model.Post{
+		{Id: 2, Title: "Cooking", Content: "A recipe for crème brûlée. Simple, but the caramel is <hot>."},
+		{Id: 4, Title: "Long", Content: "one two three four five six seven eight nine ten eleven twelve thirteen fourteen fifteen " +
+			"sixteen seventeen eighteen nineteen twenty twenty-one twenty-two twenty-three twenty-four twenty-five " +
+			"twenty-six twenty-seven twenty-eight needle twenty-nine"},
+	}, nil)
+
+	// WHEN
+	caramel := index.Search("caramel")
+	cooking := index.Search("cooking")
+	needle := index.Search("needle")
+	start := index.Search("three")
+
+	// THEN
+	assert.Equal(t, "A recipe for crème brûlée. Simple, but the <mark>caramel</mark> is &lt;hot&gt;.", caramel[0].Snippet)
+	assert.Equal(t, "<mark>Cooking</mark>", cooking[0].Snippet)
+	assert.Equal(t, "…sixteen seventeen eighteen nineteen twenty twenty-one twenty-two twenty-three twenty-four twenty-five "+
+		"twenty-six twenty-seven twenty-eight <mark>needle</mark> twenty-nine", needle[0].Snippet)
+	assert.Equal(t, "one two <mark>three</mark> four five six seven eight nine ten eleven twelve thirteen fourteen fifteen "+
+		"sixteen seventeen eighteen nineteen twenty twenty-one twenty-two…", start[0].Snippet)
+}
+
+func TestIndexFollowsChanges(t *testing.T) {
+	// GIVEN
+	index := New()
+	index.PostStored(model.Post{Id: 1, Title: "Hello", Content: "First words"})
+	index.CommentStored(model.Comment{Id: 10, PostId: 1, Comment: "Hello back"})
+
+	// WHEN
+	index.PostStored(model.Post{Id: 1, Title: "Goodbye", Content: "Last words"})
+	index.CommentDeleted(10)
+
+	// THEN
+	assert.Empty(t, index.Search("hello"))
+	assert.Empty(t, index.Search("hel*"))
+	assert.Len(t, index.Search("goodbye"), 1)
+
+	// WHEN
+	index.PostDeleted(1)
+
+	// THEN
+	assert.Empty(t, index.Search("words"))
+	assert.Empty(t, index.documents)
+	assert.Empty(t, index.postings)
+	assert.Empty(t, index.words)
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth"
+	"net/http"
+)
+
+type Option func(*RestApiService)
+
+// WithPolicy enables role-based access control. Without a policy every caller may do everything.
+func WithPolicy(policy *auth.Policy) Option {
+	return func(svc *RestApiService) {
+		svc.policy = policy
+	}
+}
+
+// WithAuthenticators sets the authenticators tried, in order, to identify the caller of a request.
+func WithAuthenticators(authenticators ...auth.Authenticator) Option {
+	return func(svc *RestApiService) {
+		svc.authenticators = append(svc.authenticators, authenticators...)
+	}
+}
+
+// WithOidc enables login through an OpenID Connect provider at /auth/login and accepts the resulting
+// session cookie, or a bearer ID token, as credentials.
+func WithOidc(rp *auth.OidcRelyingParty) Option {
+	return func(svc *RestApiService) {
+		svc.oidc = rp
+		svc.authenticators = append(svc.authenticators, rp)
+	}
+}
+
+func (svc *RestApiService) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, authenticator := range svc.authenticators {
+			id, ok, err := authenticator.Authenticate(r)
+			if err != nil {
+				svc.writeAck(w, r, http.StatusUnauthorized, err.Error())
+				return
+			}
+			if ok {
+				r = r.WithContext(auth.WithIdentity(r.Context(), id))
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorize consults the RBAC policy and writes a 401 or 403 response when the caller may not perform
+// the action on a resource owned by owner. Handlers must return immediately when it reports false.
+func (svc *RestApiService) authorize(w http.ResponseWriter, r *http.Request, action auth.Action, owner string) bool {
+	if svc.policy == nil || svc.policy.Allowed(auth.FromContext(r.Context()), action, owner) {
+		return true
+	}
+	svc.deny(w, r, action)
+	return false
+}
+
+// authorizeAction is authorize for callers who may perform the action on no resource at all, checked
+// before the resource is looked up so that they learn nothing about it. The owner is checked after.
+func (svc *RestApiService) authorizeAction(w http.ResponseWriter, r *http.Request, action auth.Action) bool {
+	if svc.policy == nil || svc.policy.Holds(auth.FromContext(r.Context()), action) {
+		return true
+	}
+	svc.deny(w, r, action)
+	return false
+}
+
+func (svc *RestApiService) deny(w http.ResponseWriter, r *http.Request, action auth.Action) {
+	if id := auth.FromContext(r.Context()); id.IsAnonymous() {
+		svc.writeAck(w, r, http.StatusUnauthorized, fmt.Sprintf("Authentication required to perform %s", action))
+	} else {
+		svc.writeAck(w, r, http.StatusForbidden, fmt.Sprintf("Role %s is not allowed to perform %s", id.Role, action))
+	}
+}
+
+func handleLogin(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: GET /auth/login
+		// Redirects to the identity provider, which sends the browser back to GET /auth/callback.
+		http.Redirect(w, r, svc.oidc.AuthCodeURL(), http.StatusFound)
+	}
+}
+
+func handleLoginCallback(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: GET /auth/callback?code=CODE&state=STATE
+		// On success the response sets the session cookie and is in the format of `AckJsonResponse`:
+		// { "Message": "Logged in as alice with role author", "Status": 200 }
+		query := r.URL.Query()
+		if providerError := query.Get("error"); providerError != "" {
+			svc.writeAck(w, r, http.StatusUnauthorized, fmt.Sprintf("Login failed: %s", providerError))
+			return
+		}
+
+		id, sessionToken, err := svc.oidc.Exchange(r.Context(), query.Get("code"), query.Get("state"))
+		if err != nil {
+			svc.writeAck(w, r, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     auth.SessionCookie,
+			Value:    sessionToken,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		svc.writeAck(w, r, http.StatusOK, fmt.Sprintf("Logged in as %s with role %s", id.Subject, id.Role))
+	}
+}
+
+func handleLogout(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: POST /auth/logout
+		if cookie, err := r.Cookie(auth.SessionCookie); err == nil {
+			svc.oidc.Logout(cookie.Value)
+		}
+		http.SetCookie(w, &http.Cookie{Name: auth.SessionCookie, Path: "/", MaxAge: -1})
+		svc.writeAck(w, r, http.StatusOK, "Logged out")
+	}
+}
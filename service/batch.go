@@ -0,0 +1,272 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/dto"
+	v2 "gitlab.com/devskiller-tasks/rest-api-blog-golang/dto/v2"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"net/http"
+)
+
+const (
+	defaultBatchLimit = 100
+
+	// Batch modes: atomic batches create every item or none, best-effort batches create the items they can.
+	batchAtomic     = "atomic"
+	batchBestEffort = "best-effort"
+)
+
+// WithBatchLimit sets how many items POST /api/posts:batch and POST /api/comments:batch accept at once.
+func WithBatchLimit(limit int) Option {
+	return func(svc *RestApiService) {
+		svc.batchLimit = limit
+	}
+}
+
+// batchItem is the outcome of an item of a batch, in the style of an `AckJsonResponse`. Items that
+// were rejected keep a zero id, items that may be created keep a zero status until they are.
+type batchItem struct {
+	id      uint64
+	status  int
+	message string
+}
+
+func (item *batchItem) reject(status int, message string) {
+	item.status = status
+	item.message = message
+}
+
+// batchItemError rejects an item of a best-effort batch when it is inserted.
+type batchItemError struct {
+	status  int
+	message string
+}
+
+func (e batchItemError) Error() string {
+	return e.message
+}
+
+// batchResults is the body of a batch response: `AckJsonResponse`s in v1, acknowledgements from v2 on.
+func batchResults(version dto.Version, items []batchItem) interface{} {
+	if version == dto.V1 {
+		results := make([]AckJsonResponse, len(items))
+		for i, item := range items {
+			results[i] = AckJsonResponse{Message: item.message, Status: item.status}
+		}
+		return results
+	}
+	results := make([]v2.Ack, len(items))
+	for i, item := range items {
+		results[i] = v2.Ack{Message: item.message, Status: item.status}
+	}
+	return results
+}
+
+// readBatch reads the items of a batch request and its mode. It writes a 400 response and reports
+// false when either is invalid.
+func (svc *RestApiService) readBatch(w http.ResponseWriter, r *http.Request, resource string) ([]json.RawMessage, bool, bool) {
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && mode != batchAtomic && mode != batchBestEffort {
+		svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Wrong mode query parameter: %s", mode))
+		return nil, false, false
+	}
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Could not deserialize %s JSON payload", resource))
+		return nil, false, false
+	}
+	if len(raw) > svc.batchLimit {
+		svc.writeAck(w, r, http.StatusBadRequest,
+			fmt.Sprintf("Batch of %d items exceeds the limit of %d", len(raw), svc.batchLimit))
+		return nil, false, false
+	}
+	return raw, mode != batchBestEffort, true
+}
+
+// createBatch creates the items of a batch that were not rejected, all of them with insertAll in
+// atomic mode, one by one with insert otherwise, and writes the response. Atomic batches with a
+// rejected item are answered with the first one; other batches with the outcome of every item.
+func (svc *RestApiService) createBatch(w http.ResponseWriter, r *http.Request, atomic bool, items []batchItem, resource string,
+	insertAll func() error, insert func(i int) error) {
+	created := func(i int) {
+		items[i].status = http.StatusOK
+		items[i].message = fmt.Sprintf("%s with id: %d successfully added", resource, items[i].id)
+	}
+	if atomic {
+		for i, item := range items {
+			if item.status != 0 {
+				svc.writeAck(w, r, item.status, fmt.Sprintf("Batch item %d: %s", i, item.message))
+				return
+			}
+		}
+		if err := insertAll(); err != nil {
+			// Another request took an id since the batch was checked.
+			svc.writeAck(w, r, conflictStatus(r), fmt.Sprintf("%s ids of the batch have been taken meanwhile", resource))
+			return
+		}
+		for i := range items {
+			created(i)
+		}
+	} else {
+		for i := range items {
+			if items[i].status != 0 {
+				continue
+			}
+			if err := insert(i); err != nil {
+				var rejected batchItemError
+				if errors.As(err, &rejected) {
+					items[i].reject(rejected.status, rejected.message)
+				} else {
+					items[i].reject(conflictStatus(r), fmt.Sprintf("%s with id: %d already exists", resource, items[i].id))
+				}
+				continue
+			}
+			created(i)
+		}
+	}
+
+	_, body, ok := svc.encode(w, r, batchResults(dto.VersionFromContext(r.Context()), items))
+	if !ok {
+		return
+	}
+	w.Write(body)
+}
+
+func handleAddPosts(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example:
+		// POST /api/posts:batch?mode=best-effort
+		// [{ "Id": 1, "Title": "title", "Content": "content", "CreationDate": "1970-01-01T03:46:40+01:00" }, ...]
+		if !svc.authorize(w, r, auth.PostsCreate, "") {
+			return
+		}
+		raw, atomic, ok := svc.readBatch(w, r, "posts")
+		if !ok {
+			return
+		}
+
+		// Every item is checked as POST /api/posts would, ids repeated within the batch conflict as well.
+		version := dto.VersionFromContext(r.Context())
+		items := make([]batchItem, len(raw))
+		posts := make([]model.Post, len(raw))
+		ids := make(map[uint64]bool, len(raw))
+		for i, data := range raw {
+			post, err := dto.DecodeCreatePost(version, bytes.NewReader(data))
+			if err != nil {
+				items[i].reject(http.StatusBadRequest, "Could not deserialize post JSON payload")
+				continue
+			}
+			if post, err = newPost(r, post); err != nil {
+				items[i].reject(http.StatusBadRequest, err.Error())
+				continue
+			}
+			if _, err := svc.postRepository.GetById(post.Id); err == nil || ids[post.Id] {
+				items[i].reject(conflictStatus(r), fmt.Sprintf("Post with id: %d already exists", post.Id))
+				continue
+			}
+			ids[post.Id] = true
+			items[i].id, posts[i] = post.Id, post
+		}
+
+		svc.createBatch(w, r, atomic, items, "Post",
+			func() error {
+				if err := svc.postRepository.InsertAll(posts); err != nil {
+					return err
+				}
+				for _, post := range posts {
+					svc.created(post)
+				}
+				return nil
+			},
+			func(i int) error {
+				if err := svc.postRepository.Insert(posts[i]); err != nil {
+					return err
+				}
+				svc.created(posts[i])
+				return nil
+			})
+	}
+}
+
+func handleAddComments(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example:
+		// POST /api/comments:batch?mode=atomic
+		// [{ "Id": 1, "PostId": 101, "Comment": "comment1", "Author": "author1", "CreationDate": "1970-01-01T03:46:40+01:00" }, ...]
+		if !svc.authorize(w, r, auth.CommentsCreate, "") {
+			return
+		}
+		raw, atomic, ok := svc.readBatch(w, r, "comments")
+		if !ok {
+			return
+		}
+
+		// Every item is checked as POST /api/comments would, ids repeated within the batch conflict as well.
+		// Replies may answer comments of earlier items.
+		version := dto.VersionFromContext(r.Context())
+		items := make([]batchItem, len(raw))
+		comments := make([]model.Comment, len(raw))
+		ids := make(map[uint64]bool, len(raw))
+		batched := make(map[uint64]model.Comment, len(raw))
+		lookup := func(id uint64) (model.Comment, bool) {
+			if comment, ok := batched[id]; ok {
+				return comment, true
+			}
+			return svc.storedComment(id)
+		}
+		for i, data := range raw {
+			comment, err := dto.DecodeCreateComment(version, bytes.NewReader(data))
+			if err != nil {
+				items[i].reject(http.StatusBadRequest, "Could not deserialize comment JSON payload")
+				continue
+			}
+			if comment, err = normalizeComment(comment); err != nil {
+				items[i].reject(http.StatusBadRequest, err.Error())
+				continue
+			}
+			if !complete(comment) {
+				items[i].reject(http.StatusBadRequest, "Could not deserialize comment JSON payload")
+				continue
+			}
+			if svc.hiddenPost(r, comment.PostId) {
+				items[i].reject(http.StatusNotFound, fmt.Sprintf("Post with id: %d does not exist", comment.PostId))
+				continue
+			}
+			if _, err := svc.commentRepository.GetById(comment.Id); err == nil || ids[comment.Id] {
+				items[i].reject(conflictStatus(r), fmt.Sprintf("Comment with id: %d already exists", comment.Id))
+				continue
+			}
+			ids[comment.Id] = true
+			if err := checkParent(comment, lookup); err != nil {
+				items[i].reject(http.StatusBadRequest, err.Error())
+				continue
+			}
+			batched[comment.Id] = comment
+			items[i].id, comments[i] = comment.Id, newComment(comment)
+		}
+
+		inserted := make(map[uint64]bool, len(raw))
+		svc.createBatch(w, r, atomic, items, "Comment",
+			func() error { return svc.commentRepository.InsertAll(comments) },
+			func(i int) error { return svc.insertBatchedComment(comments[i], batched, inserted) })
+	}
+}
+
+// insertBatchedComment inserts a comment of a best-effort batch, unless it replies to an earlier item
+// of the batch that was not inserted: that parent is only known to exist in the batch. inserted holds
+// the ids of the items inserted so far.
+func (svc *RestApiService) insertBatchedComment(comment model.Comment, batched map[uint64]model.Comment, inserted map[uint64]bool) error {
+	if _, ok := batched[comment.ParentId]; ok && !inserted[comment.ParentId] {
+		return batchItemError{status: http.StatusBadRequest,
+			message: fmt.Sprintf("Parent comment with id: %d does not exist", comment.ParentId)}
+	}
+	if err := svc.commentRepository.Insert(comment); err != nil {
+		return err
+	}
+	inserted[comment.Id] = true
+	return nil
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/repository"
+	"golang.org/x/text/unicode/norm"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	viewFlat = "flat"
+	viewTree = "tree"
+	// maxCommentDepth bounds the nesting of replies, top-level comments being at depth 1.
+	maxCommentDepth = 5
+	// defaultCommentLimit and maxCommentLimit bound the pages of the flat view.
+	defaultCommentLimit = 50
+	maxCommentLimit     = 200
+	// maxCommentLength and maxAuthorLength bound comments and the names of their authors, in characters.
+	maxCommentLength = 5000
+	maxAuthorLength  = 100
+)
+
+// commentListingParameters are the query parameters of the flat view the tree view does not take.
+var commentListingParameters = []string{"limit", "cursor", "sort", "author", "since", "until"}
+
+// commentQuery reads the page, order and filters of the flat view from the query parameters.
+func commentQuery(values url.Values, postId uint64) (repository.CommentQuery, error) {
+	query := repository.CommentQuery{
+		PostId: postId, Author: values.Get("author"), Visible: true, Order: repository.OldestFirst, Limit: defaultCommentLimit,
+	}
+	wrong := func(name string) error {
+		return fmt.Errorf("Wrong %s query parameter: %s", name, values.Get(name))
+	}
+	if order := repository.CommentOrder(values.Get("sort")); order != "" {
+		if order != repository.OldestFirst && order != repository.NewestFirst {
+			return query, wrong("sort")
+		}
+		query.Order = order
+	}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxCommentLimit {
+			return query, wrong("limit")
+		}
+		query.Limit = n
+	}
+	var err error
+	if since := values.Get("since"); since != "" {
+		if query.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return query, wrong("since")
+		}
+	}
+	if until := values.Get("until"); until != "" {
+		if query.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return query, wrong("until")
+		}
+	}
+	if cursor := values.Get("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return query, wrong("cursor")
+		}
+		query.After = &after
+	}
+	return query, nil
+}
+
+// addNextLink links a page to the next one, requested with the query parameter name set to value.
+func addNextLink(w http.ResponseWriter, r *http.Request, name string, value string) {
+	next := *r.URL
+	values := r.URL.Query()
+	values.Set(name, value)
+	next.RawQuery = values.Encode()
+	w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+}
+
+// encodeCursor makes an opaque cursor query parameter of a repository cursor.
+func encodeCursor(cursor repository.CommentCursor) string {
+	raw := cursor.CreationDate.Format(time.RFC3339Nano) + " " + strconv.FormatUint(cursor.Id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (repository.CommentCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return repository.CommentCursor{}, err
+	}
+	date, id, ok := strings.Cut(string(raw), " ")
+	if !ok {
+		return repository.CommentCursor{}, errors.New("malformed cursor")
+	}
+	result := repository.CommentCursor{}
+	if result.CreationDate, err = time.Parse(time.RFC3339Nano, date); err != nil {
+		return result, err
+	}
+	result.Id, err = strconv.ParseUint(id, 10, 64)
+	return result, err
+}
+
+// normalizeComment normalizes the text and author of a posted comment: they are put in Unicode NFC,
+// lose their control characters but for the newlines and tabs of the text, and their surrounding
+// spaces. Too long texts and authors are reported.
+func normalizeComment(comment model.Comment) (model.Comment, error) {
+	comment.Comment = normalizeText(strings.ReplaceAll(comment.Comment, "\r\n", "\n"), "\n\t")
+	comment.Author = normalizeText(comment.Author, "")
+	if length := utf8.RuneCountInString(comment.Comment); length > maxCommentLength {
+		return comment, fmt.Errorf("Comment is %d characters long, at most %d are allowed", length, maxCommentLength)
+	}
+	if length := utf8.RuneCountInString(comment.Author); length > maxAuthorLength {
+		return comment, fmt.Errorf("Author is %d characters long, at most %d are allowed", length, maxAuthorLength)
+	}
+	return comment, nil
+}
+
+func normalizeText(text string, keep string) string {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && !strings.ContainsRune(keep, r) {
+			return -1
+		}
+		return r
+	}, text)
+	return strings.TrimSpace(norm.NFC.String(text))
+}
+
+// checkParent checks the comment a reply is posted under: it must exist, be on the same post, and not
+// be nested too deep already. lookup finds the comments replies may be posted under.
+func checkParent(comment model.Comment, lookup func(id uint64) (model.Comment, bool)) error {
+	if comment.ParentId == 0 {
+		return nil
+	}
+	parent, ok := lookup(comment.ParentId)
+	if !ok || comment.ParentId == comment.Id {
+		return fmt.Errorf("Parent comment with id: %d does not exist", comment.ParentId)
+	}
+	if parent.PostId != comment.PostId {
+		return fmt.Errorf("Parent comment with id: %d belongs to another post", comment.ParentId)
+	}
+	// The walk up the thread stops past the deepest allowed nesting, so stored cycles cannot hold it.
+	depth := 2
+	for ok && parent.ParentId != 0 && depth <= maxCommentDepth {
+		if parent.ParentId == comment.Id {
+			return fmt.Errorf("Comment with id: %d cannot reply to its own replies", comment.Id)
+		}
+		if parent, ok = lookup(parent.ParentId); ok {
+			depth++
+		}
+	}
+	if depth > maxCommentDepth {
+		return fmt.Errorf("Replies cannot be nested more than %d levels deep", maxCommentDepth)
+	}
+	return nil
+}
+
+// commentTree nests the comments of a post under their parents, keeping their order. Replies whose
+// parent was deleted become top-level comments. Hidden comments are left out unless they have visible
+// replies, in which case they stay as placeholders without their text and author.
+func commentTree(comments []model.Comment) []model.CommentNode {
+	ids := make(map[uint64]bool, len(comments))
+	for _, comment := range comments {
+		ids[comment.Id] = true
+	}
+	var roots []model.Comment
+	replies := make(map[uint64][]model.Comment)
+	for _, comment := range comments {
+		if comment.ParentId != 0 && ids[comment.ParentId] {
+			replies[comment.ParentId] = append(replies[comment.ParentId], comment)
+		} else {
+			roots = append(roots, comment)
+		}
+	}
+
+	var nest func(comments []model.Comment) []model.CommentNode
+	nest = func(comments []model.Comment) []model.CommentNode {
+		nodes := make([]model.CommentNode, 0, len(comments))
+		for _, comment := range comments {
+			node := model.CommentNode{Comment: comment, Replies: nest(replies[comment.Id])}
+			if comment.Hidden {
+				if len(node.Replies) == 0 {
+					continue
+				}
+				node.Comment.Comment, node.Comment.Author = "", ""
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+	return nest(roots)
+}
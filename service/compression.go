@@ -0,0 +1,182 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/compression"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultCompressionMinSize = 1024
+	maxDecompressedBodyBytes  = 10 << 20
+)
+
+// WithCompression encodes responses of at least minSize bytes with the best coding, among the given
+// ones, that the client accepts. An empty list of codings disables response compression.
+func WithCompression(minSize int, codings ...string) Option {
+	return func(svc *RestApiService) {
+		svc.compressionMinSize = minSize
+		svc.compressionCodings = codings
+	}
+}
+
+func (svc *RestApiService) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if encoding := r.Header.Get("Content-Encoding"); encoding != "" {
+			body, err := compression.NewReader(encoding, r.Body)
+			if err != nil {
+				status := http.StatusBadRequest
+				if errors.As(err, &compression.UnsupportedEncodingError{}) {
+					status = http.StatusUnsupportedMediaType
+				}
+				svc.writeAck(w, r, status, err.Error())
+				return
+			}
+			r.Body = http.MaxBytesReader(w, body, maxDecompressedBodyBytes)
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+		}
+
+		if len(svc.compressionCodings) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Entity tags of compressed responses carry the coding; drop it before the handlers compare them.
+		ifNoneMatch := r.Header.Get("If-None-Match")
+		for _, name := range []string{"If-Match", "If-None-Match"} {
+			if header := r.Header.Get(name); header != "" {
+				r.Header.Set(name, compression.UntagETags(header))
+			}
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		coding := compression.Negotiate(r.Header.Get("Accept-Encoding"), svc.compressionCodings)
+		if coding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w, coding: coding, minSize: svc.compressionMinSize, status: http.StatusOK, ifNoneMatch: ifNoneMatch,
+		}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter buffers the start of a response until it knows whether the response reaches the
+// minimum size worth compressing, and then either compresses it or passes it through unchanged.
+type compressWriter struct {
+	http.ResponseWriter
+	coding      string
+	minSize     int
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         bytes.Buffer
+	encoder     compression.Writer
+	// ifNoneMatch is the If-None-Match header as sent, with the entity tags of compressed responses.
+	ifNoneMatch string
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+	if status == http.StatusNotModified {
+		// The client holds the compressed representation when it sent its tag: confirm that tag.
+		header := cw.Header()
+		if etag := header.Get("ETag"); etag != "" {
+			if tagged := compression.TagETag(etag, cw.coding); strings.Contains(cw.ifNoneMatch, tagged) {
+				header.Set("ETag", tagged)
+			}
+		}
+	}
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	cw.wroteHeader = true
+	if cw.decided {
+		if cw.encoder != nil {
+			return cw.encoder.Write(data)
+		}
+		return cw.ResponseWriter.Write(data)
+	}
+
+	cw.buf.Write(data)
+	if cw.buf.Len() >= cw.minSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	header := cw.Header()
+	if header.Get("Content-Encoding") != "" || !compressible(header.Get("Content-Type")) {
+		compress = false
+	}
+
+	if compress {
+		header.Set("Content-Encoding", cw.coding)
+		header.Del("Content-Length")
+		if etag := header.Get("ETag"); etag != "" {
+			header.Set("ETag", compression.TagETag(etag, cw.coding))
+		}
+		cw.ResponseWriter.WriteHeader(cw.status)
+		cw.encoder = compression.NewWriter(cw.coding, cw.ResponseWriter)
+		_, err := cw.encoder.Write(cw.buf.Bytes())
+		return err
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	_, err := cw.ResponseWriter.Write(cw.buf.Bytes())
+	return err
+}
+
+// Flush sends what has been written so far, compressed when the response is, e.g. for streamed responses.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if err := cw.decide(cw.buf.Len() > 0); err != nil {
+			return
+		}
+	}
+	if cw.encoder != nil && cw.encoder.Flush() != nil {
+		return
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Close()
+	}
+	return nil
+}
+
+// compressible reports whether responses of the given content type are worth compressing.
+func compressible(contentType string) bool {
+	for _, prefix := range []string{"image/", "video/", "audio/", "application/zip", "application/gzip"} {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/compression"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/idempotency"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	IdempotencyKeyHeader   = "Idempotency-Key"
+	defaultIdempotencyTtl  = 24 * time.Hour
+	maxIdempotencyKeyBytes = 255
+)
+
+// WithIdempotency sets where responses to requests with an Idempotency-Key header are kept, and for how long.
+func WithIdempotency(store idempotency.Store, ttl time.Duration) Option {
+	return func(svc *RestApiService) {
+		svc.idempotencyStore = store
+		svc.idempotencyTtl = ttl
+	}
+}
+
+// idempotent makes a create route replay its first response to retries sent with the same
+// Idempotency-Key and payload. Keys are scoped to the route and to the client sending them.
+func (svc *RestApiService) idempotent(route string, next http.HandlerFunc) http.HandlerFunc {
+	if svc.idempotencyStore == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyBytes {
+			svc.writeAck(w, r, http.StatusBadRequest, "Idempotency-Key header is too long")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			svc.writeAck(w, r, http.StatusBadRequest, "Could not read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := sha256.Sum256(append([]byte(r.Method+" "+r.URL.RequestURI()+"\n"), body...))
+
+		storeKey := route + " " + rateLimitClient(r) + " " + key
+		record, err := svc.idempotencyStore.Reserve(r.Context(), storeKey, svc.idempotencyTtl)
+		if errors.Is(err, idempotency.ErrInFlight) {
+			svc.writeAck(w, r, http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+			return
+		}
+		if err != nil {
+			log.Printf("idempotency store unavailable, processing request without it: %v", err)
+			next(w, r)
+			return
+		}
+
+		if record != nil {
+			if record.Fingerprint != hex.EncodeToString(fingerprint[:]) {
+				svc.writeAck(w, r, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different payload")
+				return
+			}
+			for name, values := range record.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.Status)
+			w.Write(record.Body)
+			return
+		}
+
+		// Headers set by outer middleware, such as rate limit counters, belong to this response only.
+		outerHeaders := w.Header().Clone()
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+
+		// Server errors are not stored so that the retry gets another chance.
+		if recorder.status >= http.StatusInternalServerError {
+			svc.idempotencyStore.Release(r.Context(), storeKey)
+			return
+		}
+		header := w.Header().Clone()
+		for name := range outerHeaders {
+			delete(header, name)
+		}
+		// The body is kept as the handler wrote it, before any compression, which the replay goes
+		// through anew: the headers of the compressed response do not describe it.
+		for _, name := range []string{"Content-Encoding", "Content-Length", "Vary"} {
+			header.Del(name)
+		}
+		if etag := header.Get("ETag"); etag != "" {
+			header.Set("ETag", compression.UntagETags(etag))
+		}
+		svc.idempotencyStore.Save(r.Context(), storeKey, idempotency.Record{
+			Fingerprint: hex.EncodeToString(fingerprint[:]),
+			Status:      recorder.status,
+			Header:      header,
+			Body:        recorder.body.Bytes(),
+		}, svc.idempotencyTtl)
+	}
+}
+
+// responseRecorder passes a response through while keeping a copy of its status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(data []byte) (int, error) {
+	rr.body.Write(data)
+	return rr.ResponseWriter.Write(data)
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/markup"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"net/http"
+	"strconv"
+)
+
+// defaultRenderCacheSize is how many posts have their rendered content cached.
+const defaultRenderCacheSize = 1000
+
+// WithRenderCacheSize sets how many posts have their rendered content cached, 0 to render it on every request.
+func WithRenderCacheSize(size int) Option {
+	return func(svc *RestApiService) {
+		svc.renderCacheSize = size
+	}
+}
+
+func checkContentFormat(post model.Post) error {
+	if !post.ContentFormat.Valid() {
+		return fmt.Errorf("Wrong content format: %s", post.ContentFormat)
+	}
+	return nil
+}
+
+// htmlRequested reports whether a boolean query parameter asks for rendered HTML, and ok false after
+// writing the error response when the parameter is invalid.
+func (svc *RestApiService) htmlRequested(w http.ResponseWriter, r *http.Request, name string) (render bool, ok bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, true
+	}
+	render, err := strconv.ParseBool(value)
+	if err != nil {
+		svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Wrong %s query parameter: %s", name, value))
+		return false, false
+	}
+	return render, true
+}
+
+// withContentHtml renders the content of the posts when the contentHtml query parameter asks for it,
+// and reports false after writing the error response when the parameter is invalid.
+func (svc *RestApiService) withContentHtml(w http.ResponseWriter, r *http.Request, posts []model.Post) bool {
+	render, ok := svc.htmlRequested(w, r, "contentHtml")
+	if render {
+		for i := range posts {
+			posts[i].ContentHtml = svc.renderCache.Render(posts[i])
+		}
+	}
+	return ok
+}
+
+func renderComments(comments []model.Comment) {
+	for i := range comments {
+		comments[i].CommentHtml = markup.RenderComment(comments[i].Comment)
+	}
+}
+
+func renderCommentTree(nodes []model.CommentNode) {
+	for i := range nodes {
+		nodes[i].CommentHtml = markup.RenderComment(nodes[i].Comment.Comment)
+		renderCommentTree(nodes[i].Replies)
+	}
+}
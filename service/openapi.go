@@ -0,0 +1,520 @@
+package service
+
+import (
+	"encoding/json"
+	swaggerFiles "github.com/swaggo/files/v2"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/dto"
+	v2 "gitlab.com/devskiller-tasks/rest-api-blog-golang/dto/v2"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/openapi"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/repository"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/transfer"
+	"io"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// operation documents a route. Parameters, status codes and media types that follow from the route
+// pattern and from the configuration of the service are filled in by documentOperation.
+type operation struct {
+	id      string
+	summary string
+	tag     string
+	query   []openapi.Parameter
+	// request and response return a sample of the request payload and of the response body in a
+	// version. Routes without a response body answer with an acknowledgement.
+	request  func(dto.Version) interface{}
+	response func(dto.Version) interface{}
+	// alternatives return samples of the bodies answered instead of the response, depending on the query.
+	alternatives func(dto.Version) []interface{}
+	// requestType and responseType replace the negotiated media types of streamed bodies, whose
+	// request and response samples describe a line.
+	requestType  string
+	responseType string
+	// batch routes take a list of request samples, up to the batch limit.
+	batch bool
+	// conditional routes honour If-Match, cacheable routes If-None-Match and If-Modified-Since.
+	conditional bool
+	cacheable   bool
+	create      bool
+	// status lists the route specific error statuses.
+	status []int
+}
+
+var (
+	minimumLimit       = 1.0
+	minimumQueryLength = 1
+)
+
+var batchModeQuery = []openapi.Parameter{
+	{Name: "mode", In: "query", Description: "Create every item or none, atomic by default, or each item that can be.",
+		Schema: &openapi.Schema{Type: "string", Enum: []string{batchAtomic, batchBestEffort}}},
+}
+
+var contentHtmlQuery = openapi.Parameter{
+	Name: "contentHtml", In: "query", Description: "Also return the content rendered to sanitized HTML.",
+	Schema: &openapi.Schema{Type: "boolean"},
+}
+
+// operations documents every route by name. The spec test fails for routes missing here.
+var operations = map[string]operation{
+	"POST /api/posts": {
+		id: "addPost", summary: "Add a post", tag: "posts", create: true,
+		request: func(v dto.Version) interface{} { return dto.NewCreatePost(v) },
+		status:  []int{http.StatusBadRequest},
+	},
+	"POST /api/posts:batch": {
+		id: "addPosts", summary: "Add several posts", tag: "posts", create: true, batch: true,
+		query:    batchModeQuery,
+		request:  func(v dto.Version) interface{} { return dto.NewCreatePost(v) },
+		response: func(v dto.Version) interface{} { return batchResults(v, nil) },
+		status:   []int{http.StatusBadRequest, http.StatusNotAcceptable},
+	},
+	"GET /api/posts": {
+		id: "getPosts", summary: "List the posts", tag: "posts", cacheable: true,
+		query: []openapi.Parameter{
+			{Name: "tag", In: "query", Description: "Only list the posts with this tag.", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "category", In: "query", Description: "Only list the posts in this category.", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "limit", In: "query", Description: "The number of posts of a page, 50 by default.",
+				Schema: &openapi.Schema{Type: "integer", Minimum: &minimumLimit}},
+			{Name: "cursor", In: "query", Description: "Where the page starts, as given by the next Link of the previous page.",
+				Schema: &openapi.Schema{Type: "string"}},
+			contentHtmlQuery,
+		},
+		response: func(v dto.Version) interface{} { return dto.Posts(v, nil) },
+		status:   []int{http.StatusBadRequest, http.StatusNotAcceptable},
+	},
+	"GET /api/tags": {
+		id: "getTags", summary: "List the tags in use and how many posts have each", tag: "posts", cacheable: true,
+		response: func(v dto.Version) interface{} { return dto.Tags(v, nil) },
+		status:   []int{http.StatusNotAcceptable},
+	},
+	"GET /api/posts/by-slug/{slug}": {
+		id: "getPostBySlug", summary: "Get a post by its slug; former slugs redirect to the current one", tag: "posts", cacheable: true,
+		query:    []openapi.Parameter{contentHtmlQuery},
+		response: func(v dto.Version) interface{} { return dto.Post(v, model.Post{}) },
+		status:   []int{http.StatusMovedPermanently, http.StatusBadRequest, http.StatusNotFound, http.StatusNotAcceptable},
+	},
+	"GET /api/search": {
+		id: "search", summary: "Search the posts and comments", tag: "search", cacheable: true,
+		query: []openapi.Parameter{
+			{Name: "q", In: "query", Required: true, Schema: &openapi.Schema{Type: "string", MinLength: &minimumQueryLength},
+				Description: `Words found in the title or content of posts and in comments, "quoted phrases" and prefix* words.`},
+			{Name: "limit", In: "query", Description: "The number of results of a page, 10 by default.",
+				Schema: &openapi.Schema{Type: "integer", Minimum: &minimumLimit}},
+			{Name: "offset", In: "query", Description: "The number of results before the page.",
+				Schema: openapi.SchemaOf(reflect.TypeOf(uint64(0)))},
+		},
+		response: func(v dto.Version) interface{} { return dto.SearchHits(v, nil) },
+		status:   []int{http.StatusBadRequest, http.StatusNotAcceptable},
+	},
+	"GET /api/posts/{postId}": {
+		id: "getPost", summary: "Get a post", tag: "posts", cacheable: true,
+		query:    []openapi.Parameter{contentHtmlQuery},
+		response: func(v dto.Version) interface{} { return dto.Post(v, model.Post{}) },
+		status:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusNotAcceptable},
+	},
+	"PUT /api/posts/{postId}": {
+		id: "updatePost", summary: "Update the title, content, tags and status of a post", tag: "posts", conditional: true,
+		request: func(v dto.Version) interface{} { return dto.NewUpdatePost(v) },
+		// Status changes that break the publishing workflow conflict from v2 on.
+		status: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	"DELETE /api/posts/{postId}": {
+		id: "deletePost", summary: "Delete a post, its comments and its revisions", tag: "posts", conditional: true,
+		status: []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"GET /api/posts/{postId}/revisions": {
+		id: "getRevisions", summary: "List the revisions kept of a post, oldest first", tag: "revisions", cacheable: true,
+		response: func(v dto.Version) interface{} { return dto.Revisions(v, nil) },
+		status:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusNotAcceptable},
+	},
+	"GET /api/posts/{postId}/revisions/diff": {
+		id: "getRevisionDiff", summary: "Compare two revisions of a post line by line", tag: "revisions", cacheable: true,
+		query: []openapi.Parameter{
+			{Name: "from", In: "query", Required: true, Description: "The revision compared.",
+				Schema: openapi.SchemaOf(reflect.TypeOf(uint64(0)))},
+			{Name: "to", In: "query", Description: "The revision compared with, the latest by default.",
+				Schema: openapi.SchemaOf(reflect.TypeOf(uint64(0)))},
+		},
+		response: func(v dto.Version) interface{} { return dto.RevisionDiff(v, model.RevisionDiff{}) },
+		status:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusNotAcceptable},
+	},
+	"GET /api/posts/{postId}/revisions/{revision}": {
+		id: "getRevision", summary: "Get a revision of a post", tag: "revisions", cacheable: true,
+		response: func(v dto.Version) interface{} { return dto.Revision(v, model.Revision{}) },
+		status:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusNotAcceptable},
+	},
+	"POST /api/posts/{postId}/revisions/{revision}:restore": {
+		id: "restoreRevision", summary: "Set the title and content of a post back to those of a revision", tag: "revisions",
+		conditional: true,
+		status:      []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"POST /api/comments": {
+		id: "addComment", summary: "Add a comment to a post", tag: "comments", create: true,
+		request: func(v dto.Version) interface{} { return dto.NewCreateComment(v) },
+		status:  []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"POST /api/comments:batch": {
+		id: "addComments", summary: "Add several comments", tag: "comments", create: true, batch: true,
+		query:    batchModeQuery,
+		request:  func(v dto.Version) interface{} { return dto.NewCreateComment(v) },
+		response: func(v dto.Version) interface{} { return batchResults(v, nil) },
+		status:   []int{http.StatusBadRequest, http.StatusNotAcceptable},
+	},
+	"GET /api/comments": {
+		id: "getComments", summary: "List the visible comments of a post", tag: "comments", cacheable: true,
+		query: []openapi.Parameter{
+			{Name: "postId", In: "query", Required: true, Schema: openapi.SchemaOf(reflect.TypeOf(uint64(0)))},
+			{Name: "view", In: "query", Description: "List the comments, flat by default, or nest the replies under their parents.",
+				Schema: &openapi.Schema{Type: "string", Enum: []string{viewFlat, viewTree}}},
+			{Name: "limit", In: "query", Description: "The number of comments of a page of the flat view, 50 by default.",
+				Schema: &openapi.Schema{Type: "integer", Minimum: &minimumLimit}},
+			{Name: "cursor", In: "query", Description: "Where the page starts, as given by the next Link of the previous page.",
+				Schema: &openapi.Schema{Type: "string"}},
+			{Name: "sort", In: "query", Description: "List the oldest comments first, the default, or the newest.",
+				Schema: &openapi.Schema{Type: "string", Enum: []string{string(repository.OldestFirst), string(repository.NewestFirst)}}},
+			{Name: "author", In: "query", Description: "Only list the comments of this author.", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "since", In: "query", Description: "Only list the comments created at or after this date.",
+				Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+			{Name: "until", In: "query", Description: "Only list the comments created before this date.",
+				Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+			{Name: "commentHtml", In: "query", Description: "Also return the comments rendered to sanitized HTML.",
+				Schema: &openapi.Schema{Type: "boolean"}},
+		},
+		response:     func(v dto.Version) interface{} { return dto.Comments(v, nil) },
+		alternatives: func(v dto.Version) []interface{} { return []interface{}{dto.CommentTree(v, nil)} },
+		status:       []int{http.StatusBadRequest, http.StatusNotFound, http.StatusNotAcceptable},
+	},
+	"DELETE /api/comments/{commentId}": {
+		id: "deleteComment", summary: "Delete a comment", tag: "comments", conditional: true,
+		status: []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"POST /api/comments/{commentId}/hide": {
+		id: "hideComment", summary: "Hide a comment from readers", tag: "comments", conditional: true,
+		status: []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"POST /api/comments/{commentId}/unhide": {
+		id: "unhideComment", summary: "Show a hidden comment again", tag: "comments", conditional: true,
+		status: []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"GET /api/admin/export": {
+		id: "exportData", summary: "Export every post and comment as JSON Lines", tag: "admin",
+		response:     func(dto.Version) interface{} { return transfer.Record{} },
+		responseType: transfer.MediaType,
+	},
+	"POST /api/admin/import": {
+		id: "importData", summary: "Import posts and comments from JSON Lines", tag: "admin",
+		query: []openapi.Parameter{
+			{Name: "dryRun", In: "query", Description: "Report what the import would do without doing it.",
+				Schema: &openapi.Schema{Type: "boolean"}},
+			{Name: "onConflict", In: "query", Description: "What to do with ids already taken, fail by default.",
+				Schema: &openapi.Schema{Type: "string", Enum: []string{
+					string(transfer.Skip), string(transfer.Overwrite), string(transfer.Fail),
+				}}},
+		},
+		request:     func(dto.Version) interface{} { return transfer.Record{} },
+		requestType: transfer.MediaType,
+		response:    func(v dto.Version) interface{} { return dto.ImportReport(v, transfer.Report{}) },
+		status:      []int{http.StatusBadRequest, http.StatusNotAcceptable},
+	},
+	"GET /openapi.json": {id: "getOpenApi", summary: "This document", tag: "docs"},
+	"GET /docs/":        {id: "getDocs", summary: "Interactive API documentation", tag: "docs"},
+	"GET /auth/login":   {id: "login", summary: "Start signing in with the identity provider", tag: "auth"},
+	"GET /auth/callback": {
+		id: "loginCallback", summary: "Complete signing in and start a session", tag: "auth",
+		status: []int{http.StatusBadRequest, http.StatusUnauthorized},
+	},
+	"POST /auth/logout": {id: "logout", summary: "End the session", tag: "auth"},
+}
+
+var pathParameter = regexp.MustCompile(`\{(\w+)\}`)
+
+// openApiDocument describes the routes of the service as configured.
+func (svc *RestApiService) openApiDocument() openapi.Document {
+	doc := openapi.Document{
+		OpenApi: openapi.Version,
+		Info: openapi.Info{
+			Title:   "Blog API",
+			Version: dto.Latest.String(),
+			Description: "Posts and comments. Every route is served under /api/v1 and /api/v2; " +
+				"the unversioned routes serve v1 unless v2 is asked for with Accept: application/vnd.blog.v2+json.",
+		},
+		Paths: make(map[string]openapi.PathItem),
+	}
+	svc.documentSecurity(&doc)
+
+	for _, route := range svc.routes() {
+		op, ok := operations[route.name]
+		if !ok {
+			continue
+		}
+		method, urlPath := documentedRoute(route)
+		if doc.Paths[urlPath] == nil {
+			doc.Paths[urlPath] = make(openapi.PathItem)
+		}
+		doc.Paths[urlPath][strings.ToLower(method)] = svc.documentOperation(&doc.Components, route, op)
+	}
+	return doc
+}
+
+// documentedRoute is the method and path of a route in the document.
+func documentedRoute(route route) (string, string) {
+	method, urlPath, _ := strings.Cut(route.pattern, " ")
+	return method, urlPath
+}
+
+func (svc *RestApiService) documentOperation(components *openapi.Components, route route, op operation) *openapi.Operation {
+	version := route.version
+	documented := &openapi.Operation{
+		OperationId: op.id,
+		Summary:     op.summary,
+		Tags:        []string{op.tag},
+		Responses:   make(map[string]*openapi.Response),
+	}
+	if version != 0 {
+		documented.OperationId += strings.ToUpper(version.String())
+	} else {
+		version = dto.V1
+	}
+	api := strings.Contains(route.pattern, " /api/")
+	if _, deprecated := svc.deprecations[version]; deprecated && api {
+		documented.Deprecated = true
+	}
+
+	// Path parameters are ids, but for slugs.
+	for _, match := range pathParameter.FindAllStringSubmatch(route.pattern, -1) {
+		schema := openapi.SchemaOf(reflect.TypeOf(uint64(0)))
+		if !strings.HasSuffix(match[1], "Id") {
+			schema = &openapi.Schema{Type: "string"}
+		}
+		documented.Parameters = append(documented.Parameters, openapi.Parameter{
+			Name: match[1], In: "path", Required: true, Schema: schema,
+		})
+	}
+	documented.Parameters = append(documented.Parameters, op.query...)
+	header := func(name string, description string) {
+		documented.Parameters = append(documented.Parameters, openapi.Parameter{
+			Name: name, In: "header", Description: description, Schema: &openapi.Schema{Type: "string"},
+		})
+	}
+	if op.conditional {
+		header("If-Match", "ETag of the resource as last seen by the client.")
+	}
+	if op.cacheable {
+		header("If-None-Match", "ETags of representations the client already has.")
+	}
+	if op.create {
+		header(IdempotencyKeyHeader, "Key under which the response is replayed to retries of the request.")
+	}
+
+	if op.request != nil {
+		mediaType := "application/json"
+		if op.requestType != "" {
+			mediaType = op.requestType
+		}
+		schema := schemaRef(components, op.request(version))
+		if op.batch {
+			maxItems := svc.batchLimit
+			schema = openapi.ArrayOf(schema)
+			schema.MaxItems = &maxItems
+		}
+		documented.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]openapi.MediaType{mediaType: {Schema: schema}},
+		}
+	}
+
+	success := &openapi.Response{Description: http.StatusText(http.StatusOK)}
+	switch {
+	case op.responseType != "":
+		schema := schemaRef(components, op.response(version))
+		success.Content = map[string]openapi.MediaType{op.responseType: {Schema: schema}}
+	case op.response != nil:
+		body := op.response(version)
+		schema := schemaRef(components, body)
+		if op.alternatives != nil {
+			schema = &openapi.Schema{AnyOf: []*openapi.Schema{schema}}
+			for _, alternative := range op.alternatives(version) {
+				schema.AnyOf = append(schema.AnyOf, schemaRef(components, alternative))
+			}
+		}
+		success.Content = make(map[string]openapi.MediaType)
+		for _, encoder := range svc.registry().Supporting(body) {
+			success.Content[encoder.MediaTypes()[0]] = openapi.MediaType{Schema: schema}
+		}
+	case api:
+		success.Content = svc.ackContent(components, version, http.StatusOK)
+	}
+	documented.Responses[strconv.Itoa(http.StatusOK)] = success
+	if op.cacheable {
+		documented.Responses[strconv.Itoa(http.StatusNotModified)] = &openapi.Response{Description: http.StatusText(http.StatusNotModified)}
+	}
+
+	status := append([]int(nil), op.status...)
+	if svc.policy != nil && api {
+		status = append(status, http.StatusUnauthorized, http.StatusForbidden)
+	}
+	if op.conditional {
+		status = append(status, http.StatusPreconditionFailed)
+		if svc.requireIfMatch {
+			status = append(status, http.StatusPreconditionRequired)
+		}
+	}
+	if op.create && (svc.idempotencyStore != nil || version != dto.V1) {
+		status = append(status, http.StatusConflict)
+	}
+	if op.create && svc.idempotencyStore != nil {
+		status = append(status, http.StatusUnprocessableEntity)
+	}
+	if svc.limiter != nil && svc.limiter.Limited(route.name) {
+		status = append(status, http.StatusTooManyRequests)
+	}
+	for _, code := range status {
+		response := &openapi.Response{Description: http.StatusText(code)}
+		if api {
+			response.Content = svc.ackContent(components, version, code)
+		}
+		documented.Responses[strconv.Itoa(code)] = response
+	}
+	return documented
+}
+
+// ackContent documents the acknowledgement written by writeAck.
+func (svc *RestApiService) ackContent(components *openapi.Components, version dto.Version, status int) map[string]openapi.MediaType {
+	if version == dto.V1 {
+		return map[string]openapi.MediaType{"application/json": {Schema: schemaRef(components, AckJsonResponse{})}}
+	}
+	ack := dto.Ack(version, status, "")
+	mediaType := "application/json"
+	if _, ok := ack.(v2.Problem); ok {
+		mediaType = "application/problem+json"
+	}
+	return map[string]openapi.MediaType{mediaType: {Schema: schemaRef(components, ack)}}
+}
+
+// schemaRef registers the schema of v as a component named after its type, suffixed with the API
+// version for all but the v1 types, and refers to it.
+func schemaRef(components *openapi.Components, v interface{}) *openapi.Schema {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice {
+		return openapi.ArrayOf(schemaRef(components, reflect.Zero(t.Elem()).Interface()))
+	}
+	name := t.Name()
+	if version, err := dto.ParseVersion(path.Base(t.PkgPath())); err == nil && version != dto.V1 {
+		name += strings.ToUpper(version.String())
+	}
+	return components.AddSchema(name, reflect.Zero(t).Interface())
+}
+
+func (svc *RestApiService) documentSecurity(doc *openapi.Document) {
+	schemes := make(map[string]*openapi.SecurityScheme)
+	for _, authenticator := range svc.authenticators {
+		if _, ok := authenticator.(*auth.ApiKeyAuthenticator); ok {
+			schemes["apiKey"] = &openapi.SecurityScheme{Type: "apiKey", In: "header", Name: auth.ApiKeyHeader}
+		}
+	}
+	if svc.oidc != nil {
+		schemes["session"] = &openapi.SecurityScheme{
+			Type: "apiKey", In: "cookie", Name: auth.SessionCookie, Description: "Session started with GET /auth/login.",
+		}
+		schemes["idToken"] = &openapi.SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}
+	}
+	if len(schemes) == 0 {
+		return
+	}
+
+	doc.Components.SecuritySchemes = schemes
+	names := make([]string, 0, len(schemes))
+	for name := range schemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		doc.Security = append(doc.Security, map[string][]string{name: {}})
+	}
+	// Anonymous callers may still read.
+	doc.Security = append(doc.Security, map[string][]string{})
+}
+
+// openApiSpec is the OpenAPI document as served, built once by NewRestApiService: the routes do not
+// change once the service is configured.
+type openApiSpec struct {
+	once sync.Once
+	data []byte
+	etag string
+	err  error
+}
+
+func (s *openApiSpec) get(svc *RestApiService) ([]byte, string, error) {
+	s.once.Do(func() {
+		s.data, s.err = json.Marshal(svc.openApiDocument())
+		s.etag = contentETag(nil, s.data)
+	})
+	return s.data, s.etag, s.err
+}
+
+func handleOpenApi(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, etag, err := svc.openApiSpec.get(svc)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag)
+		if notModified(r, etag, time.Time{}) {
+			w.Header().Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write(data)
+	}
+}
+
+// docsPage loads the Swagger UI bundled with the service, so that the documentation works offline.
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="UTF-8">
+  <title>Blog API</title>
+  <link rel="stylesheet" type="text/css" href="swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="swagger-ui-bundle.js" charset="UTF-8"></script>
+  <script src="swagger-ui-standalone-preset.js" charset="UTF-8"></script>
+  <script>
+    window.ui = SwaggerUIBundle({
+      url: "/openapi.json",
+      dom_id: "#swagger-ui",
+      presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+      layout: "StandaloneLayout"
+    });
+  </script>
+</body>
+</html>
+`
+
+func handleDocs() func(http.ResponseWriter, *http.Request) {
+	assets := http.StripPrefix("/docs/", http.FileServerFS(swaggerFiles.FS))
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/docs/" {
+			assets.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, docsPage)
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/codec"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WithRequiredIfMatch rejects updates and deletes that do not carry an If-Match header with
+// 428 Precondition Required. Without it If-Match is honored when present.
+func WithRequiredIfMatch() Option {
+	return func(svc *RestApiService) {
+		svc.requireIfMatch = true
+	}
+}
+
+// WithCacheControl sets the Cache-Control header sent with successful responses, per route pattern
+// (e.g. "GET /api/posts/{postId}": "public, max-age=60").
+func WithCacheControl(policies map[string]string) Option {
+	return func(svc *RestApiService) {
+		svc.cacheControl = policies
+	}
+}
+
+// contentETag is a strong entity tag derived from the given content, prefixed with its version when
+// the content is a single versioned entity.
+func contentETag(version *uint64, content []byte) string {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:8])
+	if version == nil {
+		return `"` + hash + `"`
+	}
+	return fmt.Sprintf(`"%d-%s"`, *version, hash)
+}
+
+func postETag(post model.Post) string {
+	data, _ := json.Marshal(post)
+	return contentETag(&post.Version, data)
+}
+
+func commentETag(comment model.Comment) string {
+	data, _ := json.Marshal(comment)
+	return contentETag(&comment.Version, data)
+}
+
+// etagMatches reports whether an If-Match header value matches etag using the strong comparison
+// required for If-Match: weak tags never match.
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagMatchesWeakly reports whether an If-None-Match header value matches etag using weak comparison.
+func etagMatchesWeakly(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch writes a 428 or 412 response when the request's If-Match header is missing (and
+// required) or does not match the current entity tag of the resource. Handlers must return
+// immediately when it reports false.
+func (svc *RestApiService) checkIfMatch(w http.ResponseWriter, r *http.Request, resource string, id uint64, version uint64, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if svc.requireIfMatch {
+			svc.writeAck(w, r, http.StatusPreconditionRequired,
+				fmt.Sprintf("If-Match header is required to modify %s with id: %d", strings.ToLower(resource), id))
+			return false
+		}
+		return true
+	}
+
+	if !etagMatches(unversionETags(svc.registry().UntagETags(header)), etag) {
+		svc.writeAck(w, r, http.StatusPreconditionFailed,
+			fmt.Sprintf("%s with id: %d has been modified, current version is %d", resource, id, version))
+		return false
+	}
+	return true
+}
+
+// writeCacheable writes v in the negotiated representation with validators and the Cache-Control
+// policy of the matched route, or 304 Not Modified when the request's If-None-Match or
+// If-Modified-Since shows the client already has it. The entity tag is that of the v1 JSON
+// representation; other versions and representations get their own. A zero lastModified omits Last-Modified.
+func (svc *RestApiService) writeCacheable(w http.ResponseWriter, r *http.Request, v interface{}, etag string, lastModified time.Time) {
+	encoder, body, ok := svc.encode(w, r, v)
+	if !ok {
+		return
+	}
+	etag = codec.TagETag(versionETag(r, etag), encoder)
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if policy, ok := svc.cacheControl[unversionedRoute(r.Pattern)]; ok {
+		w.Header().Set("Cache-Control", policy)
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// notModified evaluates If-None-Match, falling back to If-Modified-Since only when the former is absent.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return etagMatchesWeakly(header, etag)
+	}
+	if header := r.Header.Get("If-Modified-Since"); header != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(header)
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
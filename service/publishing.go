@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"net/http"
+	"time"
+)
+
+// transitions lists the statuses a post may move to from each status. Scheduled posts are published
+// by the scheduler, see scheduler.Scheduler.
+var transitions = map[model.PostStatus][]model.PostStatus{
+	model.Draft:     {model.Scheduled, model.Published},
+	model.Scheduled: {model.Draft, model.Published},
+	model.Published: {model.Archived},
+	model.Archived:  {model.Draft, model.Published},
+}
+
+type invalidTransitionError struct {
+	id       uint64
+	from, to model.PostStatus
+}
+
+func (e invalidTransitionError) Error() string {
+	return fmt.Sprintf("Post with id: %d cannot go from %s to %s", e.id, e.from, e.to)
+}
+
+var (
+	errOnlyScheduled   = errors.New("Only scheduled posts have a publishAt date")
+	errPublishAtFuture = errors.New("Scheduled posts need a publishAt date in the future")
+)
+
+func statusOf(post model.Post) model.PostStatus {
+	if post.Status == "" {
+		return model.Published
+	}
+	return post.Status
+}
+
+// initialStatus checks the status of a post being created, published when left out.
+func initialStatus(post model.Post, now time.Time) (model.Post, error) {
+	post.Status = statusOf(post)
+	switch post.Status {
+	case model.Draft, model.Scheduled, model.Published:
+	case model.Archived:
+		return post, errors.New("Posts cannot be created archived")
+	default:
+		return post, fmt.Errorf("Wrong status: %s", post.Status)
+	}
+	return post, checkPublishAt(post, post.PublishAt != nil, now)
+}
+
+// transition applies the status and publishAt date of an update to a stored post. A status left out
+// keeps the current one; leaving or entering a status drops the publishAt date unless one is given.
+func transition(existing model.Post, update model.Post, now time.Time) (model.Post, error) {
+	post := existing
+	from, to := statusOf(existing), update.Status
+	if to == "" {
+		to = from
+	}
+	if _, ok := transitions[to]; !ok {
+		return post, fmt.Errorf("Wrong status: %s", to)
+	}
+	if to != from && !containsStatus(transitions[from], to) {
+		return post, invalidTransitionError{id: existing.Id, from: from, to: to}
+	}
+
+	post.Status = to
+	if update.PublishAt != nil {
+		post.PublishAt = update.PublishAt
+	} else if to != from {
+		post.PublishAt = nil
+	}
+	return post, checkPublishAt(post, to != from || update.PublishAt != nil, now)
+}
+
+// checkPublishAt checks the publishAt date of a post whose schedule changed. Posts published by the
+// scheduler keep theirs.
+func checkPublishAt(post model.Post, changed bool, now time.Time) error {
+	if !changed {
+		return nil
+	}
+	if post.Status != model.Scheduled {
+		if post.PublishAt != nil {
+			return errOnlyScheduled
+		}
+		return nil
+	}
+	if post.PublishAt == nil || !post.PublishAt.After(now) {
+		return errPublishAtFuture
+	}
+	return nil
+}
+
+func containsStatus(statuses []model.PostStatus, status model.PostStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// visible reports whether the caller may read a post: drafts and scheduled posts are only shown to
+// those who may update them, and never to anonymous callers.
+func (svc *RestApiService) visible(r *http.Request, post model.Post) bool {
+	if statusOf(post).Public() {
+		return true
+	}
+	id := auth.FromContext(r.Context())
+	if svc.policy == nil {
+		return !id.IsAnonymous()
+	}
+	return svc.policy.Allowed(id, auth.PostsUpdate, post.Author)
+}
+
+// hiddenPost reports whether a post exists but the caller may not read it, see visible. Its comments
+// do not exist for the caller either, and cannot be answered.
+func (svc *RestApiService) hiddenPost(r *http.Request, postId uint64) bool {
+	post, err := svc.postRepository.GetById(postId)
+	return err == nil && !svc.visible(r, *post)
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/ratelimit"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// WithRateLimiter throttles the routes the limiter has a budget for.
+func WithRateLimiter(limiter *ratelimit.Limiter) Option {
+	return func(svc *RestApiService) {
+		svc.limiter = limiter
+	}
+}
+
+func (svc *RestApiService) rateLimit(route string, next http.HandlerFunc) http.HandlerFunc {
+	if svc.limiter == nil || !svc.limiter.Limited(route) {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, err := svc.limiter.Take(r.Context(), route, rateLimitClient(r))
+		if err != nil {
+			// A broken limiter store should not take the API down with it.
+			log.Printf("rate limiter unavailable, letting request through: %v", err)
+			next(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter.Seconds())))
+		if !result.Allowed {
+			retryAfter := ceilSeconds(result.RetryAfter.Seconds())
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			svc.writeAck(w, r, http.StatusTooManyRequests, fmt.Sprintf("Too many requests, retry in %d seconds", retryAfter))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// rateLimitClient keys the budget by authenticated user, then by client IP. Headers the authenticators
+// did not vouch for, such as an unknown API key, do not count: a new one on each request would make a
+// new client.
+func rateLimitClient(r *http.Request) string {
+	if id := auth.FromContext(r.Context()); !id.IsAnonymous() {
+		return "user:" + id.Subject
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func ceilSeconds(s float64) int {
+	return int(math.Ceil(s))
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/codec"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/dto"
+	v2 "gitlab.com/devskiller-tasks/rest-api-blog-golang/dto/v2"
+	"net/http"
+	"strings"
+)
+
+// WithEncoder registers an additional response representation, selected through the Accept header.
+func WithEncoder(encoder codec.Encoder) Option {
+	return func(svc *RestApiService) {
+		if svc.codecs == nil {
+			svc.codecs = codec.Default()
+		}
+		svc.codecs.Register(encoder)
+	}
+}
+
+func (svc *RestApiService) registry() *codec.Registry {
+	if svc.codecs == nil {
+		return codec.Default()
+	}
+	return svc.codecs
+}
+
+// encode negotiates the representation of v from the Accept header and encodes it. It writes a
+// 406 response and reports false when the client accepts no representation of v.
+func (svc *RestApiService) encode(w http.ResponseWriter, r *http.Request, v interface{}) (codec.Encoder, []byte, bool) {
+	encoder, ok := svc.registry().Negotiate(r.Header.Get("Accept"), v)
+	if !ok {
+		svc.writeAck(w, r, http.StatusNotAcceptable, fmt.Sprintf("Not acceptable, supported media types are: %s",
+			strings.Join(svc.registry().MediaTypes(), ", ")))
+		return nil, nil, false
+	}
+
+	var body bytes.Buffer
+	if err := encoder.Encode(&body, v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	w.Header().Set("Content-Type", encoder.ContentType())
+	w.Header().Add("Vary", "Accept")
+	return encoder, body.Bytes(), true
+}
+
+// writeAck writes an `AckJsonResponse`, or from v2 on its successor, problem details for errors.
+// Clients that accept no representation of it get JSON rather than a 406, so that the status and
+// message are never lost.
+func (svc *RestApiService) writeAck(w http.ResponseWriter, r *http.Request, status int, message string) {
+	var ack interface{} = AckJsonResponse{Message: message, Status: status}
+	if version := dto.VersionFromContext(r.Context()); version != dto.V1 {
+		ack = dto.Ack(version, status, message)
+	}
+	encoder, ok := svc.registry().Negotiate(r.Header.Get("Accept"), ack)
+	if !ok {
+		encoder = codec.JSON{}
+	}
+	contentType := encoder.ContentType()
+	if _, ok := ack.(v2.Problem); ok {
+		switch encoder.Name() {
+		case "json":
+			contentType = "application/problem+json"
+		case "xml":
+			contentType = "application/problem+xml; charset=utf-8"
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	encoder.Encode(w, ack)
+}
@@ -1,17 +1,54 @@
 package service
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/codec"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/compression"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/dto"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/idempotency"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/markup"
 	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/ratelimit"
 	"gitlab.com/devskiller-tasks/rest-api-blog-golang/repository"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/search"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/slug"
 	"net/http"
+	"net/url"
+	"path"
+	"regexp"
 	"strconv"
+	"time"
 )
 
 type RestApiService struct {
-	postRepository    *repository.PostRepository
-	commentRepository *repository.CommentRepository
+	postRepository     *repository.PostRepository
+	commentRepository  *repository.CommentRepository
+	revisionRepository *repository.RevisionRepository
+	revisionRetention  repository.RetentionPolicy
+	searchIndex        *search.Index
+	renderCache        *markup.Cache
+	renderCacheSize    int
+	policy             *auth.Policy
+	authenticators     []auth.Authenticator
+	oidc               *auth.OidcRelyingParty
+	limiter            *ratelimit.Limiter
+	idempotencyStore   idempotency.Store
+	idempotencyTtl     time.Duration
+	requireIfMatch     bool
+	cacheControl       map[string]string
+	compressionMinSize int
+	compressionCodings []string
+	codecs             *codec.Registry
+	deprecations       map[dto.Version]deprecation
+	validateRequests   bool
+	batchLimit         int
+	// reportInvalidResponse is called with responses that do not conform to the OpenAPI document.
+	reportInvalidResponse func(error)
+	openApiSpec           *openApiSpec
 }
 
 type AckJsonResponse struct {
@@ -19,38 +56,173 @@ type AckJsonResponse struct {
 	Status  int
 }
 
-func NewRestApiService() RestApiService {
-	return RestApiService{postRepository: repository.NewPostRepository(), commentRepository: repository.NewCommentRepository()}
+// WithPostRepository makes the service keep its posts in posts, e.g. to share them with a scheduler.Scheduler.
+func WithPostRepository(posts *repository.PostRepository) Option {
+	return func(svc *RestApiService) {
+		svc.postRepository = posts
+	}
+}
+
+// WithCommentRepository makes the service keep its comments in comments.
+func WithCommentRepository(comments *repository.CommentRepository) Option {
+	return func(svc *RestApiService) {
+		svc.commentRepository = comments
+	}
+}
+
+func NewRestApiService(opts ...Option) RestApiService {
+	svc := RestApiService{
+		postRepository:     repository.NewPostRepository(),
+		commentRepository:  repository.NewCommentRepository(),
+		idempotencyStore:   idempotency.NewMemoryStore(),
+		idempotencyTtl:     defaultIdempotencyTtl,
+		compressionMinSize: defaultCompressionMinSize,
+		compressionCodings: compression.Supported,
+		codecs:             codec.Default(),
+		validateRequests:   true,
+		batchLimit:         defaultBatchLimit,
+		renderCacheSize:    defaultRenderCacheSize,
+		revisionRetention:  defaultRevisionRetention,
+		openApiSpec:        &openApiSpec{},
+	}
+	for _, opt := range opts {
+		opt(&svc)
+	}
+	// The search index is rebuilt from the repositories, then follows their changes.
+	svc.searchIndex = search.New()
+	svc.searchIndex.Rebuild(svc.postRepository.GetAll(), svc.commentRepository.GetAll())
+	svc.postRepository.Listen(svc.searchIndex)
+	svc.commentRepository.Listen(svc.searchIndex)
+	svc.renderCache = markup.NewCache(svc.renderCacheSize)
+	svc.postRepository.Listen(svc.renderCache)
+	svc.revisionRepository = repository.NewRevisionRepository(svc.revisionRetention)
+	svc.openApiSpec.get(&svc)
+	return svc
+}
+
+// route is a route of the service. API routes are listed once per version, see apiVersions.
+type route struct {
+	pattern string
+	// name is the unversioned pattern under which the route is documented, rate limited and cached.
+	name string
+	// version is the API version of the route group, zero for unversioned routes.
+	version dto.Version
+	handler http.HandlerFunc
+}
+
+func (svc *RestApiService) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, route := range svc.routes() {
+		pattern, handler := muxPattern(route.pattern), route.handler
+		if revisionsRoute.MatchString(pattern) {
+			pattern, handler = revisionsRoute.ReplaceAllString(pattern, "/{postId}/{child}"), onlyChild("revisions", handler)
+		}
+		mux.HandleFunc(pattern, handler)
+	}
+	return svc.compress(svc.authenticate(mux))
+}
+
+// revisionsRoute matches the pattern listing the revisions of a post, which the mux takes to conflict
+// with GET /api/posts/by-slug/{slug}. It is registered for any child of a post instead, see onlyChild.
+var revisionsRoute = regexp.MustCompile(`/\{postId\}/revisions$`)
+
+// onlyChild serves the child of a post named, and answers 404 for the others.
+func onlyChild(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("child") != name {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// customMethod matches the custom method ending a route pattern after a wildcard, e.g. :restore.
+var customMethod = regexp.MustCompile(`\}:\w+$`)
+
+// muxPattern is the pattern of a route as registered with http.ServeMux, whose wildcards match whole
+// path segments: a custom method after a wildcard is left to the wildcard, and to the handler to check.
+func muxPattern(pattern string) string {
+	return customMethod.ReplaceAllString(pattern, "}")
+}
+
+func (svc *RestApiService) routes() []route {
+	var routes []route
+	handle := func(name string, handler http.HandlerFunc) {
+		for _, group := range apiVersions {
+			r := route{pattern: versionedRoute(name, group.prefix), name: name, version: group.version}
+			r.handler = svc.versioned(group.version, svc.validated(r, svc.rateLimit(name, handler)))
+			routes = append(routes, r)
+		}
+	}
+	// Create routes also honour the Idempotency-Key header.
+	create := func(name string, handler http.HandlerFunc) {
+		handle(name, svc.idempotent(name, handler))
+	}
+	handleUnversioned := func(name string, handler http.HandlerFunc) {
+		routes = append(routes, route{pattern: name, name: name, handler: svc.rateLimit(name, handler)})
+	}
+
+	create("POST /api/posts", handleAddPost(svc))
+	create("POST /api/posts:batch", handleAddPosts(svc))
+	handle("GET /api/posts", handleGetPosts(svc))
+	handle("GET /api/tags", handleGetTags(svc))
+	handle("GET /api/search", handleSearch(svc))
+	handle("GET /api/posts/{postId}", handleGetPostByPostId(svc))
+	handle("GET /api/posts/by-slug/{slug}", handleGetPostBySlug(svc))
+	handle("PUT /api/posts/{postId}", handleUpdatePost(svc))
+	handle("DELETE /api/posts/{postId}", handleDeletePost(svc))
+	handle("GET /api/posts/{postId}/revisions", handleGetRevisions(svc))
+	handle("GET /api/posts/{postId}/revisions/diff", handleGetRevisionDiff(svc))
+	handle("GET /api/posts/{postId}/revisions/{revision}", handleGetRevision(svc))
+	handle("POST /api/posts/{postId}/revisions/{revision}:restore", handleRestoreRevision(svc))
+	create("POST /api/comments", handleAddComment(svc))
+	create("POST /api/comments:batch", handleAddComments(svc))
+	handle("GET /api/comments", handleGetCommentsByPostId(svc))
+	handle("DELETE /api/comments/{commentId}", handleDeleteComment(svc))
+	handle("POST /api/comments/{commentId}/hide", handleSetCommentHidden(svc, true))
+	handle("POST /api/comments/{commentId}/unhide", handleSetCommentHidden(svc, false))
+	handle("GET /api/admin/export", handleExport(svc))
+	handle("POST /api/admin/import", handleImport(svc))
+	handleUnversioned("GET /openapi.json", handleOpenApi(svc))
+	handleUnversioned("GET /docs/", handleDocs())
+	if svc.oidc != nil {
+		handleUnversioned("GET /auth/login", handleLogin(svc))
+		handleUnversioned("GET /auth/callback", handleLoginCallback(svc))
+		handleUnversioned("POST /auth/logout", handleLogout(svc))
+	}
+	return routes
 }
 
 func (svc *RestApiService) ServeContent(port int) error {
-	http.HandleFunc("POST /api/posts", handleAddPost(svc))
-	http.HandleFunc("GET /api/posts/{postId}", handleGetPostByPostId(svc))
-	http.HandleFunc("POST /api/comments", handleAddComment(svc))
-	http.HandleFunc("GET /api/comments", handleGetCommentsByPostId(svc))
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+	return http.ListenAndServe(fmt.Sprintf(":%d", port), svc.Handler())
 }
 
 func handleAddPost(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var post model.Post
-		if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
-			http.Error(w, "400 Bad Request", http.StatusBadRequest)
+		if !svc.authorize(w, r, auth.PostsCreate, "") {
 			return
 		}
-		if err := svc.postRepository.Insert(post); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		post, err := dto.DecodeCreatePost(dto.VersionFromContext(r.Context()), r.Body)
+		if err != nil {
+			http.Error(w, "400 Bad Request", http.StatusBadRequest)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		data, err := json.Marshal(&AckJsonResponse{Message: fmt.Sprintf("Post with id: %d successfully added", post.Id), Status: http.StatusOK})
+		post, err = newPost(r, post)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			svc.writeAck(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, err := svc.postRepository.GetById(post.Id); err == nil {
+			svc.writeAck(w, r, conflictStatus(r), fmt.Sprintf("Post with id: %d already exists", post.Id))
 			return
 		}
-		if _, err := w.Write(data); err != nil {
+		if err := svc.postRepository.Insert(post); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
+		svc.created(post)
+		svc.writeAck(w, r, http.StatusOK, fmt.Sprintf("Post with id: %d successfully added", post.Id))
 	}
 }
 
@@ -58,51 +230,178 @@ func handleGetPostByPostId(svc *RestApiService) func(http.ResponseWriter, *http.
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Example: GET /api/posts/42
 
-		// Every response should have the Content-Type=application/json header set.
-		w.Header().Set("Content-Type", "application/json")
+		// Every response has the Content-Type of the representation negotiated from the Accept header,
+		// application/json by default.
+		if !svc.authorize(w, r, auth.PostsRead, "") {
+			return
+		}
 
 		// If an invalid ID is given, the response should be in the format of `AckJsonResponse` with a status of 400 and a message:
 		// { "Message": "Wrong id path variable: PATH_VARIABLE", "Status": 400 }
 		// The HTTP response code should also be set to 400.
-		var postId uint64
-		_, err := fmt.Sscanf(r.URL.Path, "/api/posts/%d", &postId)
+		postId, err := strconv.ParseUint(r.PathValue("postId"), 10, 64)
 		if err != nil {
-			resp := AckJsonResponse{
-				Message: fmt.Sprintf("Wrong id path variable: %s", r.URL.Path),
-				Status:  http.StatusBadRequest,
-			}
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(resp)
+			svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Wrong id path variable: %s", r.URL.Path))
 			return
 		}
 
 		// If the given postID does not exist, the response should be in the format of `AckJsonResponse` with a status of 404 and a message:
 		// { "Message": "Post with id: [POST_ID] does not exist", "Status": 404 }
 		// The HTTP response code should also be set to 404.
+		// Drafts and scheduled posts do not exist for callers who may not update them.
 		post, err := svc.postRepository.GetById(postId)
-		if err != nil {
-			resp := AckJsonResponse{
-				Message: fmt.Sprintf("Post with id: %d does not exist", postId),
-				Status:  http.StatusNotFound,
-			}
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(resp)
+		if err != nil || !svc.visible(r, *post) {
+			svc.writeAck(w, r, http.StatusNotFound, fmt.Sprintf("Post with id: %d does not exist", postId))
 			return
 		}
 
 		// If the post with the given ID exists, the response should be a valid JSON representation of the post entity:
 		// { "Id": 2, "Title": "test title", "Content": "this is a post content", "CreationDate": "1970-01-01T03:46:40+01:00" }
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(post)
+		// The ETag header is to be sent back in If-Match when updating or deleting the post, and in
+		// If-None-Match to get 304 Not Modified while the post is unchanged.
+		svc.writePost(w, r, *post)
+	}
+}
+
+func handleGetPostBySlug(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: GET /api/posts/by-slug/hello-world
+		if !svc.authorize(w, r, auth.PostsRead, "") {
+			return
+		}
+
+		post, err := svc.postRepository.GetBySlug(r.PathValue("slug"))
+		if err != nil || !svc.visible(r, *post) {
+			svc.writeAck(w, r, http.StatusNotFound, fmt.Sprintf("Post with slug: %s does not exist", r.PathValue("slug")))
+			return
+		}
+
+		// Former slugs of a post, from before its title was edited, permanently redirect to its current slug.
+		if post.Slug != r.PathValue("slug") {
+			w.Header().Set("Location", path.Join(path.Dir(r.URL.Path), url.PathEscape(post.Slug)))
+			w.WriteHeader(http.StatusMovedPermanently)
+			return
+		}
+		svc.writePost(w, r, *post)
+	}
+}
+
+// writePost writes the representation of a post, along with its ETag and Last-Modified headers, and
+// its rendered content when asked for with the contentHtml query parameter.
+func (svc *RestApiService) writePost(w http.ResponseWriter, r *http.Request, post model.Post) {
+	posts := []model.Post{post}
+	if !svc.withContentHtml(w, r, posts) {
+		return
+	}
+	post = posts[0]
+	lastModified := post.CreationDate
+	if post.ModificationDate.After(lastModified) {
+		lastModified = post.ModificationDate
+	}
+	svc.writeCacheable(w, r, dto.Post(dto.VersionFromContext(r.Context()), post), postETag(post), lastModified)
+}
+
+// defaultPostLimit and maxPostLimit bound the pages of GET /api/posts.
+const (
+	defaultPostLimit = 50
+	maxPostLimit     = 200
+)
+
+func handleGetPosts(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: GET /api/posts?tag=go&category=backend
+
+		// Every response has the Content-Type of the representation negotiated from the Accept header,
+		// application/json by default.
+		if !svc.authorize(w, r, auth.PostsRead, "") {
+			return
+		}
+
+		// The response is a JSON array of posts, ordered by id; an empty list when there are none.
+		// The tag and category query parameters select the posts tagged with, or filed under, the given name.
+		// Posts come in pages of `limit` posts, 50 by default and at most 200, and the Link header of every
+		// page but the last points at the next one:
+		// Link: </api/posts?cursor=CURSOR>; rel="next"
+		query := r.URL.Query()
+		limit, after, err := postPage(query)
+		if err != nil {
+			svc.writeAck(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		var filter repository.PostFilter
+		for _, param := range []struct {
+			name  string
+			value *string
+		}{{"tag", &filter.Tag}, {"category", &filter.Category}} {
+			if raw := query.Get(param.name); raw != "" {
+				normalized, err := normalizeTag(raw)
+				if err != nil {
+					svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Wrong %s query parameter: %s", param.name, raw))
+					return
+				}
+				*param.value = normalized
+			}
+		}
+		posts := make([]model.Post, 0)
+		for _, post := range svc.postRepository.Find(filter) {
+			if post.Id <= after || !svc.visible(r, post) {
+				continue
+			}
+			if len(posts) == limit {
+				addNextLink(w, r, "cursor", encodePostCursor(posts[len(posts)-1].Id))
+				break
+			}
+			posts = append(posts, post)
+		}
+		if !svc.withContentHtml(w, r, posts) {
+			return
+		}
+
+		// The ETag is derived from the listed posts, so it changes whenever one is added, updated or deleted.
+		// Last-Modified is left out: deleting a post would not move it forward.
+		data, err := json.Marshal(posts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		svc.writeCacheable(w, r, dto.Posts(dto.VersionFromContext(r.Context()), posts), contentETag(nil, data), time.Time{})
+	}
+}
+
+// postPage reads the size of a page of posts, and the id of the post it follows, from the query parameters.
+func postPage(values url.Values) (limit int, after uint64, err error) {
+	limit = defaultPostLimit
+	if value := values.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxPostLimit {
+			return 0, 0, fmt.Errorf("Wrong limit query parameter: %s", value)
+		}
+	}
+	if value := values.Get("cursor"); value != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(value)
+		if err == nil {
+			after, err = strconv.ParseUint(string(raw), 10, 64)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("Wrong cursor query parameter: %s", value)
+		}
 	}
+	return limit, after, nil
+}
+
+// encodePostCursor makes an opaque cursor query parameter of the id of the last post of a page.
+func encodePostCursor(id uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(id, 10)))
 }
 
 func handleGetCommentsByPostId(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Example: GET /api/comments?postId=4
 
-		// Every response should have the Content-Type=application/json header set.
-		w.Header().Set("Content-Type", "application/json")
+		// Every response has the Content-Type of the representation negotiated from the Accept header,
+		// application/json by default.
+		if !svc.authorize(w, r, auth.CommentsRead, "") {
+			return
+		}
 
 		// If an invalid ID is given, the response should be in the format of `AckJsonResponse` with a status of 400 and a message:
 		// { "Message": "Wrong id path variable: PATH_VARIABLE", "Status": 400 }
@@ -110,12 +409,7 @@ func handleGetCommentsByPostId(svc *RestApiService) func(http.ResponseWriter, *h
 		query := r.URL.Query()
 		postIdStr := query.Get("postId")
 		if postIdStr == "" {
-			resp := AckJsonResponse{
-				Message: "Wrong id path variable: postId is missing",
-				Status:  http.StatusBadRequest,
-			}
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(resp)
+			svc.writeAck(w, r, http.StatusBadRequest, "Wrong id path variable: postId is missing")
 			return
 		}
 
@@ -123,16 +417,71 @@ func handleGetCommentsByPostId(svc *RestApiService) func(http.ResponseWriter, *h
 		// If there are no comments for the given postId, the response should be an empty list.
 		postId, err := strconv.ParseUint(postIdStr, 10, 64)
 		if err != nil {
-			resp := AckJsonResponse{
-				Message: fmt.Sprintf("Wrong id path variable: %s", postIdStr),
-				Status:  http.StatusBadRequest,
-			}
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(resp)
+			svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Wrong id path variable: %s", postIdStr))
+			return
+		}
+
+		// The comments of drafts and scheduled posts are as missing as the posts, see handleGetPostByPostId.
+		if svc.hiddenPost(r, postId) {
+			svc.writeAck(w, r, http.StatusNotFound, fmt.Sprintf("Post with id: %d does not exist", postId))
+			return
+		}
+
+		// The comments are listed flat by default; with view=tree, replies are nested under their parents.
+		view := query.Get("view")
+		if view != "" && view != viewFlat && view != viewTree {
+			svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Wrong view query parameter: %s", view))
+			return
+		}
+
+		// With commentHtml=true, comments also come rendered to sanitized HTML, see markup.RenderComment.
+		renderHtml, ok := svc.htmlRequested(w, r, "commentHtml")
+		if !ok {
 			return
 		}
 
-		comments := svc.commentRepository.GetAllByPostId(postId)
+		// Comments hidden by moderators are never shown to readers.
+		// The flat view is paginated: comments come in pages of `limit` comments, 50 by default and at most
+		// 200, and the Link header of every page but the last points at the next one:
+		// Link: </api/comments?postId=4&cursor=CURSOR>; rel="next"
+		// Comments are listed oldest first unless sort=newest is given, and may be filtered by author and by
+		// their creation date with since (inclusive) and until (exclusive).
+		var (
+			body         interface{}
+			listed       interface{}
+			lastModified = svc.commentRepository.LastModifiedByPostId(postId)
+		)
+		version := dto.VersionFromContext(r.Context())
+		if view == viewTree {
+			for _, name := range commentListingParameters {
+				if query.Has(name) {
+					svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("The tree view does not take the %s query parameter", name))
+					return
+				}
+			}
+			all := svc.commentRepository.GetAllByPostId(postId)
+			tree := commentTree(all)
+			if renderHtml {
+				renderCommentTree(tree)
+			}
+			listed, body = tree, dto.CommentTree(version, tree)
+			lastModified = latestComment(all, lastModified)
+		} else {
+			listing, err := commentQuery(query, postId)
+			if err != nil {
+				svc.writeAck(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			page := svc.commentRepository.Find(listing)
+			if page.Next != nil {
+				addNextLink(w, r, "cursor", encodeCursor(*page.Next))
+			}
+			if renderHtml {
+				renderComments(page.Comments)
+			}
+			listed, body = page.Comments, dto.Comments(version, page.Comments)
+			lastModified = latestComment(page.Comments, lastModified)
+		}
 
 		// Example JSON response:
 		// [
@@ -140,9 +489,13 @@ func handleGetCommentsByPostId(svc *RestApiService) func(http.ResponseWriter, *h
 		//     {"Id": 3, "PostId": 101, "Comment": "comment2", "Author": "author4", "CreationDate": "1970-01-01T03:46:40+01:10"},
 		//     {"Id": 5, "PostId": 101, "Comment": "comment3", "Author": "author13", "CreationDate": "1970-01-01T03:46:40+01:15"}
 		// ]
-
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(comments)
+		// The ETag is derived from the listed comments, so it changes whenever one is added, removed or hidden.
+		data, err := json.Marshal(listed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		svc.writeCacheable(w, r, body, contentETag(nil, data), lastModified)
 	}
 }
 
@@ -152,8 +505,11 @@ func handleAddComment(svc *RestApiService) func(http.ResponseWriter, *http.Reque
 		// POST /api/comments
 		// { "Id": 1, "PostId": 101, "Comment": "comment1", "Author": "author1", "CreationDate": "1970-01-01T03:46:40+01:00" }
 
-		// Every response should have the Content-Type=application/json header set.
-		w.Header().Set("Content-Type", "application/json")
+		// Every response has the Content-Type of the representation negotiated from the Accept header,
+		// application/json by default.
+		if !svc.authorize(w, r, auth.CommentsCreate, "") {
+			return
+		}
 
 		// If invalid or incomplete data is posted, the response should be in the format of `AckJsonResponse` with a status code of 400 and a message:
 		// { "Message": "Could not deserialize comment JSON payload", "Status": 400 }
@@ -164,31 +520,33 @@ func handleAddComment(svc *RestApiService) func(http.ResponseWriter, *http.Reque
 		// { "weird_payload": "weird value" }
 		// Response:
 		// { "Message": "Could not deserialize comment JSON payload", "Status": 400 }
-		var comment model.Comment
-		if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
-			resp := AckJsonResponse{
-				Message: "Could not deserialize comment JSON payload",
-				Status:  http.StatusBadRequest,
-			}
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(resp)
+		comment, err := dto.DecodeCreateComment(dto.VersionFromContext(r.Context()), r.Body)
+		if err != nil {
+			svc.writeAck(w, r, http.StatusBadRequest, "Could not deserialize comment JSON payload")
+			return
+		}
+
+		// The text and author are normalized before they are checked and stored, see normalizeComment.
+		// Comments longer than 5000 characters, or with authors longer than 100, are rejected with 400:
+		// { "Message": "Comment is 5001 characters long, at most 5000 are allowed", "Status": 400 }
+		if comment, err = normalizeComment(comment); err != nil {
+			svc.writeAck(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		// If a comment with the given ID already exists in the database, the response should be in the format of `AckJsonResponse` with a status code of 400 and a message:
+		// If a comment with the given ID already exists in the database, the response should be in the format of `AckJsonResponse` with a status code of 400 (409 from v2 on) and a message:
 		// { "Message": "Comment with id: COMMENT_ID already exists", "Status": 400 }
 		// Example:
 		// POST /api/comments
 		// { "Id": 30, "PostId": 23123, "Comment": "comment1", "Author": "author1", "CreationDate": "1970-01-01T03:46:40+01:00" }
 		// Response:
 		// { "Message": "Comment with id: 30 already exists", "Status": 400 }
-		if comment.Id == 0 || comment.PostId == 0 || comment.Comment == "" || comment.Author == "" || comment.CreationDate.IsZero() {
-			resp := AckJsonResponse{
-				Message: "Could not deserialize comment JSON payload",
-				Status:  http.StatusBadRequest,
-			}
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(resp)
+		if !complete(comment) {
+			svc.writeAck(w, r, http.StatusBadRequest, "Could not deserialize comment JSON payload")
+			return
+		}
+		if svc.hiddenPost(r, comment.PostId) {
+			svc.writeAck(w, r, http.StatusNotFound, fmt.Sprintf("Post with id: %d does not exist", comment.PostId))
 			return
 		}
 
@@ -200,25 +558,276 @@ func handleAddComment(svc *RestApiService) func(http.ResponseWriter, *http.Reque
 		// Response:
 		// { "Message": "Comment with id: 123 successfully added", "Status": 200 }
 		if _, err := svc.commentRepository.GetById(comment.Id); err == nil {
-			resp := AckJsonResponse{
-				Message: fmt.Sprintf("Comment with id: %d already exists", comment.Id),
-				Status:  http.StatusBadRequest,
-			}
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(resp)
+			svc.writeAck(w, r, conflictStatus(r), fmt.Sprintf("Comment with id: %d already exists", comment.Id))
+			return
+		}
+
+		// Replies name the comment they answer with ParentId, which must be on the same post and not
+		// nested too deep, otherwise the response has a status of 400:
+		// { "Message": "Parent comment with id: 7 belongs to another post", "Status": 400 }
+		if err := checkParent(comment, svc.storedComment); err != nil {
+			svc.writeAck(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		if err := svc.commentRepository.Insert(comment); err != nil {
+		if err := svc.commentRepository.Insert(newComment(comment)); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		resp := AckJsonResponse{
-			Message: fmt.Sprintf("Comment with id: %d successfully added", comment.Id),
-			Status:  http.StatusOK,
+		svc.writeAck(w, r, http.StatusOK, fmt.Sprintf("Comment with id: %d successfully added", comment.Id))
+	}
+}
+
+// newPost is a post as created by the caller: posts are owned by whoever created them, and only admins
+// may create posts on behalf of others. Invalid tags and statuses are reported.
+func newPost(r *http.Request, post model.Post) (model.Post, error) {
+	if id := auth.FromContext(r.Context()); !id.IsAnonymous() && (id.Role != auth.RoleAdmin || post.Author == "") {
+		post.Author = id.Subject
+	}
+	post.Version = 0
+	post.Slug = slug.Make(post.Title)
+	post, err := normalizeTags(post)
+	if err != nil {
+		return post, err
+	}
+	if err := checkContentFormat(post); err != nil {
+		return post, err
+	}
+	return initialStatus(post, time.Now())
+}
+
+// complete reports whether a posted comment has every member property of the model.
+func complete(comment model.Comment) bool {
+	return comment.Id != 0 && comment.PostId != 0 && comment.Comment != "" && comment.Author != "" && !comment.CreationDate.IsZero()
+}
+
+// latestComment returns the latest creation date of the comments, or since when that is later.
+func latestComment(comments []model.Comment, since time.Time) time.Time {
+	for _, comment := range comments {
+		if comment.CreationDate.After(since) {
+			since = comment.CreationDate
+		}
+	}
+	return since
+}
+
+// storedComment looks a comment up in the repository.
+func (svc *RestApiService) storedComment(id uint64) (model.Comment, bool) {
+	comment, err := svc.commentRepository.GetById(id)
+	if err != nil {
+		return model.Comment{}, false
+	}
+	return *comment, true
+}
+
+// newComment is a comment as created: only moderators may hide comments, see handleSetCommentHidden.
+func newComment(comment model.Comment) model.Comment {
+	comment.Hidden = false
+	comment.Version = 0
+	return comment
+}
+
+func handleUpdatePost(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example:
+		// PUT /api/posts/42
+		// { "Title": "new title", "Content": "new content" }
+		// Only Title, Content, Tags, Category, Status and ContentFormat are updated; Id, Author and
+		// CreationDate are kept.
+		// Status changes must follow the publishing workflow, see transitions.
+		// An If-Match header with the ETag of the post is honored: when the post has been modified since,
+		// the response is 412 Precondition Failed.
+		if !svc.authorizeAction(w, r, auth.PostsUpdate) {
+			return
+		}
+		postId, err := strconv.ParseUint(r.PathValue("postId"), 10, 64)
+		if err != nil {
+			svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Wrong id path variable: %s", r.PathValue("postId")))
+			return
+		}
+
+		update, err := dto.DecodeUpdatePost(dto.VersionFromContext(r.Context()), r.Body)
+		if err != nil || update.Title == "" || update.Content == "" {
+			svc.writeAck(w, r, http.StatusBadRequest, "Could not deserialize post JSON payload")
+			return
+		}
+
+		existing, err := svc.postRepository.GetById(postId)
+		if err != nil {
+			svc.writeAck(w, r, http.StatusNotFound, fmt.Sprintf("Post with id: %d does not exist", postId))
+			return
+		}
+		if !svc.authorize(w, r, auth.PostsUpdate, existing.Author) {
+			return
+		}
+		if !svc.checkIfMatch(w, r, "Post", postId, existing.Version, postETag(*existing)) {
+			return
+		}
+
+		post := *existing
+		if update.Title != existing.Title {
+			// The former slug keeps leading to the post, see handleGetPostBySlug.
+			post.Slug = slug.Make(update.Title)
+		}
+		post.Title = update.Title
+		post.Content = update.Content
+		if update.Tags != nil {
+			post.Tags = update.Tags
+		}
+		if update.Category != "" {
+			post.Category = update.Category
+		}
+		if update.ContentFormat != "" {
+			post.ContentFormat = update.ContentFormat
+		}
+		if post, err = normalizeTags(post); err != nil {
+			svc.writeAck(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err = checkContentFormat(post); err != nil {
+			svc.writeAck(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if post, err = transition(post, update, time.Now()); err != nil {
+			var invalid invalidTransitionError
+			if errors.As(err, &invalid) {
+				svc.writeAck(w, r, conflictStatus(r), err.Error())
+			} else {
+				svc.writeAck(w, r, http.StatusBadRequest, err.Error())
+			}
+			return
+		}
+		post.ModificationDate = time.Now().UTC()
+		// Every update makes a revision of the post, see handleGetRevisions.
+		svc.baseline(*existing)
+		updated, err := svc.postRepository.Update(post)
+		if err != nil {
+			svc.writeRepositoryError(w, r, err)
+			return
+		}
+		svc.revisionRepository.Add(newRevision(*updated, editor(r), updated.ModificationDate))
+
+		w.Header().Set("ETag", versionETag(r, postETag(*updated)))
+		svc.writeAck(w, r, http.StatusOK, fmt.Sprintf("Post with id: %d successfully updated", postId))
+	}
+}
+
+func handleDeletePost(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: DELETE /api/posts/42
+		// Deleting a post also deletes all of its comments and revisions.
+		if !svc.authorizeAction(w, r, auth.PostsDelete) {
+			return
+		}
+		postId, err := strconv.ParseUint(r.PathValue("postId"), 10, 64)
+		if err != nil {
+			svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Wrong id path variable: %s", r.PathValue("postId")))
+			return
+		}
+
+		existing, err := svc.postRepository.GetById(postId)
+		if err != nil {
+			svc.writeAck(w, r, http.StatusNotFound, fmt.Sprintf("Post with id: %d does not exist", postId))
+			return
+		}
+		if !svc.authorize(w, r, auth.PostsDelete, existing.Author) {
+			return
+		}
+		if !svc.checkIfMatch(w, r, "Post", postId, existing.Version, postETag(*existing)) {
+			return
+		}
+
+		if err := svc.postRepository.Delete(postId, existing.Version); err != nil {
+			svc.writeRepositoryError(w, r, err)
+			return
+		}
+		for _, comment := range svc.commentRepository.GetAllByPostId(postId) {
+			svc.commentRepository.Delete(comment.Id, repository.AnyVersion)
+		}
+		svc.revisionRepository.DeleteByPostId(postId)
+
+		svc.writeAck(w, r, http.StatusOK, fmt.Sprintf("Post with id: %d successfully deleted", postId))
+	}
+}
+
+func handleDeleteComment(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: DELETE /api/comments/7
+		if !svc.authorize(w, r, auth.CommentsDelete, "") {
+			return
+		}
+
+		commentId, err := strconv.ParseUint(r.PathValue("commentId"), 10, 64)
+		if err != nil {
+			svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Wrong id path variable: %s", r.PathValue("commentId")))
+			return
+		}
+
+		existing, err := svc.commentRepository.GetById(commentId)
+		if err != nil {
+			svc.writeRepositoryError(w, r, err)
+			return
+		}
+		if !svc.checkIfMatch(w, r, "Comment", commentId, existing.Version, commentETag(*existing)) {
+			return
+		}
+
+		if err := svc.commentRepository.Delete(commentId, existing.Version); err != nil {
+			svc.writeRepositoryError(w, r, err)
+			return
+		}
+
+		svc.writeAck(w, r, http.StatusOK, fmt.Sprintf("Comment with id: %d successfully deleted", commentId))
+	}
+}
+
+func handleSetCommentHidden(svc *RestApiService, hidden bool) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: POST /api/comments/7/hide
+		// Hidden comments stay in the repository but are left out of GET /api/comments.
+		if !svc.authorize(w, r, auth.CommentsHide, "") {
+			return
+		}
+
+		commentId, err := strconv.ParseUint(r.PathValue("commentId"), 10, 64)
+		if err != nil {
+			svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Wrong id path variable: %s", r.PathValue("commentId")))
+			return
+		}
+
+		existing, err := svc.commentRepository.GetById(commentId)
+		if err != nil {
+			svc.writeRepositoryError(w, r, err)
+			return
+		}
+		if !svc.checkIfMatch(w, r, "Comment", commentId, existing.Version, commentETag(*existing)) {
+			return
+		}
+
+		updated, err := svc.commentRepository.SetHidden(commentId, hidden, existing.Version)
+		if err != nil {
+			svc.writeRepositoryError(w, r, err)
+			return
+		}
+		w.Header().Set("ETag", versionETag(r, commentETag(*updated)))
+
+		verb := "hidden"
+		if !hidden {
+			verb = "unhidden"
 		}
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(resp)
+		svc.writeAck(w, r, http.StatusOK, fmt.Sprintf("Comment with id: %d successfully %s", commentId, verb))
+	}
+}
+
+// writeRepositoryError maps the errors returned by the repositories onto the response status.
+func (svc *RestApiService) writeRepositoryError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err.(type) {
+	case repository.PostNotFoundError, repository.CommentNotFoundError:
+		svc.writeAck(w, r, http.StatusNotFound, err.Error())
+	case repository.PostVersionMismatchError, repository.CommentVersionMismatchError:
+		svc.writeAck(w, r, http.StatusPreconditionFailed, err.Error())
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
@@ -2,15 +2,31 @@ package service
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth/oidctest"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/compression"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/config"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/dto"
 	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/ratelimit"
 	"gitlab.com/devskiller-tasks/rest-api-blog-golang/repository"
 	"io"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -44,7 +60,8 @@ func TestAddPost(t *testing.T) {
 			data, _ := json.Marshal(tc.post)
 			req := httptest.NewRequest(http.MethodPost, "/api/posts", bytes.NewReader(data))
 			w := httptest.NewRecorder()
-			svc := RestApiService{&tc.postRepository, &tc.commentRepository}
+			svc := RestApiService{postRepository: &tc.postRepository, commentRepository: &tc.commentRepository,
+				revisionRepository: repository.NewRevisionRepository(defaultRevisionRetention)}
 
 			// WHEN
 			handleAddPost(&svc)(w, req)
@@ -217,6 +234,2368 @@ func TestGetPost(t *testing.T) {
 			assert.Equal(t, tc.expectedHttpStatus, response.StatusCode)
 			assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
 			assert.Equal(t, tc.expectedResponse, post)
+			assert.Equal(t, postETag(validPost), response.Header.Get("ETag"))
 		})
 	}
 }
+
+var rbacApiKeys = []config.ApiKeyConfig{
+	{Key: "alice-key", Subject: "alice", Role: string(auth.RoleAuthor)},
+	{Key: "mod-key", Subject: "mod", Role: string(auth.RoleModerator)},
+	{Key: "admin-key", Subject: "root", Role: string(auth.RoleAdmin)},
+}
+
+func newRbacTestService(opts ...Option) *RestApiService {
+	postRepository := repository.CustomPostRepository([]model.Post{
+		{Id: 1, Title: "alice's post", Content: "content", Author: "alice", CreationDate: testDate},
+		{Id: 2, Title: "bob's post", Content: "content", Author: "bob", CreationDate: testDate},
+	})
+	commentRepository := repository.CustomCommentRepository([]model.Comment{
+		{Id: 10, PostId: 1, Comment: "comment", Author: "reader", CreationDate: testDate},
+	})
+	svc := NewRestApiService(append([]Option{
+		WithPolicy(auth.DefaultPolicy()),
+		WithAuthenticators(auth.NewApiKeyAuthenticator(rbacApiKeys)),
+	}, opts...)...)
+	svc.postRepository = &postRepository
+	svc.commentRepository = &commentRepository
+	return &svc
+}
+
+func TestRbacRoutes(t *testing.T) {
+	newPost := `{"Id": 3, "Title": "t", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"}`
+	newComment := `{"Id": 11, "PostId": 1, "Comment": "c", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z"}`
+	update := `{"Title": "new title", "Content": "new content"}`
+
+	routes := []struct {
+		method string
+		path   string
+		body   string
+		// expected HTTP status for anonymous, author (alice), moderator and admin callers
+		expected [4]int
+	}{
+		{http.MethodGet, "/api/posts", "", [4]int{200, 200, 200, 200}},
+		{http.MethodGet, "/api/posts/1", "", [4]int{200, 200, 200, 200}},
+		{http.MethodPost, "/api/posts", newPost, [4]int{401, 200, 403, 200}},
+		{http.MethodPut, "/api/posts/1", update, [4]int{401, 200, 403, 200}},
+		{http.MethodPut, "/api/posts/2", update, [4]int{401, 403, 403, 200}},
+		{http.MethodDelete, "/api/posts/1", "", [4]int{401, 200, 403, 200}},
+		{http.MethodDelete, "/api/posts/2", "", [4]int{401, 403, 403, 200}},
+		{http.MethodPut, "/api/posts/99", update, [4]int{401, 404, 403, 404}},
+		{http.MethodPut, "/api/posts/1", `{"Title": 1}`, [4]int{401, 400, 403, 400}},
+		{http.MethodDelete, "/api/posts/99", "", [4]int{401, 404, 403, 404}},
+		{http.MethodGet, "/api/comments?postId=1", "", [4]int{200, 200, 200, 200}},
+		{http.MethodPost, "/api/comments", newComment, [4]int{200, 200, 200, 200}},
+		{http.MethodDelete, "/api/comments/10", "", [4]int{401, 403, 200, 200}},
+		{http.MethodPost, "/api/comments/10/hide", "", [4]int{401, 403, 200, 200}},
+		{http.MethodPost, "/api/comments/10/unhide", "", [4]int{401, 403, 200, 200}},
+		{http.MethodGet, "/api/posts/1/revisions", "", [4]int{401, 200, 403, 200}},
+		{http.MethodGet, "/api/posts/2/revisions/1", "", [4]int{401, 403, 403, 200}},
+		{http.MethodPost, "/api/posts/1/revisions/1:restore", "", [4]int{401, 200, 403, 200}},
+		{http.MethodPost, "/api/posts/2/revisions/1:restore", "", [4]int{401, 403, 403, 200}},
+		{http.MethodGet, "/api/posts/99/revisions", "", [4]int{401, 404, 403, 404}},
+	}
+	roles := []struct {
+		name   string
+		apiKey string
+	}{
+		{"anonymous", ""},
+		{"author", "alice-key"},
+		{"moderator", "mod-key"},
+		{"admin", "admin-key"},
+	}
+
+	for _, route := range routes {
+		for i, role := range roles {
+			t.Run(fmt.Sprintf("%s %s as %s", route.method, route.path, role.name), func(t *testing.T) {
+				// GIVEN
+				svc := newRbacTestService(WithResponseValidation(func(err error) { t.Error(err) }))
+				req := httptest.NewRequest(route.method, route.path, bytes.NewReader([]byte(route.body)))
+				if role.apiKey != "" {
+					req.Header.Set(auth.ApiKeyHeader, role.apiKey)
+				}
+				w := httptest.NewRecorder()
+
+				// WHEN
+				svc.Handler().ServeHTTP(w, req)
+
+				// THEN
+				assert.Equal(t, route.expected[i], w.Result().StatusCode)
+			})
+		}
+	}
+}
+
+func TestRbacInvalidApiKey(t *testing.T) {
+	svc := newRbacTestService()
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/1", nil)
+	req.Header.Set(auth.ApiKeyHeader, "bogus")
+	w := httptest.NewRecorder()
+
+	svc.Handler().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+}
+
+func TestAddPostSetsAuthor(t *testing.T) {
+	svc := newRbacTestService()
+	req := httptest.NewRequest(http.MethodPost, "/api/posts",
+		bytes.NewReader([]byte(`{"Id": 3, "Title": "t", "Content": "c", "Author": "bob"}`)))
+	req.Header.Set(auth.ApiKeyHeader, "alice-key")
+	w := httptest.NewRecorder()
+
+	svc.Handler().ServeHTTP(w, req)
+
+	post, err := svc.postRepository.GetById(3)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", post.Author)
+}
+
+func TestHiddenCommentsAreNotListed(t *testing.T) {
+	svc := newRbacTestService()
+	svc.commentRepository.SetHidden(10, true, repository.AnyVersion)
+	req := httptest.NewRequest(http.MethodGet, "/api/comments?postId=1", nil)
+	w := httptest.NewRecorder()
+
+	svc.Handler().ServeHTTP(w, req)
+
+	body, _ := io.ReadAll(w.Result().Body)
+	assert.JSONEq(t, "[]", string(body))
+}
+
+func TestOidcLogin(t *testing.T) {
+	// GIVEN
+	provider := oidctest.NewProvider("blog", "secret")
+	defer provider.Close()
+	provider.SetUser(map[string]interface{}{"sub": "alice", "groups": []string{"blog-authors"}})
+
+	svc := newRbacTestService()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		svc.Handler().ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	rp, err := auth.NewOidcRelyingParty(context.Background(), config.OidcConfig{
+		Issuer:       provider.Issuer(),
+		ClientId:     "blog",
+		ClientSecret: "secret",
+		RedirectUrl:  server.URL + "/auth/callback",
+		RoleClaim:    "groups",
+		RoleMappings: []config.RoleMapping{{Value: "blog-authors", Role: "author"}},
+	})
+	assert.NoError(t, err)
+	WithOidc(rp)(svc)
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	// WHEN
+	response, err := client.Get(server.URL + "/auth/login")
+	assert.NoError(t, err)
+	var ack AckJsonResponse
+	json.NewDecoder(response.Body).Decode(&ack)
+
+	// THEN
+	assert.Equal(t, AckJsonResponse{Message: "Logged in as alice with role author", Status: http.StatusOK}, ack)
+
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/api/posts/1", strings.NewReader(`{"Title": "t", "Content": "c"}`))
+	response, err = client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	req, _ = http.NewRequest(http.MethodPut, server.URL+"/api/posts/2", strings.NewReader(`{"Title": "t", "Content": "c"}`))
+	response, err = client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+}
+
+func TestRateLimitedComments(t *testing.T) {
+	// GIVEN
+	limiter, _ := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), map[string]ratelimit.Limit{
+		"POST /api/comments": {Requests: 2, Per: time.Minute},
+	})
+	svc := NewRestApiService(WithRateLimiter(limiter))
+	handler := svc.Handler()
+	post := func(commentId int, remoteAddr string) *http.Response {
+		data, _ := json.Marshal(model.Comment{Id: uint64(commentId), PostId: 1, Comment: "c", Author: "a", CreationDate: testDate})
+		req := httptest.NewRequest(http.MethodPost, "/api/comments", bytes.NewReader(data))
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	// WHEN
+	post(1, "10.0.0.1:1234")
+	second := post(2, "10.0.0.1:1234")
+	third := post(3, "10.0.0.1:4321")
+	otherClient := post(4, "10.0.0.2:1234")
+
+	// THEN
+	assert.Equal(t, http.StatusOK, second.StatusCode)
+	assert.Equal(t, "2", second.Header.Get("RateLimit-Limit"))
+	assert.Equal(t, "0", second.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", second.Header.Get("RateLimit-Reset"))
+
+	assert.Equal(t, http.StatusTooManyRequests, third.StatusCode)
+	assert.Equal(t, "30", third.Header.Get("Retry-After"))
+	var ack AckJsonResponse
+	json.NewDecoder(third.Body).Decode(&ack)
+	assert.Equal(t, AckJsonResponse{Message: "Too many requests, retry in 30 seconds", Status: http.StatusTooManyRequests}, ack)
+	_, err := svc.commentRepository.GetById(3)
+	assert.Error(t, err)
+
+	assert.Equal(t, http.StatusOK, otherClient.StatusCode)
+}
+
+func TestRateLimitIgnoresUnverifiedApiKeys(t *testing.T) {
+	// GIVEN
+	limiter, _ := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), map[string]ratelimit.Limit{
+		"POST /api/comments": {Requests: 1, Per: time.Minute},
+	})
+	svc := NewRestApiService(WithRateLimiter(limiter))
+	handler := svc.Handler()
+	post := func(commentId int, apiKey string) int {
+		data, _ := json.Marshal(model.Comment{Id: uint64(commentId), PostId: 1, Comment: "c", Author: "a", CreationDate: testDate})
+		req := httptest.NewRequest(http.MethodPost, "/api/comments", bytes.NewReader(data))
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set(auth.ApiKeyHeader, apiKey)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// WHEN
+	first := post(1, "random-1")
+	second := post(2, "random-2")
+
+	// THEN
+	assert.Equal(t, http.StatusOK, first)
+	assert.Equal(t, http.StatusTooManyRequests, second)
+}
+
+func TestIdempotentAddComment(t *testing.T) {
+	comment := model.Comment{Id: 123, PostId: 3, Comment: "cool cmnt", Author: "cool auth", CreationDate: testDate}
+	otherComment := model.Comment{Id: 124, PostId: 3, Comment: "other", Author: "cool auth", CreationDate: testDate}
+
+	tests := []struct {
+		testName           string
+		firstKey           string
+		retryKey           string
+		retry              model.Comment
+		expectedHttpStatus int
+		expectedResponse   AckJsonResponse
+		expectedReplayed   string
+	}{
+		{
+			testName:           "testRetryIsReplayed",
+			firstKey:           "key-1",
+			retryKey:           "key-1",
+			retry:              comment,
+			expectedHttpStatus: http.StatusOK,
+			expectedResponse:   AckJsonResponse{Message: "Comment with id: 123 successfully added", Status: http.StatusOK},
+			expectedReplayed:   "true",
+		},
+		{
+			testName:           "testReusedKeyWithDifferentPayload",
+			firstKey:           "key-1",
+			retryKey:           "key-1",
+			retry:              otherComment,
+			expectedHttpStatus: http.StatusUnprocessableEntity,
+			expectedResponse:   AckJsonResponse{Message: "Idempotency-Key was already used with a different payload", Status: http.StatusUnprocessableEntity},
+		},
+		{
+			testName:           "testRetryWithoutKeyIsAConflict",
+			firstKey:           "key-1",
+			retry:              comment,
+			expectedHttpStatus: http.StatusBadRequest,
+			expectedResponse:   AckJsonResponse{Message: "Comment with id: 123 already exists", Status: http.StatusBadRequest},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			svc := NewRestApiService()
+			handler := svc.Handler()
+			post := func(key string, comment model.Comment) *http.Response {
+				data, _ := json.Marshal(comment)
+				req := httptest.NewRequest(http.MethodPost, "/api/comments", bytes.NewReader(data))
+				if key != "" {
+					req.Header.Set(IdempotencyKeyHeader, key)
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				return w.Result()
+			}
+			post(tc.firstKey, comment)
+
+			// WHEN
+			response := post(tc.retryKey, tc.retry)
+			var resp AckJsonResponse
+			json.NewDecoder(response.Body).Decode(&resp)
+
+			// THEN
+			assert.Equal(t, tc.expectedHttpStatus, response.StatusCode)
+			assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+			assert.Equal(t, tc.expectedResponse, resp)
+			assert.Equal(t, tc.expectedReplayed, response.Header.Get("Idempotent-Replayed"))
+		})
+	}
+}
+
+func TestIdempotentReplayOfCompressedResponse(t *testing.T) {
+	// GIVEN a response larger than the compression threshold
+	svc := NewRestApiService(WithCompression(16, compression.Gzip))
+	handler := svc.Handler()
+	post := func() (*http.Response, string) {
+		data, _ := json.Marshal(model.Comment{Id: 123, PostId: 3, Comment: "cool cmnt", Author: "cool auth", CreationDate: testDate})
+		req := httptest.NewRequest(http.MethodPost, "/api/comments", bytes.NewReader(data))
+		req.Header.Set(IdempotencyKeyHeader, "key-1")
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		body, err := gzip.NewReader(w.Result().Body)
+		if !assert.NoError(t, err) {
+			return w.Result(), ""
+		}
+		decoded, _ := io.ReadAll(body)
+		return w.Result(), string(decoded)
+	}
+	first, firstBody := post()
+
+	// WHEN
+	retry, retryBody := post()
+
+	// THEN
+	assert.Equal(t, "gzip", first.Header.Get("Content-Encoding"))
+	assert.Equal(t, "gzip", retry.Header.Get("Content-Encoding"))
+	assert.Equal(t, "true", retry.Header.Get("Idempotent-Replayed"))
+	assert.JSONEq(t, `{"Message": "Comment with id: 123 successfully added", "Status": 200}`, firstBody)
+	assert.Equal(t, firstBody, retryBody)
+}
+
+func TestRepositoryErrorMessages(t *testing.T) {
+	// GIVEN
+	svc := NewRestApiService()
+	svc.postRepository.Insert(validPost)
+	_, notFound := svc.postRepository.Update(model.Post{Id: 99})
+	_, modified := svc.postRepository.Update(model.Post{Id: validPost.Id, Version: 7})
+
+	tests := []struct {
+		testName           string
+		err                error
+		expectedHttpStatus int
+		expectedMessage    string
+	}{
+		{"testNotFound", notFound, http.StatusNotFound, "Post with id: 99 does not exist"},
+		{"testVersionMismatch", modified, http.StatusPreconditionFailed, "Post with id: 34 has been modified, current version is 0"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			// WHEN
+			svc.writeRepositoryError(w, httptest.NewRequest(http.MethodPut, "/api/posts/99", nil), tc.err)
+
+			// THEN
+			assert.Equal(t, tc.expectedHttpStatus, w.Code)
+			assert.JSONEq(t, fmt.Sprintf(`{"Message": %q, "Status": %d}`, tc.expectedMessage, tc.expectedHttpStatus), w.Body.String())
+		})
+	}
+}
+
+func TestUpdatePostIfMatch(t *testing.T) {
+	const currentETag = "CURRENT"
+
+	tests := []struct {
+		testName           string
+		ifMatch            string
+		requireIfMatch     bool
+		expectedHttpStatus int
+		expectedResponse   AckJsonResponse
+	}{
+		{
+			testName:           "testMatchingETag",
+			ifMatch:            currentETag,
+			expectedHttpStatus: http.StatusOK,
+			expectedResponse:   AckJsonResponse{Message: "Post with id: 1 successfully updated", Status: http.StatusOK},
+		},
+		{
+			testName:           "testStaleETag",
+			ifMatch:            `"3-0123456789abcdef"`,
+			expectedHttpStatus: http.StatusPreconditionFailed,
+			expectedResponse:   AckJsonResponse{Message: "Post with id: 1 has been modified, current version is 0", Status: http.StatusPreconditionFailed},
+		},
+		{
+			testName:           "testWeakETagNeverMatches",
+			ifMatch:            "W/" + currentETag,
+			expectedHttpStatus: http.StatusPreconditionFailed,
+			expectedResponse:   AckJsonResponse{Message: "Post with id: 1 has been modified, current version is 0", Status: http.StatusPreconditionFailed},
+		},
+		{
+			testName:           "testWildcard",
+			ifMatch:            "*",
+			requireIfMatch:     true,
+			expectedHttpStatus: http.StatusOK,
+			expectedResponse:   AckJsonResponse{Message: "Post with id: 1 successfully updated", Status: http.StatusOK},
+		},
+		{
+			testName:           "testMissingButNotRequired",
+			expectedHttpStatus: http.StatusOK,
+			expectedResponse:   AckJsonResponse{Message: "Post with id: 1 successfully updated", Status: http.StatusOK},
+		},
+		{
+			testName:           "testMissingButRequired",
+			requireIfMatch:     true,
+			expectedHttpStatus: http.StatusPreconditionRequired,
+			expectedResponse:   AckJsonResponse{Message: "If-Match header is required to modify post with id: 1", Status: http.StatusPreconditionRequired},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			svc := newRbacTestService()
+			svc.requireIfMatch = tc.requireIfMatch
+			existing, _ := svc.postRepository.GetById(1)
+			req := httptest.NewRequest(http.MethodPut, "/api/posts/1", strings.NewReader(`{"Title": "t", "Content": "c"}`))
+			req.Header.Set(auth.ApiKeyHeader, "alice-key")
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", strings.Replace(tc.ifMatch, currentETag, postETag(*existing), 1))
+			}
+			w := httptest.NewRecorder()
+
+			// WHEN
+			svc.Handler().ServeHTTP(w, req)
+			response := w.Result()
+			var resp AckJsonResponse
+			json.NewDecoder(response.Body).Decode(&resp)
+
+			// THEN
+			assert.Equal(t, tc.expectedHttpStatus, response.StatusCode)
+			assert.Equal(t, tc.expectedResponse, resp)
+			if tc.expectedHttpStatus == http.StatusOK {
+				updated, _ := svc.postRepository.GetById(1)
+				assert.Equal(t, uint64(1), updated.Version)
+				assert.Equal(t, postETag(*updated), response.Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestDeleteCommentIfMatch(t *testing.T) {
+	svc := newRbacTestService()
+	svc.commentRepository.SetHidden(10, true, repository.AnyVersion)
+
+	current, _ := svc.commentRepository.GetById(10)
+	stale := *current
+	stale.Hidden, stale.Version = false, 0
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/comments/10", nil)
+	req.Header.Set(auth.ApiKeyHeader, "mod-key")
+	req.Header.Set("If-Match", commentETag(stale))
+	w := httptest.NewRecorder()
+	svc.Handler().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Result().StatusCode)
+
+	req.Header.Set("If-Match", commentETag(*current))
+	w = httptest.NewRecorder()
+	svc.Handler().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+}
+
+func TestConditionalGetPost(t *testing.T) {
+	modified := validPost
+	modified.ModificationDate = testDate.Add(time.Hour)
+
+	tests := []struct {
+		testName           string
+		header             string
+		value              string
+		expectedHttpStatus int
+	}{
+		{"testMatchingETag", "If-None-Match", postETag(modified), http.StatusNotModified},
+		{"testWeakMatchingETag", "If-None-Match", `"x", W/` + postETag(modified), http.StatusNotModified},
+		{"testOtherETag", "If-None-Match", postETag(validPost), http.StatusOK},
+		{"testNotModifiedSince", "If-Modified-Since", testDate.Add(time.Hour).Format(http.TimeFormat), http.StatusNotModified},
+		{"testModifiedSince", "If-Modified-Since", testDate.Format(http.TimeFormat), http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			postRepository := repository.CustomPostRepository([]model.Post{modified})
+			svc := NewRestApiService(WithCacheControl(map[string]string{"GET /api/posts/{postId}": "public, max-age=60"}))
+			svc.postRepository = &postRepository
+			req := httptest.NewRequest(http.MethodGet, "/api/posts/34", nil)
+			req.Header.Set(tc.header, tc.value)
+			w := httptest.NewRecorder()
+
+			// WHEN
+			svc.Handler().ServeHTTP(w, req)
+			response := w.Result()
+			body, _ := io.ReadAll(response.Body)
+
+			// THEN
+			assert.Equal(t, tc.expectedHttpStatus, response.StatusCode)
+			assert.Equal(t, postETag(modified), response.Header.Get("ETag"))
+			assert.Equal(t, "Sun, 16 Sep 2018 13:00:00 GMT", response.Header.Get("Last-Modified"))
+			assert.Equal(t, "public, max-age=60", response.Header.Get("Cache-Control"))
+			if tc.expectedHttpStatus == http.StatusNotModified {
+				assert.Empty(t, body)
+			}
+		})
+	}
+}
+
+func TestGetPosts(t *testing.T) {
+	// GIVEN
+	svc := newRbacTestService(WithResponseValidation(func(err error) { t.Error(err) }))
+	handler := svc.Handler()
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	// WHEN
+	v1 := get("/api/v1/posts")
+	v2 := get("/api/v2/posts")
+
+	// THEN
+	assert.Equal(t, http.StatusOK, v1.Code)
+	assert.JSONEq(t, `[
+		{"Id": 1, "Title": "alice's post", "Content": "content", "Author": "alice", "CreationDate": "2018-09-16T12:00:00Z", "ModificationDate": "0001-01-01T00:00:00Z", "Version": 0},
+		{"Id": 2, "Title": "bob's post", "Content": "content", "Author": "bob", "CreationDate": "2018-09-16T12:00:00Z", "ModificationDate": "0001-01-01T00:00:00Z", "Version": 0}
+	]`, v1.Body.String())
+	assert.Equal(t, http.StatusOK, v2.Code)
+	assert.JSONEq(t, `[
+		{"id": 1, "title": "alice's post", "content": "content", "author": "alice", "createdAt": "2018-09-16T12:00:00Z", "version": 0},
+		{"id": 2, "title": "bob's post", "content": "content", "author": "bob", "createdAt": "2018-09-16T12:00:00Z", "version": 0}
+	]`, v2.Body.String())
+
+	// WHEN a post is deleted
+	initial := v1.Header().Get("ETag")
+	svc.postRepository.Delete(2, repository.AnyVersion)
+
+	// THEN
+	assert.NotEqual(t, initial, get("/api/v1/posts").Header().Get("ETag"))
+	assert.Empty(t, get("/api/v1/posts").Header().Get("Last-Modified"))
+}
+
+func TestCommentListETagChanges(t *testing.T) {
+	svc := newRbacTestService()
+	handler := svc.Handler()
+	get := func() *http.Response {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/comments?postId=1", nil))
+		return w.Result()
+	}
+
+	initial := get().Header.Get("ETag")
+	req := httptest.NewRequest(http.MethodGet, "/api/comments?postId=1", nil)
+	req.Header.Set("If-None-Match", initial)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Result().StatusCode)
+
+	svc.commentRepository.Insert(model.Comment{Id: 11, PostId: 1, Comment: "c", Author: "a", CreationDate: testDate})
+	added := get()
+	assert.NotEqual(t, initial, added.Header.Get("ETag"))
+	assert.NotEmpty(t, added.Header.Get("Last-Modified"))
+
+	svc.commentRepository.Delete(11, repository.AnyVersion)
+	assert.Equal(t, initial, get().Header.Get("ETag"))
+	svc.commentRepository.Delete(10, repository.AnyVersion)
+	assert.NotEqual(t, initial, get().Header.Get("ETag"))
+}
+
+func TestCompressedResponses(t *testing.T) {
+	long := model.Post{Id: 7, Title: "long", Content: strings.Repeat("lorem ipsum ", 200), CreationDate: testDate}
+	short := model.Post{Id: 8, Title: "short", Content: "tiny", CreationDate: testDate}
+
+	tests := []struct {
+		testName         string
+		postId           uint64
+		acceptEncoding   string
+		expectedEncoding string
+		decode           func(io.Reader) io.Reader
+	}{
+		{"testGzip", long.Id, "gzip", "gzip", func(r io.Reader) io.Reader { d, _ := gzip.NewReader(r); return d }},
+		{"testBrotli", long.Id, "gzip;q=0.5, br", "br", func(r io.Reader) io.Reader { return brotli.NewReader(r) }},
+		{"testZstd", long.Id, "zstd, gzip", "zstd", func(r io.Reader) io.Reader { d, _ := zstd.NewReader(r); return d }},
+		{"testBelowThreshold", short.Id, "gzip", "", func(r io.Reader) io.Reader { return r }},
+		{"testNotAccepted", long.Id, "", "", func(r io.Reader) io.Reader { return r }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			postRepository := repository.CustomPostRepository([]model.Post{long, short})
+			svc := NewRestApiService()
+			svc.postRepository = &postRepository
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/posts/%d", tc.postId), nil)
+			req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			w := httptest.NewRecorder()
+
+			// WHEN
+			svc.Handler().ServeHTTP(w, req)
+			response := w.Result()
+			var post model.Post
+			err := json.NewDecoder(tc.decode(response.Body)).Decode(&post)
+
+			// THEN
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Equal(t, tc.expectedEncoding, response.Header.Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", response.Header.Get("Vary"))
+			assert.Equal(t, tc.postId, post.Id)
+		})
+	}
+}
+
+func TestCompressedResponseETag(t *testing.T) {
+	long := model.Post{Id: 7, Title: "long", Content: strings.Repeat("lorem ipsum ", 200), CreationDate: testDate}
+	postRepository := repository.CustomPostRepository([]model.Post{long})
+	svc := NewRestApiService()
+	svc.postRepository = &postRepository
+	handler := svc.Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/7", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	etag := w.Result().Header.Get("ETag")
+	assert.Equal(t, strings.TrimSuffix(postETag(long), `"`)+`+gzip"`, etag)
+
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Result().StatusCode)
+	assert.Empty(t, w.Result().Header.Get("Content-Encoding"))
+	assert.Equal(t, etag, w.Result().Header.Get("ETag"))
+}
+
+func TestCompressedResponseFlush(t *testing.T) {
+	// GIVEN
+	svc := NewRestApiService()
+	handler := svc.compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte(`{"line": 1}` + "\n"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(`{"line": 2}` + "\n"))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/export", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	// WHEN
+	handler.ServeHTTP(w, req)
+	body, err := gzip.NewReader(w.Result().Body)
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(body)
+
+	// THEN
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "gzip", w.Result().Header.Get("Content-Encoding"))
+	assert.Equal(t, "{\"line\": 1}\n{\"line\": 2}\n", string(data))
+}
+
+func TestGzipRequestBody(t *testing.T) {
+	tests := []struct {
+		testName           string
+		contentEncoding    string
+		expectedHttpStatus int
+	}{
+		{"testGzip", "gzip", http.StatusOK},
+		{"testUnsupported", "br", http.StatusUnsupportedMediaType},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			svc := NewRestApiService()
+			data, _ := json.Marshal(model.Comment{Id: 1, PostId: 1, Comment: "c", Author: "a", CreationDate: testDate})
+			var body bytes.Buffer
+			gz := gzip.NewWriter(&body)
+			gz.Write(data)
+			gz.Close()
+			req := httptest.NewRequest(http.MethodPost, "/api/comments", &body)
+			req.Header.Set("Content-Encoding", tc.contentEncoding)
+			w := httptest.NewRecorder()
+
+			// WHEN
+			svc.Handler().ServeHTTP(w, req)
+
+			// THEN
+			assert.Equal(t, tc.expectedHttpStatus, w.Result().StatusCode)
+		})
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	tests := []struct {
+		testName            string
+		path                string
+		accept              string
+		expectedHttpStatus  int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			testName:            "testPostAsXml",
+			path:                "/api/posts/34",
+			accept:              "application/xml",
+			expectedHttpStatus:  http.StatusOK,
+			expectedContentType: "application/xml; charset=utf-8",
+			expectedBody: "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Post><Id>34</Id><Title>happy post</Title>" +
+				"<Content>test content</Content><Author></Author><CreationDate>2018-09-16T12:00:00Z</CreationDate>" +
+				"<ModificationDate>0001-01-01T00:00:00Z</ModificationDate><Version>0</Version></Post>\n",
+		},
+		{
+			testName:            "testCommentsAsCsv",
+			path:                "/api/comments?postId=3",
+			accept:              "text/csv",
+			expectedHttpStatus:  http.StatusOK,
+			expectedContentType: "text/csv; charset=utf-8",
+			expectedBody: "Id,PostId,Comment,Author,CreationDate,Hidden,Version,ParentId,CommentHtml\n" +
+				"123,3,abc,cool author,2018-09-16T12:00:00Z,false,0,0,\n" +
+				"321,3,def,cool author2,2018-09-16T12:00:00Z,false,0,0,\n" +
+				"543,3,ghi,cool author3,2018-09-16T12:00:00Z,false,0,0,\n",
+		},
+		{
+			testName:            "testCommentsAsYaml",
+			path:                "/api/comments?postId=3",
+			accept:              "application/yaml",
+			expectedHttpStatus:  http.StatusOK,
+			expectedContentType: "application/yaml",
+			expectedBody: "- Id: 123\n  PostId: 3\n  Comment: abc\n  Author: cool author\n" +
+				"  CreationDate: \"2018-09-16T12:00:00Z\"\n  Hidden: false\n  Version: 0\n" +
+				"- Id: 321\n  PostId: 3\n  Comment: def\n  Author: cool author2\n" +
+				"  CreationDate: \"2018-09-16T12:00:00Z\"\n  Hidden: false\n  Version: 0\n" +
+				"- Id: 543\n  PostId: 3\n  Comment: ghi\n  Author: cool author3\n" +
+				"  CreationDate: \"2018-09-16T12:00:00Z\"\n  Hidden: false\n  Version: 0\n",
+		},
+		{
+			testName:            "testErrorAsXml",
+			path:                "/api/posts/35",
+			accept:              "application/xml",
+			expectedHttpStatus:  http.StatusNotFound,
+			expectedContentType: "application/xml; charset=utf-8",
+			expectedBody: "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+				"<AckJsonResponse><Message>Post with id: 35 does not exist</Message><Status>404</Status></AckJsonResponse>\n",
+		},
+		{
+			testName:            "testPostAsCsvIsNotAcceptable",
+			path:                "/api/posts/34",
+			accept:              "text/csv",
+			expectedHttpStatus:  http.StatusNotAcceptable,
+			expectedContentType: "application/json",
+			expectedBody: `{"Message":"Not acceptable, supported media types are: application/json, application/xml, ` +
+				`application/yaml, text/csv, application/msgpack","Status":406}` + "\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			postRepository := repository.CustomPostRepository([]model.Post{validPost})
+			commentRepository := repository.CustomCommentRepository(validComments)
+			svc := NewRestApiService()
+			svc.postRepository, svc.commentRepository = &postRepository, &commentRepository
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set("Accept", tc.accept)
+			w := httptest.NewRecorder()
+
+			// WHEN
+			svc.Handler().ServeHTTP(w, req)
+			response := w.Result()
+			body, _ := io.ReadAll(response.Body)
+
+			// THEN
+			assert.Equal(t, tc.expectedHttpStatus, response.StatusCode)
+			assert.Equal(t, tc.expectedContentType, response.Header.Get("Content-Type"))
+			assert.Contains(t, response.Header.Values("Vary"), "Accept")
+			assert.Equal(t, tc.expectedBody, string(body))
+		})
+	}
+}
+
+func TestMessagePackPost(t *testing.T) {
+	postRepository := repository.CustomPostRepository([]model.Post{validPost})
+	svc := NewRestApiService()
+	svc.postRepository = &postRepository
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/34", nil)
+	req.Header.Set("Accept", "application/msgpack")
+	w := httptest.NewRecorder()
+
+	svc.Handler().ServeHTTP(w, req)
+
+	var post model.Post
+	assert.NoError(t, msgpack.Unmarshal(w.Body.Bytes(), &post))
+	assert.Equal(t, "application/msgpack", w.Result().Header.Get("Content-Type"))
+	assert.True(t, validPost.CreationDate.Equal(post.CreationDate))
+	assert.Equal(t, validPost.Title, post.Title)
+	assert.Equal(t, strings.TrimSuffix(postETag(validPost), `"`)+`+msgpack"`, w.Result().Header.Get("ETag"))
+}
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestGoldenResponses(t *testing.T) {
+	modifiedPost := validPost
+	modifiedPost.Id, modifiedPost.ModificationDate, modifiedPost.Version = 35, testDate.Add(time.Hour), 2
+	tests := []struct {
+		testName           string
+		path               string
+		expectedHttpStatus int
+		golden             string
+	}{
+		{testName: "testPostV1", path: "/api/v1/posts/34", expectedHttpStatus: http.StatusOK, golden: "post.v1.json"},
+		{testName: "testModifiedPostV1", path: "/api/v1/posts/35", expectedHttpStatus: http.StatusOK, golden: "post_modified.v1.json"},
+		{testName: "testCommentsV1", path: "/api/v1/comments?postId=3", expectedHttpStatus: http.StatusOK, golden: "comments.v1.json"},
+		{testName: "testErrorV1", path: "/api/v1/posts/36", expectedHttpStatus: http.StatusNotFound, golden: "error.v1.json"},
+		{testName: "testPostV2", path: "/api/v2/posts/34", expectedHttpStatus: http.StatusOK, golden: "post.v2.json"},
+		{testName: "testModifiedPostV2", path: "/api/v2/posts/35", expectedHttpStatus: http.StatusOK, golden: "post_modified.v2.json"},
+		{testName: "testCommentsV2", path: "/api/v2/comments?postId=3", expectedHttpStatus: http.StatusOK, golden: "comments.v2.json"},
+		{testName: "testErrorV2", path: "/api/v2/posts/36", expectedHttpStatus: http.StatusNotFound, golden: "error.v2.json"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			postRepository := repository.CustomPostRepository([]model.Post{validPost, modifiedPost})
+			commentRepository := repository.CustomCommentRepository(validComments)
+			svc := NewRestApiService(WithResponseValidation(func(err error) { t.Error(err) }))
+			svc.postRepository, svc.commentRepository = &postRepository, &commentRepository
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			w := httptest.NewRecorder()
+
+			// WHEN
+			svc.Handler().ServeHTTP(w, req)
+			body, _ := io.ReadAll(w.Result().Body)
+
+			// THEN
+			golden := filepath.Join("testdata", tc.golden)
+			if *update {
+				assert.NoError(t, os.WriteFile(golden, body, 0o644))
+			}
+			expected, err := os.ReadFile(golden)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedHttpStatus, w.Result().StatusCode)
+			assert.Equal(t, string(expected), string(body))
+		})
+	}
+}
+
+func TestApiVersions(t *testing.T) {
+	tests := []struct {
+		testName            string
+		path                string
+		accept              string
+		expectedHttpStatus  int
+		expectedContentType string
+		expectedTitleField  string
+		expectedDeprecation bool
+		expectedLink        string
+	}{
+		{
+			testName:            "testUnversionedIsV1",
+			path:                "/api/posts/34",
+			expectedHttpStatus:  http.StatusOK,
+			expectedContentType: "application/json",
+			expectedTitleField:  "Title",
+			expectedDeprecation: true,
+			expectedLink:        `</api/v2/posts/34>; rel="successor-version"`,
+		},
+		{
+			testName:            "testV1Path",
+			path:                "/api/v1/posts/34",
+			expectedHttpStatus:  http.StatusOK,
+			expectedContentType: "application/json",
+			expectedTitleField:  "Title",
+			expectedDeprecation: true,
+			expectedLink:        `</api/v2/posts/34>; rel="successor-version"`,
+		},
+		{
+			testName:            "testV2Path",
+			path:                "/api/v2/posts/34",
+			expectedHttpStatus:  http.StatusOK,
+			expectedContentType: "application/json",
+			expectedTitleField:  "title",
+		},
+		{
+			testName:            "testV2VendorMediaType",
+			path:                "/api/posts/34",
+			accept:              "application/vnd.blog.v2+json",
+			expectedHttpStatus:  http.StatusOK,
+			expectedContentType: "application/json",
+			expectedTitleField:  "title",
+		},
+		{
+			testName:            "testV2VendorMediaTypeWithSuffix",
+			path:                "/api/posts/34",
+			accept:              "application/vnd.blog.v2+xml;q=0.9, text/html",
+			expectedHttpStatus:  http.StatusOK,
+			expectedContentType: "application/xml; charset=utf-8",
+			expectedTitleField:  "title",
+		},
+		{
+			testName:            "testPathWinsOverVendorMediaType",
+			path:                "/api/v1/posts/34",
+			accept:              "application/vnd.blog.v2+json",
+			expectedHttpStatus:  http.StatusOK,
+			expectedContentType: "application/json",
+			expectedTitleField:  "Title",
+			expectedDeprecation: true,
+			expectedLink:        `</api/v2/posts/34>; rel="successor-version"`,
+		},
+		{
+			testName:            "testUnsupportedVersion",
+			path:                "/api/posts/34",
+			accept:              "application/vnd.blog.v3+json",
+			expectedHttpStatus:  http.StatusNotAcceptable,
+			expectedContentType: "application/json",
+			expectedTitleField:  "Message",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			postRepository := repository.CustomPostRepository([]model.Post{validPost})
+			svc := NewRestApiService(WithResponseValidation(func(err error) { t.Error(err) }),
+				WithDeprecation(dto.V1, time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC), time.Date(2027, time.October, 18, 0, 0, 0, 0, time.UTC)))
+			svc.postRepository = &postRepository
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set("Accept", tc.accept)
+			w := httptest.NewRecorder()
+
+			// WHEN
+			svc.Handler().ServeHTTP(w, req)
+			response := w.Result()
+			body, _ := io.ReadAll(response.Body)
+
+			// THEN
+			assert.Equal(t, tc.expectedHttpStatus, response.StatusCode)
+			assert.Equal(t, tc.expectedContentType, response.Header.Get("Content-Type"))
+			assert.Contains(t, string(body), tc.expectedTitleField)
+			if tc.expectedDeprecation {
+				assert.Equal(t, "@1792281600", response.Header.Get("Deprecation"))
+				assert.Equal(t, "Mon, 18 Oct 2027 00:00:00 GMT", response.Header.Get("Sunset"))
+			} else {
+				assert.Empty(t, response.Header.Get("Deprecation"))
+				assert.Empty(t, response.Header.Get("Sunset"))
+			}
+			assert.Equal(t, tc.expectedLink, response.Header.Get("Link"))
+		})
+	}
+}
+
+func TestNoDeprecationUnlessConfigured(t *testing.T) {
+	// GIVEN
+	svc := NewRestApiService()
+	w := httptest.NewRecorder()
+
+	// WHEN
+	svc.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/posts", nil))
+	var doc map[string]interface{}
+	spec := httptest.NewRecorder()
+	svc.Handler().ServeHTTP(spec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	json.Unmarshal(spec.Body.Bytes(), &doc)
+
+	// THEN
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+	assert.Empty(t, w.Header().Get("Sunset"))
+	assert.Empty(t, w.Header().Get("Link"))
+	getPosts := doc["paths"].(map[string]interface{})["/api/posts"].(map[string]interface{})["get"].(map[string]interface{})
+	assert.NotContains(t, getPosts, "deprecated")
+}
+
+func TestV2ProblemDetails(t *testing.T) {
+	svc := NewRestApiService()
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/comments", strings.NewReader(`{"weird_payload": "weird value"}`))
+	w := httptest.NewRecorder()
+
+	svc.Handler().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	assert.Equal(t, "application/problem+json", w.Result().Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"type": "about:blank", "title": "Bad Request", "status": 400,
+		"detail": "Invalid request: body missing required property id"}`, w.Body.String())
+}
+
+func TestV2ETags(t *testing.T) {
+	// GIVEN
+	postRepository := repository.CustomPostRepository([]model.Post{validPost})
+	svc := NewRestApiService()
+	svc.postRepository = &postRepository
+	get := httptest.NewRecorder()
+	svc.Handler().ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/api/v2/posts/34", nil))
+	etag := get.Result().Header.Get("ETag")
+
+	// WHEN
+	req := httptest.NewRequest(http.MethodPut, "/api/v2/posts/34", strings.NewReader(`{"title": "new", "content": "new"}`))
+	req.Header.Set("If-Match", etag)
+	w := httptest.NewRecorder()
+	svc.Handler().ServeHTTP(w, req)
+
+	// THEN
+	assert.Equal(t, strings.TrimSuffix(postETag(validPost), `"`)+`+v2"`, etag)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.JSONEq(t, `{"message": "Post with id: 34 successfully updated", "status": 200}`, w.Body.String())
+	assert.True(t, strings.HasSuffix(w.Result().Header.Get("ETag"), `+v2"`))
+}
+
+func TestAddCommentV2(t *testing.T) {
+	commentRepository := repository.CustomCommentRepository(make([]model.Comment, 0))
+	svc := RestApiService{commentRepository: &commentRepository, postRepository: repository.NewPostRepository()}
+	payload := `{"id": 7, "postId": 3, "body": "nice", "author": "reader", "createdAt": "2018-09-16T12:00:00Z"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/comments", strings.NewReader(payload))
+	req = req.WithContext(dto.WithVersion(req.Context(), dto.V2))
+	w := httptest.NewRecorder()
+
+	handleAddComment(&svc)(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	comment, err := commentRepository.GetById(7)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Comment{Id: 7, PostId: 3, Comment: "nice", Author: "reader", CreationDate: testDate}, *comment)
+}
+
+func TestOpenApiDocumentIsCached(t *testing.T) {
+	// GIVEN
+	svc := NewRestApiService()
+	handler := svc.Handler()
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	// WHEN
+	second := httptest.NewRecorder()
+	handler.ServeHTTP(second, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	req.Header.Set("If-None-Match", first.Header().Get("ETag"))
+	conditional := httptest.NewRecorder()
+	handler.ServeHTTP(conditional, req)
+
+	// THEN
+	assert.NotEmpty(t, first.Header().Get("ETag"))
+	assert.Equal(t, first.Header().Get("ETag"), second.Header().Get("ETag"))
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, svc.openApiSpec.data, second.Body.Bytes())
+	assert.Equal(t, http.StatusNotModified, conditional.Code)
+}
+
+func TestOpenApiCoversRoutes(t *testing.T) {
+	// GIVEN
+	provider := oidctest.NewProvider("blog", "secret")
+	defer provider.Close()
+	rp, err := auth.NewOidcRelyingParty(context.Background(), config.OidcConfig{
+		Issuer: provider.Issuer(), ClientId: "blog", ClientSecret: "secret", RedirectUrl: "http://blog/auth/callback",
+	})
+	assert.NoError(t, err)
+	svc := newRbacTestService()
+	WithOidc(rp)(svc)
+
+	// WHEN
+	doc := svc.openApiDocument()
+
+	// THEN
+	for _, route := range svc.routes() {
+		method, path := documentedRoute(route)
+		operation, ok := doc.Paths[path][strings.ToLower(method)]
+		if assert.True(t, ok, "route %s is missing from the OpenAPI document", route.pattern) {
+			assert.NotEmpty(t, operation.Responses, route.pattern)
+		}
+	}
+	assert.Len(t, svc.routes(), 3*21+5)
+}
+
+func TestOpenApiDocument(t *testing.T) {
+	// GIVEN
+	svc := NewRestApiService(WithPolicy(auth.DefaultPolicy()), WithDeprecation(dto.V1, testDate, time.Time{}))
+	w := httptest.NewRecorder()
+
+	// WHEN
+	svc.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	var doc map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &doc)
+
+	// THEN
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "3.1.0", doc["openapi"])
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	assert.Contains(t, schemas, "Post")
+	assert.Contains(t, schemas, "Comment")
+	assert.Contains(t, schemas, "AckJsonResponse")
+	assert.Contains(t, schemas, "PostV2")
+	assert.Contains(t, schemas, "ProblemV2")
+
+	getPost := doc["paths"].(map[string]interface{})["/api/v2/posts/{postId}"].(map[string]interface{})["get"].(map[string]interface{})
+	assert.Equal(t, "getPostV2", getPost["operationId"])
+	assert.NotContains(t, getPost, "deprecated")
+	responses := getPost["responses"].(map[string]interface{})
+	for _, status := range []string{"200", "304", "400", "401", "403", "404", "406"} {
+		assert.Contains(t, responses, status)
+	}
+	assert.Equal(t, map[string]interface{}{"$ref": "#/components/schemas/PostV2"},
+		responses["200"].(map[string]interface{})["content"].(map[string]interface{})["application/xml"].(map[string]interface{})["schema"])
+	getPostV1 := doc["paths"].(map[string]interface{})["/api/posts/{postId}"].(map[string]interface{})["get"].(map[string]interface{})
+	assert.Equal(t, true, getPostV1["deprecated"])
+}
+
+func TestDocs(t *testing.T) {
+	tests := []struct {
+		testName            string
+		path                string
+		expectedHttpStatus  int
+		expectedContentType string
+	}{
+		{testName: "testRedirect", path: "/docs", expectedHttpStatus: http.StatusTemporaryRedirect},
+		{testName: "testPage", path: "/docs/", expectedHttpStatus: http.StatusOK, expectedContentType: "text/html; charset=utf-8"},
+		{testName: "testBundle", path: "/docs/swagger-ui-bundle.js", expectedHttpStatus: http.StatusOK, expectedContentType: "text/javascript; charset=utf-8"},
+		{testName: "testMissingAsset", path: "/docs/missing.js", expectedHttpStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			svc := NewRestApiService()
+			w := httptest.NewRecorder()
+
+			// WHEN
+			svc.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			// THEN
+			assert.Equal(t, tc.expectedHttpStatus, w.Result().StatusCode)
+			if tc.expectedContentType != "" {
+				assert.Equal(t, tc.expectedContentType, w.Result().Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestRequestValidation(t *testing.T) {
+	tests := []struct {
+		testName         string
+		method           string
+		path             string
+		body             string
+		expectedResponse string
+	}{
+		{
+			testName: "testWrongType",
+			method:   http.MethodPost,
+			path:     "/api/v2/posts",
+			body:     `{"id": 3, "title": 42, "content": "c"}`,
+			expectedResponse: `{"type": "about:blank", "title": "Bad Request", "status": 400,
+				"detail": "Invalid request: body /title: expected string, got number"}`,
+		},
+		{
+			testName: "testNegativeId",
+			method:   http.MethodPost,
+			path:     "/api/v2/comments",
+			body:     `{"id": -1, "postId": 1, "body": "c", "author": "a", "createdAt": "2018-09-16T12:00:00Z"}`,
+			expectedResponse: `{"type": "about:blank", "title": "Bad Request", "status": 400,
+				"detail": "Invalid request: body /id: expected a value of at least 0"}`,
+		},
+		{
+			testName: "testInvalidDateV2",
+			method:   http.MethodPost,
+			path:     "/api/v2/comments",
+			body:     `{"id": 1, "postId": 1, "body": "c", "author": "a", "createdAt": "yesterday"}`,
+			expectedResponse: `{"type": "about:blank", "title": "Bad Request", "status": 400,
+				"detail": "Invalid request: body /createdAt: expected an RFC 3339 date-time"}`,
+		},
+		{
+			testName: "testMissingPropertyV2",
+			method:   http.MethodPut,
+			path:     "/api/v2/posts/34",
+			body:     `{"title": "t"}`,
+			expectedResponse: `{"type": "about:blank", "title": "Bad Request", "status": 400,
+				"detail": "Invalid request: body missing required property content"}`,
+		},
+		{
+			testName: "testMalformedJson",
+			method:   http.MethodPut,
+			path:     "/api/v2/posts/34",
+			body:     `{"title": `,
+			expectedResponse: `{"type": "about:blank", "title": "Bad Request", "status": 400,
+				"detail": "Invalid request: body is not valid JSON"}`,
+		},
+		{
+			testName: "testInvalidPathParameter",
+			method:   http.MethodGet,
+			path:     "/api/v2/posts/abc",
+			expectedResponse: `{"type": "about:blank", "title": "Bad Request", "status": 400,
+				"detail": "Invalid request: path parameter postId: expected integer"}`,
+		},
+		{
+			testName: "testMissingQueryParameter",
+			method:   http.MethodGet,
+			path:     "/api/v2/comments",
+			expectedResponse: `{"type": "about:blank", "title": "Bad Request", "status": 400,
+				"detail": "Invalid request: query parameter postId is required"}`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			postRepository := repository.CustomPostRepository([]model.Post{validPost})
+			svc := NewRestApiService(WithResponseValidation(func(err error) { t.Error(err) }))
+			svc.postRepository = &postRepository
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+
+			// WHEN
+			svc.Handler().ServeHTTP(w, req)
+
+			// THEN
+			assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+			assert.JSONEq(t, tc.expectedResponse, w.Body.String())
+		})
+	}
+}
+
+func TestV1ErrorMessages(t *testing.T) {
+	tests := []struct {
+		testName         string
+		method           string
+		path             string
+		body             string
+		expectedResponse string
+	}{
+		{
+			testName:         "testIncompleteComment",
+			method:           http.MethodPost,
+			path:             "/api/comments",
+			body:             `{"weird_payload": "weird value"}`,
+			expectedResponse: `{"Message": "Could not deserialize comment JSON payload", "Status": 400}`,
+		},
+		{
+			testName:         "testIncompleteCommentVersioned",
+			method:           http.MethodPost,
+			path:             "/api/v1/comments",
+			body:             `{"weird_payload": "weird value"}`,
+			expectedResponse: `{"Message": "Could not deserialize comment JSON payload", "Status": 400}`,
+		},
+		{
+			testName:         "testInvalidPostId",
+			method:           http.MethodGet,
+			path:             "/api/posts/abc",
+			expectedResponse: `{"Message": "Wrong id path variable: /api/posts/abc", "Status": 400}`,
+		},
+		{
+			testName:         "testMissingPostIdQueryParameter",
+			method:           http.MethodGet,
+			path:             "/api/comments",
+			expectedResponse: `{"Message": "Wrong id path variable: postId is missing", "Status": 400}`,
+		},
+		{
+			testName:         "testIncompleteUpdate",
+			method:           http.MethodPut,
+			path:             "/api/posts/34",
+			body:             `{"Title": "t"}`,
+			expectedResponse: `{"Message": "Could not deserialize post JSON payload", "Status": 400}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			postRepository := repository.CustomPostRepository([]model.Post{validPost})
+			svc := NewRestApiService()
+			svc.postRepository = &postRepository
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+
+			// WHEN
+			svc.Handler().ServeHTTP(w, req)
+
+			// THEN the handlers answer as before requests were validated
+			assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+			assert.JSONEq(t, tc.expectedResponse, w.Body.String())
+		})
+	}
+}
+
+func TestRequestValidationCanBeDisabled(t *testing.T) {
+	svc := NewRestApiService(WithRequestValidation(false))
+	w := httptest.NewRecorder()
+
+	svc.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/posts/abc", nil))
+
+	assert.JSONEq(t, `{"Message": "Wrong id path variable: /api/posts/abc", "Status": 400}`, w.Body.String())
+}
+
+func TestResponseValidation(t *testing.T) {
+	tests := []struct {
+		testName      string
+		status        int
+		contentType   string
+		body          string
+		expectedError string
+	}{
+		{
+			testName:    "testConformingResponse",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body: `{"Id": 1, "Title": "t", "Content": "c", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z",
+				"ModificationDate": "2018-09-16T12:00:00Z", "Version": 0}`,
+		},
+		{
+			testName:    "testWrongType",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body: `{"Id": "1", "Title": "t", "Content": "c", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z",
+				"ModificationDate": "2018-09-16T12:00:00Z", "Version": 0}`,
+			expectedError: "GET /api/posts/1 responded 200: body /Id: expected integer, got string",
+		},
+		{
+			testName:      "testUndocumentedStatus",
+			status:        http.StatusTeapot,
+			expectedError: "GET /api/posts/1 responded 418: status 418 is not documented",
+		},
+		{
+			testName:      "testUndocumentedContentType",
+			status:        http.StatusNotFound,
+			contentType:   "text/plain; charset=utf-8",
+			body:          "404 page not found",
+			expectedError: "GET /api/posts/1 responded 404: Content-Type text/plain is not documented",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			var reported error
+			svc := NewRestApiService(WithResponseValidation(func(err error) { reported = err }))
+			handler := svc.validated(route{pattern: "GET /api/posts/{postId}", name: "GET /api/posts/{postId}"},
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", tc.contentType)
+					w.WriteHeader(tc.status)
+					io.WriteString(w, tc.body)
+				})
+			req := httptest.NewRequest(http.MethodGet, "/api/posts/1", nil)
+			req.SetPathValue("postId", "1")
+			w := httptest.NewRecorder()
+
+			// WHEN
+			handler(w, req)
+
+			// THEN
+			if tc.expectedError == "" {
+				assert.NoError(t, reported)
+			} else {
+				assert.EqualError(t, reported, tc.expectedError)
+			}
+			assert.Equal(t, tc.status, w.Result().StatusCode)
+		})
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	// GIVEN
+	source := newRbacTestService(WithResponseValidation(func(err error) { t.Error(err) }))
+	target := newRbacTestService(WithResponseValidation(func(err error) { t.Error(err) }))
+	target.postRepository.Update(model.Post{Id: 1, Title: "changed", Content: "c", Author: "alice", CreationDate: testDate})
+	serve := func(svc *RestApiService, method string, path string, body string, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(auth.ApiKeyHeader, apiKey)
+		w := httptest.NewRecorder()
+		svc.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	// WHEN
+	export := serve(source, http.MethodGet, "/api/admin/export", "", "admin-key")
+
+	// THEN
+	assert.Equal(t, http.StatusOK, export.Code)
+	assert.Equal(t, "application/x-ndjson", export.Header().Get("Content-Type"))
+	assert.Len(t, strings.Split(strings.TrimSpace(export.Body.String()), "\n"), 3)
+	assert.Equal(t, http.StatusForbidden, serve(source, http.MethodGet, "/api/admin/export", "", "alice-key").Code)
+
+	// WHEN the dump is imported in a dry run
+	dryRun := serve(target, http.MethodPost, "/api/v2/admin/import?dryRun=true&onConflict=overwrite", export.Body.String(), "admin-key")
+
+	// THEN
+	assert.Equal(t, http.StatusOK, dryRun.Code)
+	assert.JSONEq(t, `{"dryRun": true, "posts": {"created": 0, "overwritten": 2, "skipped": 0},
+		"comments": {"created": 0, "overwritten": 1, "skipped": 0}, "errors": [], "aborted": false}`, dryRun.Body.String())
+	post, _ := target.postRepository.GetById(1)
+	assert.Equal(t, "changed", post.Title)
+
+	// WHEN the dump is imported, failing on conflicts
+	failed := serve(target, http.MethodPost, "/api/admin/import", export.Body.String(), "admin-key")
+
+	// THEN
+	assert.Equal(t, http.StatusOK, failed.Code)
+	assert.JSONEq(t, `{"DryRun": false, "Posts": {"Created": 0, "Overwritten": 0, "Skipped": 0},
+		"Comments": {"Created": 0, "Overwritten": 0, "Skipped": 0},
+		"Errors": [{"Line": 1, "Message": "Post with id: 1 already exists", "Status": 409}], "Aborted": true}`, failed.Body.String())
+
+	// WHEN the dump overwrites the posts
+	overwritten := serve(target, http.MethodPost, "/api/admin/import?onConflict=overwrite", export.Body.String(), "admin-key")
+
+	// THEN
+	assert.Equal(t, http.StatusOK, overwritten.Code)
+	post, _ = target.postRepository.GetById(1)
+	assert.Equal(t, "alice's post", post.Title)
+	revisions := target.revisionRepository.GetAllByPostId(1, time.Now())
+	if assert.Len(t, revisions, 2) {
+		assert.Equal(t, "changed", revisions[0].Title)
+		assert.Equal(t, "alice's post", revisions[1].Title)
+		assert.Equal(t, "root", revisions[1].Editor)
+	}
+
+	// WHEN comments reply to each other
+	cycle := `{"type": "comment", "comment": {"Id": 97, "PostId": 1, "ParentId": 98, "Comment": "c", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "comment", "comment": {"Id": 98, "PostId": 1, "ParentId": 97, "Comment": "c", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z"}}`
+	cyclic := serve(target, http.MethodPost, "/api/admin/import", cycle, "admin-key")
+
+	// THEN
+	assert.Equal(t, http.StatusOK, cyclic.Code)
+	assert.JSONEq(t, `{"DryRun": false, "Posts": {"Created": 0, "Overwritten": 0, "Skipped": 0},
+		"Comments": {"Created": 0, "Overwritten": 0, "Skipped": 0}, "Aborted": false, "Errors": [
+			{"Line": 1, "Message": "Parent comment with id: 98 does not exist", "Status": 400},
+			{"Line": 2, "Message": "Parent comment with id: 97 does not exist", "Status": 400}]}`, cyclic.Body.String())
+
+	// WHEN a comment breaks the rules of posted comments
+	tooLong := fmt.Sprintf(`{"type": "comment", "comment": {"Id": 99, "PostId": 1, "Comment": "c", "Author": "%s", "CreationDate": "2018-09-16T12:00:00Z"}}`,
+		strings.Repeat("a", maxAuthorLength+1))
+	rejected := serve(target, http.MethodPost, "/api/admin/import", tooLong, "admin-key")
+
+	// THEN
+	assert.Equal(t, http.StatusOK, rejected.Code)
+	assert.Contains(t, rejected.Body.String(), fmt.Sprintf("Author is %d characters long", maxAuthorLength+1))
+	_, err := target.commentRepository.GetById(99)
+	assert.Error(t, err)
+
+	// WHEN posts break the rules of created posts
+	posts := `{"type": "post", "post": {"Id": 7, "Title": "t", "Content": "c", "Tags": ["Go", "go", " GO "], "Category": "News", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "post", "post": {"Id": 8, "Title": "t", "Content": "c", "Tags": ["a,b"], "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "post", "post": {"Id": 9, "Title": "t", "Content": "c", "Status": "deleted", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "post", "post": {"Id": 10, "Title": "t", "Content": "c", "Status": "scheduled", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "post", "post": {"Id": 11, "Title": "t", "Content": "c", "ContentFormat": "rtf", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "post", "post": {"Id": 12, "Title": "t", "Content": "c", "Status": "archived", "CreationDate": "2018-09-16T12:00:00Z"}}`
+	normalized := serve(target, http.MethodPost, "/api/admin/import", posts, "admin-key")
+
+	// THEN tags are normalized, invalid posts are reported with their line, and archived posts restored
+	assert.Equal(t, http.StatusOK, normalized.Code)
+	var report struct {
+		Posts  struct{ Created int }
+		Errors []struct{ Line, Status int }
+	}
+	if assert.NoError(t, json.Unmarshal(normalized.Body.Bytes(), &report)) {
+		assert.Equal(t, 2, report.Posts.Created)
+		assert.Equal(t, []struct{ Line, Status int }{{2, 400}, {3, 400}, {4, 400}, {5, 400}}, report.Errors)
+	}
+	post, _ = target.postRepository.GetById(7)
+	assert.Equal(t, []string{"go"}, post.Tags)
+	assert.Equal(t, "news", post.Category)
+	post, _ = target.postRepository.GetById(12)
+	assert.Equal(t, model.Archived, post.Status)
+
+	// WHEN
+	invalid := serve(target, http.MethodPost, "/api/admin/import?onConflict=merge", "", "admin-key")
+
+	// THEN
+	assert.Equal(t, http.StatusBadRequest, invalid.Code)
+	assert.JSONEq(t, `{"Message": "Unknown conflict strategy: merge", "Status": 400}`,
+		invalid.Body.String())
+}
+
+func TestBatchCreate(t *testing.T) {
+	tests := []struct {
+		testName           string
+		path               string
+		payload            string
+		expectedHttpStatus int
+		expectedResponse   string
+		expectedPosts      int
+		expectedComments   int
+	}{
+		{
+			testName: "testAtomicPosts",
+			path:     "/api/posts:batch",
+			payload: `[{"Id": 3, "Title": "t", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"},
+				{"Id": 4, "Title": "t", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"}]`,
+			expectedHttpStatus: http.StatusOK,
+			expectedResponse: `[{"Message": "Post with id: 3 successfully added", "Status": 200},
+				{"Message": "Post with id: 4 successfully added", "Status": 200}]`,
+			expectedPosts: 4, expectedComments: 1,
+		},
+		{
+			testName: "testAtomicPostsRejected",
+			path:     "/api/posts:batch?mode=atomic",
+			payload: `[{"Id": 3, "Title": "t", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"},
+				{"Id": 3, "Title": "t", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"}]`,
+			expectedHttpStatus: http.StatusBadRequest,
+			expectedResponse:   `{"Message": "Batch item 1: Post with id: 3 already exists", "Status": 400}`,
+			expectedPosts:      2, expectedComments: 1,
+		},
+		{
+			testName: "testBestEffortComments",
+			path:     "/api/comments:batch?mode=best-effort",
+			payload: `[{"Id": 10, "PostId": 1, "Comment": "c", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z"},
+				{"Id": 11, "PostId": 1, "Comment": "c", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z"}]`,
+			expectedHttpStatus: http.StatusOK,
+			expectedResponse: `[{"Message": "Comment with id: 10 already exists", "Status": 400},
+				{"Message": "Comment with id: 11 successfully added", "Status": 200}]`,
+			expectedPosts: 2, expectedComments: 2,
+		},
+		{
+			testName: "testBestEffortCommentsV2",
+			path:     "/api/v2/comments:batch?mode=best-effort",
+			payload: `[{"id": 11, "postId": 1, "body": "c", "author": "a", "createdAt": "2018-09-16T12:00:00Z"},
+				{"id": 11, "postId": 1, "body": "c", "author": "a", "createdAt": "2018-09-16T12:00:00Z"}]`,
+			expectedHttpStatus: http.StatusOK,
+			expectedResponse: `[{"message": "Comment with id: 11 successfully added", "status": 200},
+				{"message": "Comment with id: 11 already exists", "status": 409}]`,
+			expectedPosts: 2, expectedComments: 2,
+		},
+		{
+			testName: "testLimit",
+			path:     "/api/posts:batch",
+			payload: `[{"Id": 3, "Title": "t", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"},
+				{"Id": 4, "Title": "t", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"},
+				{"Id": 5, "Title": "t", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"}]`,
+			expectedHttpStatus: http.StatusBadRequest,
+			expectedResponse:   `{"Message": "Batch of 3 items exceeds the limit of 2", "Status": 400}`,
+			expectedPosts:      2, expectedComments: 1,
+		},
+		{
+			testName:           "testWrongMode",
+			path:               "/api/posts:batch?mode=some",
+			payload:            `[]`,
+			expectedHttpStatus: http.StatusBadRequest,
+			expectedResponse:   `{"Message": "Wrong mode query parameter: some", "Status": 400}`,
+			expectedPosts:      2, expectedComments: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			svc := newRbacTestService(WithBatchLimit(2), WithResponseValidation(func(err error) { t.Error(err) }))
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.payload))
+			req.Header.Set(auth.ApiKeyHeader, "admin-key")
+			w := httptest.NewRecorder()
+
+			// WHEN
+			svc.Handler().ServeHTTP(w, req)
+
+			// THEN
+			assert.Equal(t, tc.expectedHttpStatus, w.Code)
+			assert.JSONEq(t, tc.expectedResponse, w.Body.String())
+			assert.Len(t, svc.postRepository.GetAll(), tc.expectedPosts)
+			assert.Len(t, svc.commentRepository.GetAll(), tc.expectedComments)
+		})
+	}
+}
+
+func TestBatchedReplyToParentNotInserted(t *testing.T) {
+	// GIVEN a batch whose parent id has been taken since the batch was checked
+	svc := NewRestApiService()
+	parent := model.Comment{Id: 20, PostId: 1, Comment: "parent", Author: "a", CreationDate: testDate}
+	reply := model.Comment{Id: 21, PostId: 1, ParentId: 20, Comment: "reply", Author: "b", CreationDate: testDate}
+	batched := map[uint64]model.Comment{parent.Id: parent, reply.Id: reply}
+	inserted := make(map[uint64]bool)
+	svc.commentRepository.Insert(model.Comment{Id: 20, PostId: 2, Comment: "other", Author: "c", CreationDate: testDate})
+
+	// WHEN
+	parentErr := svc.insertBatchedComment(parent, batched, inserted)
+	replyErr := svc.insertBatchedComment(reply, batched, inserted)
+
+	// THEN
+	assert.Error(t, parentErr)
+	assert.Equal(t, batchItemError{status: http.StatusBadRequest, message: "Parent comment with id: 20 does not exist"}, replyErr)
+	_, err := svc.commentRepository.GetById(21)
+	assert.Error(t, err)
+}
+
+func TestTags(t *testing.T) {
+	// GIVEN
+	svc := newRbacTestService(WithResponseValidation(func(err error) { t.Error(err) }))
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(auth.ApiKeyHeader, "alice-key")
+		w := httptest.NewRecorder()
+		svc.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	// WHEN
+	created := serve(http.MethodPost, "/api/v2/posts",
+		`{"id": 3, "title": "t", "content": "c", "tags": ["Go", " web ", "go"], "category": "Backend"}`)
+	tooMany := serve(http.MethodPost, "/api/v2/posts",
+		`{"id": 4, "title": "t", "content": "c", "tags": ["a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"]}`)
+	invalid := serve(http.MethodPost, "/api/posts", `{"Id": 4, "Title": "t", "Content": "c", "Tags": [" "]}`)
+	updated := serve(http.MethodPut, "/api/v2/posts/1", `{"title": "t", "content": "c", "tags": ["go"]}`)
+	kept := serve(http.MethodPut, "/api/v2/posts/3", `{"title": "edited", "content": "c"}`)
+
+	// THEN
+	assert.Equal(t, http.StatusOK, created.Code)
+	assert.Equal(t, http.StatusBadRequest, tooMany.Code)
+	assert.Contains(t, tooMany.Body.String(), "Post has 11 tags, at most 10 are allowed")
+	assert.JSONEq(t, `{"Message": "Wrong tag: \" \"", "Status": 400}`, invalid.Body.String())
+	assert.Equal(t, http.StatusOK, updated.Code)
+	assert.Equal(t, http.StatusOK, kept.Code)
+	post, _ := svc.postRepository.GetById(3)
+	assert.Equal(t, []string{"go", "web"}, post.Tags)
+	assert.Equal(t, "backend", post.Category)
+
+	// WHEN
+	tags := serve(http.MethodGet, "/api/v2/tags", "")
+	filtered := serve(http.MethodGet, "/api/posts?tag=GO&category=backend", "")
+	byTag := serve(http.MethodGet, "/api/v2/posts?tag=go", "")
+	wrongTag := serve(http.MethodGet, "/api/posts?tag=%20", "")
+
+	// THEN
+	assert.JSONEq(t, `[{"name": "go", "posts": 2}, {"name": "web", "posts": 1}]`, tags.Body.String())
+	assert.JSONEq(t, `[{"Id": 3, "Title": "edited", "Content": "c", "Author": "alice", "CreationDate": "0001-01-01T00:00:00Z",
+		"ModificationDate": "`+post.ModificationDate.Format(time.RFC3339Nano)+`", "Version": 1,
+		"Slug": "edited", "Tags": ["go", "web"], "Category": "backend", "Status": "published"}]`, filtered.Body.String())
+	assert.Contains(t, byTag.Body.String(), `"id":1`)
+	assert.Contains(t, byTag.Body.String(), `"id":3`)
+	assert.JSONEq(t, `{"Message": "Wrong tag query parameter:  ", "Status": 400}`, wrongTag.Body.String())
+}
+
+func TestPublishingWorkflow(t *testing.T) {
+	// GIVEN
+	svc := newRbacTestService(WithResponseValidation(func(err error) { t.Error(err) }))
+	serve := func(method string, path string, body string, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if apiKey != "" {
+			req.Header.Set(auth.ApiKeyHeader, apiKey)
+		}
+		w := httptest.NewRecorder()
+		svc.Handler().ServeHTTP(w, req)
+		return w
+	}
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	// WHEN
+	draft := serve(http.MethodPost, "/api/v2/posts", `{"id": 3, "title": "t", "content": "c", "status": "draft"}`, "alice-key")
+
+	// THEN drafts are only shown to those who may update them
+	assert.Equal(t, http.StatusOK, draft.Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/api/posts/3", "", "").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/posts/3", "", "alice-key").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/posts/3", "", "admin-key").Code)
+	assert.NotContains(t, serve(http.MethodGet, "/api/posts", "", "").Body.String(), `"Id":3`)
+	assert.Contains(t, serve(http.MethodGet, "/api/posts", "", "alice-key").Body.String(), `"Id":3`)
+
+	// THEN neither are their comments, which cannot be answered either
+	reply := `{"Id": 30, "PostId": 3, "Comment": "c", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z"}`
+	assert.JSONEq(t, `{"Message": "Post with id: 3 does not exist", "Status": 404}`,
+		serve(http.MethodGet, "/api/comments?postId=3", "", "").Body.String())
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/comments?postId=3", "", "alice-key").Code)
+	assert.JSONEq(t, `{"Message": "Post with id: 3 does not exist", "Status": 404}`,
+		serve(http.MethodPost, "/api/comments", reply, "").Body.String())
+	assert.JSONEq(t, `[{"Message": "Post with id: 3 does not exist", "Status": 404}]`,
+		serve(http.MethodPost, "/api/comments:batch?mode=best-effort", "["+reply+"]", "mod-key").Body.String())
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/comments", reply, "alice-key").Code)
+
+	tests := []struct {
+		testName           string
+		payload            string
+		expectedHttpStatus int
+		expectedMessage    string
+		expectedStatus     model.PostStatus
+	}{
+		{
+			testName:           "testScheduleWithoutPublishAt",
+			payload:            `{"title": "t", "content": "c", "status": "scheduled"}`,
+			expectedHttpStatus: http.StatusBadRequest,
+			expectedMessage:    "Scheduled posts need a publishAt date in the future",
+			expectedStatus:     model.Draft,
+		},
+		{
+			testName:           "testSchedule",
+			payload:            `{"title": "t", "content": "c", "status": "scheduled", "publishAt": "` + future + `"}`,
+			expectedHttpStatus: http.StatusOK,
+			expectedStatus:     model.Scheduled,
+		},
+		{
+			testName:           "testArchiveScheduled",
+			payload:            `{"title": "t", "content": "c", "status": "archived"}`,
+			expectedHttpStatus: http.StatusConflict,
+			expectedMessage:    "Post with id: 3 cannot go from scheduled to archived",
+			expectedStatus:     model.Scheduled,
+		},
+		{
+			testName:           "testPublish",
+			payload:            `{"title": "t", "content": "c", "status": "published"}`,
+			expectedHttpStatus: http.StatusOK,
+			expectedStatus:     model.Published,
+		},
+		{
+			testName:           "testPublishAtOfPublished",
+			payload:            `{"title": "t", "content": "c", "publishAt": "` + future + `"}`,
+			expectedHttpStatus: http.StatusBadRequest,
+			expectedMessage:    "Only scheduled posts have a publishAt date",
+			expectedStatus:     model.Published,
+		},
+		{
+			testName:           "testUnknownStatus",
+			payload:            `{"title": "t", "content": "c", "status": "deleted"}`,
+			expectedHttpStatus: http.StatusBadRequest,
+			expectedMessage:    "Wrong status: deleted",
+			expectedStatus:     model.Published,
+		},
+		{
+			testName:           "testArchive",
+			payload:            `{"title": "t", "content": "c", "status": "archived"}`,
+			expectedHttpStatus: http.StatusOK,
+			expectedStatus:     model.Archived,
+		},
+	}
+
+	// The cases run in order, each starting from the status the previous one left.
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// WHEN
+			w := serve(http.MethodPut, "/api/v2/posts/3", tc.payload, "alice-key")
+
+			// THEN
+			assert.Equal(t, tc.expectedHttpStatus, w.Code)
+			if tc.expectedMessage != "" {
+				assert.Contains(t, w.Body.String(), tc.expectedMessage)
+			}
+			post, _ := svc.postRepository.GetById(3)
+			assert.Equal(t, tc.expectedStatus, post.Status)
+		})
+	}
+
+	// THEN archived posts are public
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/posts/3", "", "").Code)
+
+	// WHEN
+	archived := serve(http.MethodPost, "/api/posts", `{"Id": 4, "Title": "t", "Content": "c", "Status": "archived"}`, "alice-key")
+	scheduled := serve(http.MethodPost, "/api/posts", `{"Id": 4, "Title": "t", "Content": "c", "Status": "scheduled", "PublishAt": "`+future+`"}`, "alice-key")
+
+	// THEN
+	assert.JSONEq(t, `{"Message": "Posts cannot be created archived", "Status": 400}`, archived.Body.String())
+	assert.Equal(t, http.StatusOK, scheduled.Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/api/posts/4", "", "").Code)
+}
+
+func TestGetPostBySlug(t *testing.T) {
+	// GIVEN
+	svc := newRbacTestService(WithResponseValidation(func(err error) { t.Error(err) }))
+	serve := func(method string, path string, body string, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if apiKey != "" {
+			req.Header.Set(auth.ApiKeyHeader, apiKey)
+		}
+		w := httptest.NewRecorder()
+		svc.Handler().ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/posts", `{"Id": 3, "Title": "Crème brûlée", "Content": "c"}`, "alice-key").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/posts", `{"Id": 4, "Title": "Crème Brûlée!", "Content": "c"}`, "alice-key").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPut, "/api/posts/3", `{"Title": "Tarte tatin", "Content": "c"}`, "alice-key").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/posts", `{"Id": 5, "Title": "Revisions", "Content": "c"}`, "alice-key").Code)
+
+	tests := []struct {
+		testName           string
+		path               string
+		expectedHttpStatus int
+		expectedLocation   string
+		expectedId         string
+	}{
+		{testName: "testCurrentSlug", path: "/api/posts/by-slug/tarte-tatin", expectedHttpStatus: http.StatusOK, expectedId: `"Id":3`},
+		{testName: "testCollisionSuffix", path: "/api/v2/posts/by-slug/creme-brulee-2", expectedHttpStatus: http.StatusOK, expectedId: `"id":4`},
+		{
+			testName: "testFormerSlug", path: "/api/v2/posts/by-slug/creme-brulee",
+			expectedHttpStatus: http.StatusMovedPermanently, expectedLocation: "/api/v2/posts/by-slug/tarte-tatin",
+		},
+		{testName: "testUnknownSlug", path: "/api/posts/by-slug/pavlova", expectedHttpStatus: http.StatusNotFound},
+		{testName: "testSlugOfRevisions", path: "/api/posts/by-slug/revisions", expectedHttpStatus: http.StatusOK, expectedId: `"Id":5`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// WHEN
+			w := serve(http.MethodGet, tc.path, "", "")
+
+			// THEN
+			assert.Equal(t, tc.expectedHttpStatus, w.Code)
+			assert.Equal(t, tc.expectedLocation, w.Header().Get("Location"))
+			if tc.expectedId != "" {
+				assert.Contains(t, w.Body.String(), tc.expectedId)
+			}
+		})
+	}
+}
+
+func TestThreadedComments(t *testing.T) {
+	// GIVEN
+	svc := NewRestApiService(WithResponseValidation(func(err error) { t.Error(err) }))
+	commentRepository := repository.CustomCommentRepository([]model.Comment{
+		{Id: 10, PostId: 1, Comment: "root", Author: "a", CreationDate: testDate},
+		{Id: 11, PostId: 1, Comment: "rude", Author: "b", CreationDate: testDate, ParentId: 10, Hidden: true},
+		{Id: 12, PostId: 1, Comment: "reply", Author: "c", CreationDate: testDate, ParentId: 11},
+		{Id: 13, PostId: 1, Comment: "spam", Author: "d", CreationDate: testDate, Hidden: true},
+		{Id: 20, PostId: 2, Comment: "other", Author: "a", CreationDate: testDate},
+		{Id: 30, PostId: 3, Comment: "1", Author: "a", CreationDate: testDate},
+		{Id: 31, PostId: 3, Comment: "2", Author: "a", CreationDate: testDate, ParentId: 30},
+		{Id: 32, PostId: 3, Comment: "3", Author: "a", CreationDate: testDate, ParentId: 31},
+		{Id: 33, PostId: 3, Comment: "4", Author: "a", CreationDate: testDate, ParentId: 32},
+		{Id: 34, PostId: 3, Comment: "5", Author: "a", CreationDate: testDate, ParentId: 33},
+		{Id: 60, PostId: 3, Comment: "cycle", Author: "a", CreationDate: testDate, ParentId: 61},
+		{Id: 61, PostId: 3, Comment: "cycle", Author: "a", CreationDate: testDate, ParentId: 60},
+	})
+	svc.commentRepository = &commentRepository
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		svc.Handler().ServeHTTP(w, req)
+		return w
+	}
+	reply := func(id uint64, postId uint64, parentId uint64) string {
+		return fmt.Sprintf(`{"Id": %d, "PostId": %d, "Comment": "c", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z", "ParentId": %d}`,
+			id, postId, parentId)
+	}
+
+	tests := []struct {
+		testName           string
+		payload            string
+		expectedHttpStatus int
+		expectedMessage    string
+	}{
+		{
+			testName:           "testReply",
+			payload:            reply(40, 3, 33),
+			expectedHttpStatus: http.StatusOK,
+			expectedMessage:    "Comment with id: 40 successfully added",
+		},
+		{
+			testName:           "testMissingParent",
+			payload:            reply(41, 1, 99),
+			expectedHttpStatus: http.StatusBadRequest,
+			expectedMessage:    "Parent comment with id: 99 does not exist",
+		},
+		{
+			testName:           "testParentOnAnotherPost",
+			payload:            reply(42, 1, 20),
+			expectedHttpStatus: http.StatusBadRequest,
+			expectedMessage:    "Parent comment with id: 20 belongs to another post",
+		},
+		{
+			testName:           "testTooDeep",
+			payload:            reply(43, 3, 34),
+			expectedHttpStatus: http.StatusBadRequest,
+			expectedMessage:    "Replies cannot be nested more than 5 levels deep",
+		},
+		{
+			testName:           "testStoredCycle",
+			payload:            reply(44, 3, 60),
+			expectedHttpStatus: http.StatusBadRequest,
+			expectedMessage:    "Replies cannot be nested more than 5 levels deep",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// WHEN
+			w := serve(http.MethodPost, "/api/comments", tc.payload)
+
+			// THEN
+			assert.Equal(t, tc.expectedHttpStatus, w.Code)
+			assert.JSONEq(t, fmt.Sprintf(`{"Message": %q, "Status": %d}`, tc.expectedMessage, tc.expectedHttpStatus), w.Body.String())
+		})
+	}
+
+	// WHEN
+	batch := serve(http.MethodPost, "/api/comments:batch", "["+reply(50, 2, 0)+","+reply(51, 2, 50)+"]")
+
+	// THEN replies may answer earlier items of a batch
+	assert.Equal(t, http.StatusOK, batch.Code)
+	reply51, err := svc.commentRepository.GetById(51)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(50), reply51.ParentId)
+
+	// WHEN
+	flat := serve(http.MethodGet, "/api/v2/comments?postId=1", "")
+	tree := serve(http.MethodGet, "/api/v2/comments?postId=1&view=tree", "")
+	wrongView := serve(http.MethodGet, "/api/comments?postId=1&view=nested", "")
+
+	// THEN hidden comments only stay in the tree as placeholders of their visible replies
+	assert.JSONEq(t, `[
+		{"id": 10, "postId": 1, "body": "root", "author": "a", "createdAt": "2018-09-16T12:00:00Z", "hidden": false, "version": 0},
+		{"id": 12, "postId": 1, "body": "reply", "author": "c", "createdAt": "2018-09-16T12:00:00Z", "hidden": false, "version": 0, "parentId": 11}
+	]`, flat.Body.String())
+	assert.JSONEq(t, `[
+		{"id": 10, "postId": 1, "body": "root", "author": "a", "createdAt": "2018-09-16T12:00:00Z", "hidden": false, "version": 0, "replies": [
+			{"id": 11, "postId": 1, "body": "", "author": "", "createdAt": "2018-09-16T12:00:00Z", "hidden": true, "version": 0, "parentId": 10, "replies": [
+				{"id": 12, "postId": 1, "body": "reply", "author": "c", "createdAt": "2018-09-16T12:00:00Z", "hidden": false, "version": 0, "parentId": 11, "replies": []}
+			]}
+		]}
+	]`, tree.Body.String())
+	assert.NotEqual(t, flat.Header().Get("ETag"), tree.Header().Get("ETag"))
+	assert.Equal(t, http.StatusBadRequest, wrongView.Code)
+	assert.Contains(t, wrongView.Body.String(), "Wrong view query parameter: nested")
+}
+
+func TestListCommentPages(t *testing.T) {
+	// GIVEN
+	svc := NewRestApiService(WithResponseValidation(func(err error) { t.Error(err) }))
+	comments := make([]model.Comment, 0)
+	for i := 1; i <= 5; i++ {
+		comments = append(comments, model.Comment{
+			Id: uint64(i), PostId: 1, Comment: "c", Author: []string{"alice", "bob"}[i%2], CreationDate: testDate.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	comments = append(comments, model.Comment{Id: 6, PostId: 1, Comment: "c", Author: "alice", CreationDate: testDate, Hidden: true})
+	commentRepository := repository.CustomCommentRepository(comments)
+	svc.commentRepository = &commentRepository
+	list := func(path string) ([]uint64, string, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		svc.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var page []struct{ Id uint64 }
+		_ = json.Unmarshal(w.Body.Bytes(), &page)
+		ids := make([]uint64, 0)
+		for _, comment := range page {
+			ids = append(ids, comment.Id)
+		}
+		return ids, w.Header().Get("Link"), w
+	}
+
+	tests := []struct {
+		testName    string
+		path        string
+		expectedIds []uint64
+	}{
+		{testName: "testDefault", path: "/api/comments?postId=1", expectedIds: []uint64{1, 2, 3, 4, 5}},
+		{testName: "testNewest", path: "/api/comments?postId=1&sort=newest", expectedIds: []uint64{5, 4, 3, 2, 1}},
+		{testName: "testAuthor", path: "/api/comments?postId=1&author=bob", expectedIds: []uint64{1, 3, 5}},
+		{
+			testName:    "testSinceUntil",
+			path:        "/api/comments?postId=1&since=2018-09-16T14:00:00Z&until=2018-09-16T16:00:00Z",
+			expectedIds: []uint64{2, 3},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// WHEN
+			ids, link, w := list(tc.path)
+
+			// THEN
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tc.expectedIds, ids)
+			assert.NotContains(t, link, `rel="next"`)
+		})
+	}
+
+	// WHEN
+	first, link, _ := list("/api/v2/comments?postId=1&limit=2&sort=newest")
+	next := strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+	second, _, _ := list(next)
+
+	// THEN
+	assert.Equal(t, []uint64{5, 4}, first)
+	assert.True(t, strings.HasPrefix(next, "/api/v2/comments?cursor="))
+	assert.Equal(t, []uint64{3, 2}, second)
+
+	// WHEN
+	_, _, wrongLimit := list("/api/comments?postId=1&limit=201")
+	_, _, wrongCursor := list("/api/comments?postId=1&cursor=nope")
+	_, _, paginatedTree := list("/api/comments?postId=1&view=tree&limit=2")
+
+	// THEN
+	assert.JSONEq(t, `{"Message": "Wrong limit query parameter: 201", "Status": 400}`, wrongLimit.Body.String())
+	assert.JSONEq(t, `{"Message": "Wrong cursor query parameter: nope", "Status": 400}`, wrongCursor.Body.String())
+	assert.JSONEq(t, `{"Message": "The tree view does not take the limit query parameter", "Status": 400}`, paginatedTree.Body.String())
+}
+
+func TestGetPostsPages(t *testing.T) {
+	// GIVEN
+	stored := make([]model.Post, 0)
+	for id := uint64(1); id <= 5; id++ {
+		stored = append(stored, model.Post{Id: id, Title: "t", Content: "c", Author: "alice", CreationDate: testDate})
+	}
+	stored[2].Status = model.Draft
+	posts := repository.CustomPostRepository(stored)
+	svc := NewRestApiService(WithPostRepository(&posts), WithResponseValidation(func(err error) { t.Error(err) }))
+	list := func(path string) ([]uint64, string, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		svc.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var page []struct{ Id uint64 }
+		_ = json.Unmarshal(w.Body.Bytes(), &page)
+		ids := make([]uint64, 0)
+		for _, post := range page {
+			ids = append(ids, post.Id)
+		}
+		return ids, w.Header().Get("Link"), w
+	}
+
+	// WHEN
+	all, allLink, _ := list("/api/posts")
+	first, link, _ := list("/api/v2/posts?limit=2")
+	next := strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+	second, secondLink, _ := list(next)
+
+	// THEN pages leave drafts out, and the last one has no next link
+	assert.Equal(t, []uint64{1, 2, 4, 5}, all)
+	assert.Empty(t, allLink)
+	assert.Equal(t, []uint64{1, 2}, first)
+	assert.True(t, strings.HasPrefix(next, "/api/v2/posts?cursor="))
+	assert.Equal(t, []uint64{4, 5}, second)
+	assert.Empty(t, secondLink)
+
+	// WHEN
+	_, _, wrongLimit := list("/api/posts?limit=0")
+	_, _, wrongCursor := list("/api/posts?cursor=nope")
+
+	// THEN
+	assert.JSONEq(t, `{"Message": "Wrong limit query parameter: 0", "Status": 400}`, wrongLimit.Body.String())
+	assert.JSONEq(t, `{"Message": "Wrong cursor query parameter: nope", "Status": 400}`, wrongCursor.Body.String())
+}
+
+func TestSearch(t *testing.T) {
+	// GIVEN posts and comments stored before the service starts are indexed
+	posts := repository.CustomPostRepository([]model.Post{
+		{Id: 1, Title: "Concurrency in Go", Content: "Goroutines and channels.", Author: "alice", CreationDate: testDate},
+		{Id: 2, Title: "Draft", Content: "Channels, unpublished.", Author: "alice", CreationDate: testDate, Status: model.Draft},
+	})
+	comments := repository.CustomCommentRepository([]model.Comment{
+		{Id: 10, PostId: 1, Comment: "Buffered channels?", Author: "bob", CreationDate: testDate},
+		{Id: 11, PostId: 1, Comment: "Spam channels", Author: "eve", CreationDate: testDate, Hidden: true},
+		{Id: 12, PostId: 2, Comment: "Channels in a draft", Author: "bob", CreationDate: testDate},
+	})
+	svc := NewRestApiService(WithPostRepository(&posts), WithCommentRepository(&comments),
+		WithResponseValidation(func(err error) { t.Error(err) }))
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.Handler().ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	ids := func(w *httptest.ResponseRecorder) []string {
+		var hits []struct {
+			Type string
+			Id   uint64
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hits))
+		result := make([]string, 0)
+		for _, hit := range hits {
+			result = append(result, fmt.Sprintf("%s %d", hit.Type, hit.Id))
+		}
+		return result
+	}
+
+	// WHEN
+	found := serve(http.MethodGet, "/api/search?q=channel", "")
+
+	// THEN drafts, hidden comments and the comments of drafts are left out
+	assert.Equal(t, http.StatusOK, found.Code)
+	assert.Equal(t, []string{"comment 10", "post 1"}, ids(found))
+
+	// WHEN
+	first := serve(http.MethodGet, "/api/v2/search?q=channel&limit=1", "")
+	second := serve(http.MethodGet, "/api/v2/search?q=channel&limit=1&offset=1", "")
+
+	// THEN
+	assert.Equal(t, `</api/v2/search?limit=1&offset=1&q=channel>; rel="next"`, first.Header().Get("Link"))
+	assert.Equal(t, []string{"comment 10"}, ids(first))
+	assert.Empty(t, second.Header().Get("Link"))
+	assert.Contains(t, second.Body.String(), `"snippet":"Goroutines and \u003cmark\u003echannels\u003c/mark\u003e."`)
+
+	// WHEN the index follows the repositories
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/comments",
+		`{"Id": 13, "PostId": 1, "Comment": "Unbuffered channels", "Author": "carol", "CreationDate": "2018-09-16T12:00:00Z"}`).Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPut, "/api/posts/1", `{"Title": "Parallelism", "Content": "Threads."}`).Code)
+
+	// THEN
+	assert.Equal(t, []string{"comment 10", "comment 13"}, ids(serve(http.MethodGet, "/api/search?q=channels", "")))
+	assert.Equal(t, []string{"post 1"}, ids(serve(http.MethodGet, "/api/search?q=%22parallelism%22%20thread*", "")))
+	assert.JSONEq(t, `{"Message": "Wrong q query parameter: q is missing", "Status": 400}`,
+		serve(http.MethodGet, "/api/search?q=", "").Body.String())
+}
+
+func TestContentHtml(t *testing.T) {
+	// GIVEN
+	svc := NewRestApiService(WithResponseValidation(func(err error) { t.Error(err) }))
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.Handler().ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/posts",
+		`{"Id": 1, "Title": "Hello", "Content": "# Hi\n<script>alert(1)</script>\n\n*there*", "ContentFormat": "markdown", "CreationDate": "2018-09-16T12:00:00Z"}`).Code)
+
+	// WHEN
+	plain := serve(http.MethodGet, "/api/posts/1", "")
+	rendered := serve(http.MethodGet, "/api/v2/posts/1?contentHtml=true", "")
+	listed := serve(http.MethodGet, "/api/posts?contentHtml=1", "")
+
+	// THEN the rendering is only sent when asked for, and sanitized
+	assert.Equal(t, http.StatusOK, plain.Code)
+	assert.Contains(t, plain.Body.String(), `"ContentFormat":"markdown"`)
+	assert.NotContains(t, plain.Body.String(), "ContentHtml")
+	assert.Equal(t, http.StatusOK, rendered.Code)
+	assert.Contains(t, rendered.Body.String(), `"contentHtml":"\u003ch1\u003eHi\u003c/h1\u003e\n\n\u003cp\u003e\u003cem\u003ethere\u003c/em\u003e\u003c/p\u003e\n"`)
+	assert.Contains(t, listed.Body.String(), `"ContentHtml":"\u003ch1\u003eHi`)
+	assert.Equal(t, plain.Header().Get("ETag"), serve(http.MethodGet, "/api/posts/1?contentHtml=true", "").Header().Get("ETag"))
+
+	// WHEN the post is updated, keeping its format
+	assert.Equal(t, http.StatusOK, serve(http.MethodPut, "/api/posts/1", `{"Title": "Hello", "Content": "**bold**"}`).Code)
+
+	// THEN the cached rendering of the former version is not served
+	assert.Contains(t, serve(http.MethodGet, "/api/posts/1?contentHtml=true", "").Body.String(),
+		`"ContentHtml":"\u003cp\u003e\u003cstrong\u003ebold\u003c/strong\u003e\u003c/p\u003e\n"`)
+
+	// WHEN
+	wrongFormat := serve(http.MethodPost, "/api/posts", `{"Id": 2, "Title": "Rich", "Content": "text", "ContentFormat": "rtf"}`)
+	wrongUpdate := serve(http.MethodPut, "/api/posts/1", `{"Title": "Hello", "Content": "text", "ContentFormat": "rtf"}`)
+	wrongParameter := serve(http.MethodGet, "/api/posts/1?contentHtml=maybe", "")
+
+	// THEN
+	assert.JSONEq(t, `{"Message": "Wrong content format: rtf", "Status": 400}`, wrongFormat.Body.String())
+	assert.JSONEq(t, `{"Message": "Wrong content format: rtf", "Status": 400}`, wrongUpdate.Body.String())
+	assert.Equal(t, http.StatusBadRequest, wrongParameter.Code)
+}
+
+func TestCommentNormalization(t *testing.T) {
+	// GIVEN
+	svc := NewRestApiService(WithResponseValidation(func(err error) { t.Error(err) }))
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.Handler().ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	comment := func(id uint64, text string, author string) string {
+		data, _ := json.Marshal(map[string]interface{}{
+			"Id": id, "PostId": 1, "Comment": text, "Author": author, "CreationDate": "2018-09-16T12:00:00Z",
+		})
+		return string(data)
+	}
+
+	tests := []struct {
+		testName           string
+		payload            string
+		expectedHttpStatus int
+		expectedMessage    string
+		expectedComment    string
+		expectedAuthor     string
+	}{
+		{
+			testName:           "testNormalized",
+			payload:            comment(1, " Cre\u0300me\x00 bru\u0302le\u0301e\r\n\tline\x1b[2J \n", "Zoe\u0308\u200b\x07 "),
+			expectedHttpStatus: http.StatusOK,
+			expectedMessage:    "Comment with id: 1 successfully added",
+			expectedComment:    "Crème brûlée\n\tline[2J",
+			expectedAuthor:     "Zoë\u200b",
+		},
+		{
+			testName:           "testLongestComment",
+			payload:            comment(2, strings.Repeat("é", maxCommentLength), strings.Repeat("a", maxAuthorLength)),
+			expectedHttpStatus: http.StatusOK,
+			expectedMessage:    "Comment with id: 2 successfully added",
+			expectedComment:    strings.Repeat("é", maxCommentLength),
+			expectedAuthor:     strings.Repeat("a", maxAuthorLength),
+		},
+		{
+			testName:           "testCommentTooLong",
+			payload:            comment(3, strings.Repeat("a", maxCommentLength+1), "a"),
+			expectedHttpStatus: http.StatusBadRequest,
+			expectedMessage:    "Comment is 5001 characters long, at most 5000 are allowed",
+		},
+		{
+			testName:           "testAuthorTooLong",
+			payload:            comment(4, "a", strings.Repeat("a", maxAuthorLength+1)),
+			expectedHttpStatus: http.StatusBadRequest,
+			expectedMessage:    "Author is 101 characters long, at most 100 are allowed",
+		},
+		{
+			testName:           "testOnlyControlCharacters",
+			payload:            comment(5, "\x00\x01 \r\n", "a"),
+			expectedHttpStatus: http.StatusBadRequest,
+			expectedMessage:    "Could not deserialize comment JSON payload",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// WHEN
+			w := serve(http.MethodPost, "/api/comments", tc.payload)
+
+			// THEN
+			assert.Equal(t, tc.expectedHttpStatus, w.Code)
+			assert.JSONEq(t, fmt.Sprintf(`{"Message": %q, "Status": %d}`, tc.expectedMessage, tc.expectedHttpStatus), w.Body.String())
+			if tc.expectedHttpStatus == http.StatusOK {
+				var stored model.Comment
+				assert.NoError(t, json.Unmarshal([]byte(tc.payload), &stored))
+				saved, err := svc.commentRepository.GetById(stored.Id)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedComment, saved.Comment)
+				assert.Equal(t, tc.expectedAuthor, saved.Author)
+			}
+		})
+	}
+
+	// WHEN
+	batch := serve(http.MethodPost, "/api/comments:batch?mode=best-effort",
+		"["+comment(6, "fine", "a")+","+comment(7, strings.Repeat("a", maxCommentLength+1), "a")+"]")
+
+	// THEN
+	assert.Contains(t, batch.Body.String(), "Comment is 5001 characters long, at most 5000 are allowed")
+	_, err := svc.commentRepository.GetById(6)
+	assert.NoError(t, err)
+}
+
+func TestCommentHtml(t *testing.T) {
+	// GIVEN
+	commentRepository := repository.CustomCommentRepository([]model.Comment{
+		{Id: 10, PostId: 1, Comment: "See <https://go.dev> <script>alert(1)</script>", Author: "a", CreationDate: testDate},
+		{Id: 11, PostId: 1, Comment: "*rude*", Author: "b", CreationDate: testDate, ParentId: 10, Hidden: true},
+		{Id: 12, PostId: 1, Comment: "**reply**", Author: "c", CreationDate: testDate, ParentId: 11},
+	})
+	svc := NewRestApiService(WithCommentRepository(&commentRepository), WithResponseValidation(func(err error) { t.Error(err) }))
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	// WHEN
+	plain := serve("/api/comments?postId=1")
+	flat := serve("/api/comments?postId=1&commentHtml=true")
+	tree := serve("/api/v2/comments?postId=1&view=tree&commentHtml=true")
+	wrong := serve("/api/comments?postId=1&commentHtml=yes")
+
+	// THEN the rendering is only sent when asked for, and links are marked as user generated
+	var rendered []struct{ CommentHtml string }
+	assert.NoError(t, json.Unmarshal(flat.Body.Bytes(), &rendered))
+	assert.NotContains(t, plain.Body.String(), "CommentHtml")
+	assert.Equal(t, `<p>See <a href="https://go.dev" rel="nofollow ugc noopener">https://go.dev</a> `+
+		"&lt;script&gt;alert(1)&lt;/script&gt;</p>\n", rendered[0].CommentHtml)
+	assert.Equal(t, plain.Header().Get("ETag"), serve("/api/comments?postId=1&commentHtml=true").Header().Get("ETag"))
+
+	// THEN hidden comments are not rendered in the tree view
+	assert.Equal(t, http.StatusOK, tree.Code)
+	assert.NotContains(t, tree.Body.String(), "rude")
+	assert.Contains(t, tree.Body.String(), `"bodyHtml":"\u003cp\u003e\u003cstrong\u003ereply\u003c/strong\u003e\u003c/p\u003e\n"`)
+	assert.Equal(t, http.StatusBadRequest, wrong.Code)
+}
+
+func TestRevisions(t *testing.T) {
+	// GIVEN
+	svc := NewRestApiService(WithResponseValidation(func(err error) { t.Error(err) }))
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.Handler().ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/posts",
+		`{"Id": 1, "Title": "Hello", "Content": "one\ntwo\nthree", "Author": "alice", "CreationDate": "2018-09-16T12:00:00Z"}`).Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPut, "/api/posts/1", `{"Title": "Hello again", "Content": "one\n2\nthree"}`).Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPut, "/api/posts/1", `{"Title": "Hello again", "Content": "one\n2\nthree\nfour"}`).Code)
+
+	// WHEN
+	listed := serve(http.MethodGet, "/api/posts/1/revisions", "")
+	unknown := serve(http.MethodGet, "/api/posts/1/changes", "")
+	var revisions []model.Revision
+	err := json.Unmarshal(listed.Body.Bytes(), &revisions)
+
+	// THEN every update made a revision
+	assert.Equal(t, http.StatusOK, listed.Code)
+	assert.Equal(t, http.StatusNotFound, unknown.Code)
+	assert.NoError(t, err)
+	if assert.Len(t, revisions, 3) {
+		assert.Equal(t, model.Revision{PostId: 1, Number: 1, Title: "Hello", Content: "one\ntwo\nthree", Editor: "alice", Date: revisions[0].Date},
+			revisions[0])
+		assert.Equal(t, []uint64{2, 1}, []uint64{revisions[1].Number, revisions[1].Version})
+		assert.Equal(t, "one\n2\nthree\nfour", revisions[2].Content)
+	}
+	assert.Contains(t, serve(http.MethodGet, "/api/v2/posts/1/revisions/2", "").Body.String(), `"number":2,"version":1,"title":"Hello again"`)
+
+	// WHEN
+	var diff model.RevisionDiff
+	err = json.Unmarshal(serve(http.MethodGet, "/api/posts/1/revisions/diff?from=1", "").Body.Bytes(), &diff)
+
+	// THEN the revision is compared with the latest one
+	assert.NoError(t, err)
+	assert.Equal(t, model.RevisionDiff{
+		PostId: 1, From: 1, To: 3,
+		Title: []model.DiffLine{{Op: model.DiffDelete, Text: "Hello"}, {Op: model.DiffInsert, Text: "Hello again"}},
+		Content: []model.DiffLine{
+			{Op: model.DiffEqual, Text: "one"}, {Op: model.DiffDelete, Text: "two"}, {Op: model.DiffInsert, Text: "2"},
+			{Op: model.DiffEqual, Text: "three"}, {Op: model.DiffInsert, Text: "four"},
+		},
+	}, diff)
+	assert.Contains(t, serve(http.MethodGet, "/api/v2/posts/1/revisions/diff?from=2&to=3", "").Body.String(),
+		`"content":[{"op":"equal","text":"one"},{"op":"equal","text":"2"},{"op":"equal","text":"three"},{"op":"insert","text":"four"}]`)
+
+	// WHEN
+	stale := httptest.NewRequest(http.MethodPost, "/api/posts/1/revisions/1:restore", nil)
+	stale.Header.Set("If-Match", postETag(model.Post{Id: 1, Version: 1}))
+	w := httptest.NewRecorder()
+	svc.Handler().ServeHTTP(w, stale)
+	restored := serve(http.MethodPost, "/api/posts/1/revisions/1:restore", "")
+
+	// THEN the restore makes a revision too
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.JSONEq(t, `{"Message": "Post with id: 1 successfully restored to revision 1", "Status": 200}`, restored.Body.String())
+	post, _ := svc.postRepository.GetById(1)
+	assert.Equal(t, []string{"Hello", "one\ntwo\nthree", "hello"}, []string{post.Title, post.Content, post.Slug})
+	assert.Equal(t, restored.Header().Get("ETag"), postETag(*post))
+	latest, err := svc.revisionRepository.GetByNumber(1, 4, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), latest.RestoredFrom)
+
+	// WHEN
+	missing := serve(http.MethodGet, "/api/posts/1/revisions/9", "")
+	wrongNumber := serve(http.MethodGet, "/api/posts/1/revisions/first", "")
+	wrongFrom := serve(http.MethodGet, "/api/posts/1/revisions/diff?from=first", "")
+	wrongMethod := serve(http.MethodPost, "/api/posts/1/revisions/1:undo", "")
+
+	// THEN
+	assert.JSONEq(t, `{"Message": "Revision 9 of post with id: 1 does not exist", "Status": 404}`, missing.Body.String())
+	assert.JSONEq(t, `{"Message": "Wrong revision path variable: first", "Status": 400}`, wrongNumber.Body.String())
+	assert.Equal(t, http.StatusBadRequest, wrongFrom.Code)
+	assert.Equal(t, http.StatusNotFound, wrongMethod.Code)
+
+	// WHEN the post is deleted and created again
+	assert.Equal(t, http.StatusOK, serve(http.MethodDelete, "/api/posts/1", "").Code)
+	deleted := serve(http.MethodGet, "/api/posts/1/revisions", "")
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/posts",
+		`{"Id": 1, "Title": "Again", "Content": "new", "CreationDate": "2018-09-16T12:00:00Z"}`).Code)
+
+	// THEN its revisions start over
+	assert.Equal(t, http.StatusNotFound, deleted.Code)
+	assert.Len(t, svc.revisionRepository.GetAllByPostId(1, time.Now()), 1)
+}
+
+func TestRevisionRetention(t *testing.T) {
+	// GIVEN a post stored before the service kept revisions
+	svc := newRbacTestService(WithRevisionRetention(repository.RetentionPolicy{MaxCount: 2}))
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(auth.ApiKeyHeader, "alice-key")
+		svc.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	// WHEN
+	for _, content := range []string{"first", "second", "third"} {
+		assert.Equal(t, http.StatusOK, serve(http.MethodPut, "/api/posts/1", `{"Title": "t", "Content": "`+content+`"}`).Code)
+	}
+	var revisions []model.Revision
+	err := json.Unmarshal(serve(http.MethodGet, "/api/posts/1/revisions", "").Body.Bytes(), &revisions)
+
+	// THEN only the latest revisions are kept, numbered after its baseline
+	assert.NoError(t, err)
+	if assert.Len(t, revisions, 2) {
+		assert.Equal(t, []uint64{3, 4}, []uint64{revisions[0].Number, revisions[1].Number})
+		assert.Equal(t, []string{"second", "alice"}, []string{revisions[0].Content, revisions[0].Editor})
+	}
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/api/posts/1/revisions/1", "").Code)
+}
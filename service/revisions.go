@@ -0,0 +1,225 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/diff"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/dto"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/repository"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/slug"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRevisionRetention keeps the last 100 revisions of each post, however old.
+var defaultRevisionRetention = repository.RetentionPolicy{MaxCount: 100}
+
+// restoreMethod is the custom method of POST /api/posts/{postId}/revisions/{revision}:restore.
+const restoreMethod = ":restore"
+
+// WithRevisionRetention sets which revisions of each post are kept, see repository.RetentionPolicy.
+func WithRevisionRetention(policy repository.RetentionPolicy) Option {
+	return func(svc *RestApiService) {
+		svc.revisionRetention = policy
+	}
+}
+
+func newRevision(post model.Post, editor string, date time.Time) model.Revision {
+	return model.Revision{
+		PostId: post.Id, Version: post.Version, Title: post.Title, Content: post.Content,
+		ContentFormat: post.ContentFormat, Editor: editor, Date: date,
+	}
+}
+
+// editor is who makes a revision: the caller, unless anonymous.
+func editor(r *http.Request) string {
+	if id := auth.FromContext(r.Context()); !id.IsAnonymous() {
+		return id.Subject
+	}
+	return ""
+}
+
+// created records the first revision of a post created by its author.
+func (svc *RestApiService) created(post model.Post) {
+	svc.revisionRepository.Add(newRevision(post, post.Author, time.Now().UTC()))
+}
+
+// baseline records the revision a post is at when it has none: it was created before the service kept
+// revisions, or imported. Its author is taken to have made it when it was last modified.
+func (svc *RestApiService) baseline(post model.Post) {
+	date := post.CreationDate
+	if post.ModificationDate.After(date) {
+		date = post.ModificationDate
+	}
+	svc.revisionRepository.AddFirst(newRevision(post, post.Author, date))
+}
+
+// revisedPost looks up the post of a revisions route, which only those who may update it may use, and
+// records its baseline. It returns false after writing the error response.
+func (svc *RestApiService) revisedPost(w http.ResponseWriter, r *http.Request) (model.Post, bool) {
+	if !svc.authorizeAction(w, r, auth.PostsUpdate) {
+		return model.Post{}, false
+	}
+	postId, err := strconv.ParseUint(r.PathValue("postId"), 10, 64)
+	if err != nil {
+		svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Wrong id path variable: %s", r.PathValue("postId")))
+		return model.Post{}, false
+	}
+	post, err := svc.postRepository.GetById(postId)
+	if err != nil {
+		svc.writeAck(w, r, http.StatusNotFound, fmt.Sprintf("Post with id: %d does not exist", postId))
+		return model.Post{}, false
+	}
+	if !svc.authorize(w, r, auth.PostsUpdate, post.Author) {
+		return model.Post{}, false
+	}
+	svc.baseline(*post)
+	return *post, true
+}
+
+// revision looks up a revision of a post by the number in value, written to name in error messages.
+// It returns false after writing the error response.
+func (svc *RestApiService) revision(w http.ResponseWriter, r *http.Request, postId uint64, name string, value string) (model.Revision, bool) {
+	number, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Wrong %s: %s", name, value))
+		return model.Revision{}, false
+	}
+	revision, err := svc.revisionRepository.GetByNumber(postId, number, time.Now())
+	if err != nil {
+		svc.writeAck(w, r, http.StatusNotFound, err.Error())
+		return model.Revision{}, false
+	}
+	return *revision, true
+}
+
+func handleGetRevisions(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: GET /api/posts/42/revisions/
+		// The response lists the revisions of the post kept by the retention policy, oldest first; the
+		// latest one is always kept. Only those who may update the post may list them.
+		post, ok := svc.revisedPost(w, r)
+		if !ok {
+			return
+		}
+		revisions := svc.revisionRepository.GetAllByPostId(post.Id, time.Now())
+
+		// The ETag changes whenever a revision is added or pruned.
+		data, err := json.Marshal(revisions)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		svc.writeCacheable(w, r, dto.Revisions(dto.VersionFromContext(r.Context()), revisions), contentETag(nil, data), time.Time{})
+	}
+}
+
+func handleGetRevision(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: GET /api/posts/42/revisions/3
+		// Revisions never change, nor do their representations.
+		post, ok := svc.revisedPost(w, r)
+		if !ok {
+			return
+		}
+		revision, ok := svc.revision(w, r, post.Id, "revision path variable", r.PathValue("revision"))
+		if !ok {
+			return
+		}
+		data, err := json.Marshal(revision)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		svc.writeCacheable(w, r, dto.Revision(dto.VersionFromContext(r.Context()), revision), contentETag(nil, data), revision.Date)
+	}
+}
+
+func handleGetRevisionDiff(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: GET /api/posts/42/revisions/diff?from=1&to=3
+		// The title and content of revision from are compared line by line with those of revision to,
+		// the latest revision when left out, see diff.Lines.
+		post, ok := svc.revisedPost(w, r)
+		if !ok {
+			return
+		}
+		query := r.URL.Query()
+		from, ok := svc.revision(w, r, post.Id, "from query parameter", query.Get("from"))
+		if !ok {
+			return
+		}
+		var to model.Revision
+		if query.Has("to") {
+			if to, ok = svc.revision(w, r, post.Id, "to query parameter", query.Get("to")); !ok {
+				return
+			}
+		} else {
+			revisions := svc.revisionRepository.GetAllByPostId(post.Id, time.Now())
+			to = revisions[len(revisions)-1]
+		}
+
+		result := model.RevisionDiff{
+			PostId: post.Id, From: from.Number, To: to.Number,
+			Title: diff.Lines(from.Title, to.Title), Content: diff.Lines(from.Content, to.Content),
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		svc.writeCacheable(w, r, dto.RevisionDiff(dto.VersionFromContext(r.Context()), result), contentETag(nil, data), time.Time{})
+	}
+}
+
+func handleRestoreRevision(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: POST /api/posts/42/revisions/3:restore
+		// The title, content and content format of the post are set back to those of the revision, which
+		// makes a new revision; the rest of the post is kept. An If-Match header with the ETag of the post
+		// is honored as by PUT /api/posts/42.
+		// The route is registered without its custom method, see muxPattern.
+		number, ok := strings.CutSuffix(r.PathValue("revision"), restoreMethod)
+		if !ok {
+			svc.writeAck(w, r, http.StatusNotFound, fmt.Sprintf("Revision %s of post with id: %s does not exist",
+				r.PathValue("revision"), r.PathValue("postId")))
+			return
+		}
+		existing, ok := svc.revisedPost(w, r)
+		if !ok {
+			return
+		}
+		if !svc.checkIfMatch(w, r, "Post", existing.Id, existing.Version, postETag(existing)) {
+			return
+		}
+		revision, ok := svc.revision(w, r, existing.Id, "revision path variable", number)
+		if !ok {
+			return
+		}
+
+		post := existing
+		if revision.Title != existing.Title {
+			// The former slug keeps leading to the post, see handleGetPostBySlug.
+			post.Slug = slug.Make(revision.Title)
+		}
+		post.Title = revision.Title
+		post.Content = revision.Content
+		post.ContentFormat = revision.ContentFormat
+		post.ModificationDate = time.Now().UTC()
+		updated, err := svc.postRepository.Update(post)
+		if err != nil {
+			svc.writeRepositoryError(w, r, err)
+			return
+		}
+		restored := newRevision(*updated, editor(r), updated.ModificationDate)
+		restored.RestoredFrom = revision.Number
+		svc.revisionRepository.Add(restored)
+
+		w.Header().Set("ETag", versionETag(r, postETag(*updated)))
+		svc.writeAck(w, r, http.StatusOK, fmt.Sprintf("Post with id: %d successfully restored to revision %d", existing.Id, revision.Number))
+	}
+}
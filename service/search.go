@@ -0,0 +1,91 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/dto"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/search"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+func handleSearch(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: GET /api/search?q=concurrency "worker pool" chan*&limit=10&offset=0
+		if !svc.authorize(w, r, auth.PostsRead, "") {
+			return
+		}
+
+		query := r.URL.Query()
+		q := query.Get("q")
+		if q == "" {
+			svc.writeAck(w, r, http.StatusBadRequest, "Wrong q query parameter: q is missing")
+			return
+		}
+		limit, offset := defaultSearchLimit, 0
+		if value := query.Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxSearchLimit {
+				svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Wrong limit query parameter: %s", value))
+				return
+			}
+			limit = n
+		}
+		if value := query.Get("offset"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Wrong offset query parameter: %s", value))
+				return
+			}
+			offset = n
+		}
+
+		// The response is a JSON array of the posts and comments matching the query, best first, with
+		// snippets of their text. Posts the caller may not read, hidden comments and the comments of
+		// posts the caller may not read are left out. Pages but the last link to the next one.
+		hits := make([]search.Hit, 0)
+		for _, hit := range svc.searchIndex.Search(q) {
+			if svc.searchable(r, hit) {
+				hits = append(hits, hit)
+			}
+		}
+		if offset > len(hits) {
+			offset = len(hits)
+		}
+		if offset+limit < len(hits) {
+			addNextLink(w, r, "offset", strconv.Itoa(offset+limit))
+			hits = hits[:offset+limit]
+		}
+		hits = hits[offset:]
+
+		data, err := json.Marshal(hits)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		svc.writeCacheable(w, r, dto.SearchHits(dto.VersionFromContext(r.Context()), hits), contentETag(nil, data), time.Time{})
+	}
+}
+
+// searchable reports whether the caller may read a search hit.
+func (svc *RestApiService) searchable(r *http.Request, hit search.Hit) bool {
+	if hit.Kind == search.CommentKind {
+		comment, err := svc.commentRepository.GetById(hit.Id)
+		if err != nil || comment.Hidden {
+			return false
+		}
+	}
+	post, err := svc.postRepository.GetById(hit.PostId)
+	if err != nil {
+		// Comments may be posted under ids no post has.
+		return hit.Kind == search.CommentKind
+	}
+	return svc.visible(r, *post)
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/dto"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxTags = 10
+	// maxTagLength bounds tag and category names, in characters.
+	maxTagLength = 32
+)
+
+// normalizeTag lower-cases a tag or category name and trims its surrounding spaces, so that "Go" and
+// " go" are the same tag.
+func normalizeTag(name string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	if normalized == "" || utf8.RuneCountInString(normalized) > maxTagLength || strings.ContainsAny(normalized, ",\t\r\n") {
+		return "", fmt.Errorf("Wrong tag: %q", name)
+	}
+	return normalized, nil
+}
+
+// normalizeTags normalizes the tags of a post and drops duplicates, keeping the order of their first use.
+func normalizeTags(post model.Post) (model.Post, error) {
+	if post.Tags != nil {
+		tags := make([]string, 0, len(post.Tags))
+		seen := make(map[string]bool, len(post.Tags))
+		for _, tag := range post.Tags {
+			normalized, err := normalizeTag(tag)
+			if err != nil {
+				return post, err
+			}
+			if !seen[normalized] {
+				seen[normalized] = true
+				tags = append(tags, normalized)
+			}
+		}
+		if len(tags) > maxTags {
+			return post, fmt.Errorf("Post has %d tags, at most %d are allowed", len(tags), maxTags)
+		}
+		post.Tags = tags
+		if len(tags) == 0 {
+			post.Tags = nil
+		}
+	}
+	if post.Category != "" {
+		category, err := normalizeTag(post.Category)
+		if err != nil {
+			return post, err
+		}
+		post.Category = category
+	}
+	return post, nil
+}
+
+func handleGetTags(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: GET /api/tags
+		if !svc.authorize(w, r, auth.PostsRead, "") {
+			return
+		}
+
+		// The response is a JSON array of the tags in use, ordered by name, with the number of posts
+		// tagged with each.
+		tags := svc.postRepository.GetTags()
+		data, err := json.Marshal(tags)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		svc.writeCacheable(w, r, dto.Tags(dto.VersionFromContext(r.Context()), tags), contentETag(nil, data), time.Time{})
+	}
+}
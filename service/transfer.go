@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/auth"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/dto"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/transfer"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func handleExport(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: GET /api/admin/export
+		if !svc.authorize(w, r, auth.AdminExport, "") {
+			return
+		}
+
+		// The dump is streamed, one post or comment per line, in the format read by POST /api/admin/import.
+		w.Header().Set("Content-Type", transfer.MediaType)
+		w.Header().Set("Content-Disposition", `attachment; filename="blog.ndjson"`)
+		if err := transfer.Export(w, svc.postRepository, svc.commentRepository); err != nil {
+			// The status has been sent already; the truncated dump fails to import its last line.
+			log.Printf("Export failed: %v", err)
+		}
+	}
+}
+
+func handleImport(svc *RestApiService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Example: POST /api/admin/import?onConflict=skip&dryRun=true
+		if !svc.authorize(w, r, auth.AdminImport, "") {
+			return
+		}
+
+		query := r.URL.Query()
+		// Posts and comments are held to the same rules as those posted, and overwritten posts keep their
+		// history.
+		opts := transfer.Options{
+			OnConflict:       transfer.Fail,
+			NormalizePost:    importedPost,
+			NormalizeComment: normalizeComment,
+			CheckParent:      checkParent,
+			Overwritten: func(previous model.Post, post model.Post) {
+				svc.baseline(previous)
+				svc.revisionRepository.Add(newRevision(post, editor(r), time.Now().UTC()))
+			},
+		}
+		if value := query.Get("dryRun"); value != "" {
+			dryRun, err := strconv.ParseBool(value)
+			if err != nil {
+				svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Wrong dryRun query parameter: %s", value))
+				return
+			}
+			opts.DryRun = dryRun
+		}
+		if value := query.Get("onConflict"); value != "" {
+			strategy, err := transfer.ParseStrategy(value)
+			if err != nil {
+				svc.writeAck(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			opts.OnConflict = strategy
+		}
+
+		// Lines that cannot be imported are listed in the report with the status and message their create
+		// request would have got; the import only stops early at a conflict with onConflict=fail.
+		report, err := transfer.Import(r.Body, svc.postRepository, svc.commentRepository, opts)
+		if err != nil {
+			svc.writeAck(w, r, http.StatusBadRequest, fmt.Sprintf("Import stopped after %d posts and %d comments: %v",
+				report.Posts.Created+report.Posts.Overwritten, report.Comments.Created+report.Comments.Overwritten, err))
+			return
+		}
+		_, body, ok := svc.encode(w, r, dto.ImportReport(dto.VersionFromContext(r.Context()), report))
+		if !ok {
+			return
+		}
+		w.Write(body)
+	}
+}
+
+// importedPost checks and normalizes an imported post as newPost does, except that a dump holds posts
+// in every status: archived ones, published ones that keep the publishAt date they were scheduled
+// for, and scheduled ones whose date passed while the dump was kept.
+func importedPost(post model.Post) (model.Post, error) {
+	post, err := normalizeTags(post)
+	if err != nil {
+		return post, err
+	}
+	if err := checkContentFormat(post); err != nil {
+		return post, err
+	}
+	post.Status = statusOf(post)
+	if _, ok := transitions[post.Status]; !ok {
+		return post, fmt.Errorf("Wrong status: %s", post.Status)
+	}
+	switch {
+	case post.Status == model.Scheduled && post.PublishAt == nil:
+		return post, errors.New("Scheduled posts need a publishAt date")
+	case post.Status != model.Scheduled && post.Status != model.Published && post.PublishAt != nil:
+		return post, errors.New("Only scheduled and published posts have a publishAt date")
+	}
+	return post, nil
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/dto"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/openapi"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// WithRequestValidation turns the validation of requests against the OpenAPI document on or off. It
+// is on by default: requests that do not conform are answered with 400 before reaching the handlers.
+func WithRequestValidation(enabled bool) Option {
+	return func(svc *RestApiService) {
+		svc.validateRequests = enabled
+	}
+}
+
+// WithResponseValidation validates every API response against the OpenAPI document and passes those
+// that do not conform to report, e.g. t.Error in tests. Responses are sent unchanged either way.
+func WithResponseValidation(report func(error)) Option {
+	return func(svc *RestApiService) {
+		svc.reportInvalidResponse = report
+	}
+}
+
+// validated checks the requests and responses of an API route against its documented operation. The
+// operation is documented for every version as unversioned routes serve the version negotiated. v1
+// requests are left to the handlers, whose error messages are part of the frozen v1 contract.
+func (svc *RestApiService) validated(route route, next http.HandlerFunc) http.HandlerFunc {
+	op, ok := operations[route.name]
+	if !ok || (!svc.validateRequests && svc.reportInvalidResponse == nil) {
+		return next
+	}
+	var components openapi.Components
+	documented := make(map[dto.Version]*openapi.Operation)
+	for version := dto.V1; version <= dto.Latest; version++ {
+		versioned := route
+		versioned.version = version
+		documented[version] = svc.documentOperation(&components, versioned, op)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		version := dto.VersionFromContext(r.Context())
+		spec := documented[version]
+		if svc.validateRequests && version != dto.V1 {
+			if err := validateRequest(&components, spec, r); err != nil {
+				svc.writeAck(w, r, http.StatusBadRequest, "Invalid request: "+err.Error())
+				return
+			}
+		}
+		if svc.reportInvalidResponse == nil {
+			next(w, r)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+		if err := validateResponse(&components, spec, recorder.status, w.Header(), recorder.body.Bytes()); err != nil {
+			svc.reportInvalidResponse(fmt.Errorf("%s %s responded %d: %w", r.Method, r.URL.RequestURI(), recorder.status, err))
+		}
+	}
+}
+
+func validateRequest(components *openapi.Components, spec *openapi.Operation, r *http.Request) error {
+	query := r.URL.Query()
+	for _, parameter := range spec.Parameters {
+		var value string
+		var present bool
+		switch parameter.In {
+		case "path":
+			value = r.PathValue(parameter.Name)
+			present = value != ""
+		case "query":
+			present = query.Has(parameter.Name)
+			value = query.Get(parameter.Name)
+		default:
+			continue
+		}
+		if !present {
+			if parameter.Required {
+				return fmt.Errorf("%s parameter %s is required", parameter.In, parameter.Name)
+			}
+			continue
+		}
+		if err := components.ValidateParameter(parameter, value); err != nil {
+			return fmt.Errorf("%s parameter %s: %w", parameter.In, parameter.Name, err)
+		}
+	}
+
+	// Streamed bodies, such as JSON Lines, are checked by their handlers.
+	if spec.RequestBody == nil {
+		return nil
+	}
+	content, ok := spec.RequestBody.Content["application/json"]
+	if !ok {
+		return nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("body could not be read")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	value, err := decodeJson(body)
+	if err != nil {
+		return fmt.Errorf("body is not valid JSON")
+	}
+	if err := components.Validate(content.Schema, value); err != nil {
+		return fmt.Errorf("body %w", err)
+	}
+	return nil
+}
+
+func validateResponse(components *openapi.Components, spec *openapi.Operation, status int, header http.Header, body []byte) error {
+	response, ok := spec.Responses[strconv.Itoa(status)]
+	if !ok {
+		return fmt.Errorf("status %d is not documented", status)
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("invalid Content-Type %q", header.Get("Content-Type"))
+	}
+	content, ok := response.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("Content-Type %s is not documented", mediaType)
+	}
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return nil
+	}
+	value, err := decodeJson(body)
+	if err != nil {
+		return fmt.Errorf("body is not valid JSON")
+	}
+	if err := components.Validate(content.Schema, value); err != nil {
+		return fmt.Errorf("body %w", err)
+	}
+	return nil
+}
+
+func decodeJson(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	return value, err
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/dto"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiVersions are the route groups every API route is registered under. Routes without a version in
+// the path are served as the version asked for with an Accept header such as
+// application/vnd.blog.v2+json, and as v1 otherwise.
+var apiVersions = []struct {
+	prefix  string
+	version dto.Version
+}{
+	{prefix: "/api"},
+	{prefix: "/api/v1", version: dto.V1},
+	{prefix: "/api/v2", version: dto.V2},
+}
+
+var (
+	vendorMediaType   = regexp.MustCompile(`^application/vnd\.blog\.v(\d+)(?:\+([a-z0-9.-]+))?$`)
+	versionedApiRoute = regexp.MustCompile(`/api/v\d+/`)
+)
+
+type deprecation struct {
+	date   time.Time
+	sunset time.Time
+}
+
+// WithDeprecation announces, through the Deprecation and Sunset headers of its responses, that an API
+// version has been deprecated since date and will be removed at sunset. A zero sunset omits the header.
+// No version is announced as deprecated unless configured.
+func WithDeprecation(version dto.Version, date time.Time, sunset time.Time) Option {
+	return func(svc *RestApiService) {
+		if svc.deprecations == nil {
+			svc.deprecations = make(map[dto.Version]deprecation)
+		}
+		svc.deprecations[version] = deprecation{date: date, sunset: sunset}
+	}
+}
+
+// versionedRoute moves a route pattern such as "GET /api/posts/{postId}" under prefix.
+func versionedRoute(route string, prefix string) string {
+	return strings.Replace(route, "/api/", prefix+"/", 1)
+}
+
+// unversionedRoute is the inverse of versionedRoute. Rate limits, idempotency keys and Cache-Control
+// policies are configured per unversioned route and shared by all versions.
+func unversionedRoute(pattern string) string {
+	return versionedApiRoute.ReplaceAllString(pattern, "/api/")
+}
+
+// versioned serves next as the given API version, or as the version negotiated from the Accept header
+// when version is zero.
+func (svc *RestApiService) versioned(version dto.Version, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requested, accept, err := requestedVersion(r.Header.Get("Accept"))
+		if err != nil {
+			r.Header.Set("Accept", "application/json")
+			svc.writeAck(w, r, http.StatusNotAcceptable, err.Error())
+			return
+		}
+		if requested != 0 {
+			// The vendor media types only select the version; the representation is negotiated as usual.
+			r.Header.Set("Accept", accept)
+		}
+		// Every response already varies on Accept, see svc.encode.
+		served := version
+		if served == 0 {
+			served = dto.V1
+			if requested != 0 {
+				served = requested
+			}
+		}
+
+		if d, ok := svc.deprecations[served]; ok {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(d.date.Unix(), 10))
+			if !d.sunset.IsZero() {
+				w.Header().Set("Sunset", d.sunset.UTC().Format(http.TimeFormat))
+			}
+			if successor := served + 1; successor <= dto.Latest {
+				w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, versionedPath(r.URL.Path, successor)))
+			}
+		}
+		next(w, r.WithContext(dto.WithVersion(r.Context(), served)))
+	}
+}
+
+// versionedPath rewrites a request path, versioned or not, into the path of the same resource in version.
+func versionedPath(path string, version dto.Version) string {
+	if !versionedApiRoute.MatchString(path) {
+		return strings.Replace(path, "/api/", "/api/"+version.String()+"/", 1)
+	}
+	return versionedApiRoute.ReplaceAllString(path, "/api/"+version.String()+"/")
+}
+
+// requestedVersion finds the API version asked for by the vendor media types of an Accept header, and
+// returns the header with those replaced by the media types they stand for. Version is zero when the
+// header has no vendor media type.
+func requestedVersion(accept string) (dto.Version, string, error) {
+	var version dto.Version
+	ranges := strings.Split(accept, ",")
+	for i, mediaRange := range ranges {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		match := vendorMediaType.FindStringSubmatch(mediaType)
+		if match == nil {
+			continue
+		}
+		requested, err := dto.ParseVersion("v" + match[1])
+		if err != nil {
+			return 0, "", err
+		}
+		if version == 0 {
+			version = requested
+		}
+		suffix := match[2]
+		if suffix == "" {
+			suffix = "json"
+		}
+		ranges[i] = mime.FormatMediaType("application/"+suffix, params)
+	}
+	return version, strings.Join(ranges, ","), nil
+}
+
+// versionETag marks an entity tag as belonging to the representation of the request's API version,
+// as each version has its own. The v1 representation keeps the tag unchanged.
+func versionETag(r *http.Request, etag string) string {
+	version := dto.VersionFromContext(r.Context())
+	if version == dto.V1 || !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + "+" + version.String() + `"`
+}
+
+// unversionETags removes the marks added by versionETag from a list of entity tags.
+func unversionETags(header string) string {
+	for version := dto.V1; version <= dto.Latest; version++ {
+		header = strings.ReplaceAll(header, "+"+version.String()+`"`, `"`)
+	}
+	return header
+}
+
+// conflictStatus is the status of a create request for a resource that already exists: 400 in v1, which
+// predates the distinction, 409 Conflict from v2 on.
+func conflictStatus(r *http.Request) int {
+	if dto.VersionFromContext(r.Context()) == dto.V1 {
+		return http.StatusBadRequest
+	}
+	return http.StatusConflict
+}
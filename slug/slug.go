@@ -0,0 +1,87 @@
+// Package slug turns post titles into human-readable URL path segments.
+package slug
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MaxLength is the longest slug Make returns, in bytes.
+const MaxLength = 80
+
+// Fallback is the slug of titles without a single transliterable letter or digit.
+const Fallback = "post"
+
+// transliterations spells letters outside ASCII with ASCII letters. Latin letters with diacritics
+// that are not listed lose their marks, see fold.
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'ð': "d", 'þ': "th", 'ł': "l", 'đ': "d", 'ħ': "h", 'ı': "i",
+	'ŀ': "l", 'ŋ': "ng", 'ĸ': "k", 'ſ': "s",
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh", 'з': "z", 'и': "i",
+	'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+	'э': "e", 'ю': "yu", 'я': "ya", 'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g",
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th", 'ι': "i", 'κ': "k",
+	'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t",
+	'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o", 'ά': "a", 'έ': "e", 'ή': "i", 'ί': "i", 'ό': "o",
+	'ύ': "y", 'ώ': "o", 'ϊ': "i", 'ϋ': "y", 'ΐ': "i", 'ΰ': "y",
+}
+
+// folds maps the Latin letters with diacritics of the Latin-1 Supplement and Latin Extended-A blocks
+// onto their base letter.
+var folds = map[string]string{
+	"a": "àáâãäåāăą", "c": "çćĉċč", "d": "ď", "e": "èéêëēĕėęě", "g": "ĝğġģ", "h": "ĥ", "i": "ìíîïĩīĭįİ",
+	"j": "ĵ", "k": "ķ", "l": "ĺļľ", "n": "ñńņňŉ", "o": "òóôõöōŏő", "r": "ŕŗř", "s": "śŝşš", "t": "ţťŧ",
+	"u": "ùúûüũūŭůűų", "w": "ŵ", "y": "ýÿŷ", "z": "źżž",
+}
+
+func init() {
+	for base, letters := range folds {
+		for _, letter := range letters {
+			transliterations[letter] = base
+		}
+	}
+}
+
+// Make returns the slug of a title: its letters and digits transliterated to lower-case ASCII, in runs
+// separated by single hyphens, e.g. "Crème brûlée, 2nd try" becomes "creme-brulee-2nd-try".
+func Make(title string) string {
+	var b strings.Builder
+	pendingHyphen := false
+	write := func(s string) {
+		if s == "" {
+			return
+		}
+		if pendingHyphen && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		pendingHyphen = false
+		b.WriteString(s)
+	}
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			write(string(r))
+		case transliterations[r] != "":
+			write(transliterations[r])
+		case r == '\'' || r == '’' || r == 'ъ' || r == 'ь':
+			// Apostrophes and soft signs join the letters around them.
+		default:
+			pendingHyphen = true
+		}
+	}
+
+	slug := b.String()
+	if len(slug) > MaxLength {
+		slug = slug[:MaxLength]
+		if i := strings.LastIndexByte(slug, '-'); i > 0 {
+			slug = slug[:i]
+		}
+	}
+	if slug == "" {
+		return Fallback
+	}
+	return slug
+}
@@ -0,0 +1,40 @@
+package slug
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		testName string
+		title    string
+		expected string
+	}{
+		{testName: "testAscii", title: "Hello, World!", expected: "hello-world"},
+		{testName: "testDigits", title: "Go 1.22 routing", expected: "go-1-22-routing"},
+		{testName: "testDiacritics", title: "Crème brûlée, 2nd try", expected: "creme-brulee-2nd-try"},
+		{testName: "testLigatures", title: "Straße für Œuvres", expected: "strasse-fur-oeuvres"},
+		{testName: "testPolish", title: "Zażółć gęślą jaźń", expected: "zazolc-gesla-jazn"},
+		{testName: "testCyrillic", title: "Привет, мир", expected: "privet-mir"},
+		{testName: "testGreek", title: "Καλημέρα κόσμε", expected: "kalimera-kosme"},
+		{testName: "testApostrophe", title: "Don't panic", expected: "dont-panic"},
+		{testName: "testSeparators", title: "  --a   b--  ", expected: "a-b"},
+		{testName: "testUntransliterable", title: "你好", expected: "post"},
+		{testName: "testEmpty", title: "", expected: "post"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Make(tc.title))
+		})
+	}
+}
+
+func TestMakeTruncatesAtWordBoundary(t *testing.T) {
+	slug := Make(strings.Repeat("word ", 30))
+	assert.LessOrEqual(t, len(slug), MaxLength)
+	assert.False(t, strings.HasSuffix(slug, "-"))
+	assert.True(t, strings.HasSuffix(slug, "word"))
+}
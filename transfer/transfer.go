@@ -0,0 +1,412 @@
+// Package transfer dumps the posts and comments of a blog as JSON Lines and loads them back, so that
+// blogs can be migrated between environments.
+package transfer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/repository"
+	"io"
+	"net/http"
+)
+
+const (
+	MediaType = "application/x-ndjson"
+
+	TypePost    = "post"
+	TypeComment = "comment"
+
+	DefaultBatchSize = 500
+	// MaxLineLength is the longest line an import accepts, in bytes.
+	MaxLineLength = 1 << 20
+)
+
+// Record is a line of a dump: a post or a comment, with every field the repositories keep.
+type Record struct {
+	Type    string         `json:"type"`
+	Post    *model.Post    `json:"post,omitempty"`
+	Comment *model.Comment `json:"comment,omitempty"`
+}
+
+func (r Record) id() uint64 {
+	if r.Post != nil {
+		return r.Post.Id
+	}
+	return r.Comment.Id
+}
+
+// ConflictStrategy decides what an import does with posts and comments whose id is already taken.
+type ConflictStrategy string
+
+const (
+	// Skip keeps the stored post or comment.
+	Skip ConflictStrategy = "skip"
+	// Overwrite replaces the stored post or comment, at its next version.
+	Overwrite ConflictStrategy = "overwrite"
+	// Fail stops the import before the batch holding the conflict; earlier batches stay imported.
+	Fail ConflictStrategy = "fail"
+)
+
+var Strategies = []ConflictStrategy{Skip, Overwrite, Fail}
+
+type UnknownStrategyError struct {
+	Strategy string
+}
+
+func (e UnknownStrategyError) Error() string {
+	return fmt.Sprintf("Unknown conflict strategy: %s", e.Strategy)
+}
+
+func ParseStrategy(s string) (ConflictStrategy, error) {
+	for _, strategy := range Strategies {
+		if string(strategy) == s {
+			return strategy, nil
+		}
+	}
+	return "", UnknownStrategyError{s}
+}
+
+// Export writes every post, then every comment, ordered by id, one record per line. When w is an
+// http.Flusher, the records are flushed in batches of DefaultBatchSize so that they reach the client
+// as they are written.
+func Export(w io.Writer, posts *repository.PostRepository, comments *repository.CommentRepository) error {
+	encoder := json.NewEncoder(w)
+	written := 0
+	encode := func(record Record) error {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+		if written++; written%DefaultBatchSize == 0 {
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+		return nil
+	}
+	for _, post := range posts.GetAll() {
+		post := post
+		if err := encode(Record{Type: TypePost, Post: &post}); err != nil {
+			return err
+		}
+	}
+	for _, comment := range comments.GetAll() {
+		comment := comment
+		if err := encode(Record{Type: TypeComment, Comment: &comment}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Options struct {
+	// DryRun reports what an import would do without changing the repositories.
+	DryRun     bool
+	OnConflict ConflictStrategy
+	// BatchSize is how many records are checked for conflicts and applied together, DefaultBatchSize
+	// when zero.
+	BatchSize int
+	// NormalizePost, when set, checks and normalizes every imported post as the create route does.
+	// The lines of the posts it rejects are reported with 400 and its error.
+	NormalizePost func(post model.Post) (model.Post, error)
+	// NormalizeComment, when set, checks and normalizes every imported comment as the create route
+	// does. The lines of the comments it rejects are reported with 400 and its error.
+	NormalizeComment func(comment model.Comment) (model.Comment, error)
+	// CheckParent, when set, checks the parent of every imported comment as the create route does.
+	// lookup finds the comments stored or imported before it. The lines of the comments it rejects are
+	// reported with 400 and its error.
+	CheckParent func(comment model.Comment, lookup func(id uint64) (model.Comment, bool)) error
+	// Overwritten, when set, is called with the stored post and the post that replaced it.
+	Overwritten func(previous model.Post, post model.Post)
+}
+
+type Counts struct {
+	Created     int
+	Overwritten int
+	Skipped     int
+}
+
+// LineError reports a line that was not imported, with the status and message the corresponding
+// API request would have been answered with.
+type LineError struct {
+	Line    int
+	Status  int
+	Message string
+}
+
+type Report struct {
+	DryRun   bool
+	Posts    Counts
+	Comments Counts
+	Errors   []LineError
+	// Aborted is set when the Fail strategy stopped the import at a conflict.
+	Aborted bool
+}
+
+// line is a valid record along with its line number.
+type line struct {
+	number int
+	record Record
+}
+
+type importer struct {
+	posts    *repository.PostRepository
+	comments *repository.CommentRepository
+	opts     Options
+	report   Report
+	// seen are the ids imported so far, so that duplicates within a dump conflict in dry runs too.
+	seenPosts    map[uint64]bool
+	seenComments map[uint64]bool
+	// importedComments are the comments imported so far, which later replies may answer in dry runs too.
+	importedComments map[uint64]model.Comment
+}
+
+// Import reads records line by line and applies them in batches. Invalid lines are reported and
+// skipped; reading stops at the first error of r, which is returned along with the report so far.
+func Import(r io.Reader, posts *repository.PostRepository, comments *repository.CommentRepository, opts Options) (Report, error) {
+	if opts.OnConflict == "" {
+		opts.OnConflict = Fail
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	im := &importer{
+		posts:            posts,
+		comments:         comments,
+		opts:             opts,
+		report:           Report{DryRun: opts.DryRun, Errors: make([]LineError, 0)},
+		seenPosts:        make(map[uint64]bool),
+		seenComments:     make(map[uint64]bool),
+		importedComments: make(map[uint64]model.Comment),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineLength)
+	batch := make([]line, 0, opts.BatchSize)
+	number := 0
+	for scanner.Scan() {
+		number++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		record, err := im.parse(scanner.Bytes())
+		if err != nil {
+			im.fail(number, http.StatusBadRequest, err.Error())
+			continue
+		}
+		batch = append(batch, line{number: number, record: record})
+		if len(batch) == opts.BatchSize {
+			if !im.apply(batch) {
+				return im.report, nil
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			err = fmt.Errorf("line %d is longer than %d bytes", number+1, MaxLineLength)
+		}
+		return im.report, err
+	}
+	im.apply(batch)
+	return im.report, nil
+}
+
+// parse decodes a line and checks it holds a complete post or comment, as the create routes do.
+func parse(data []byte) (Record, error) {
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, fmt.Errorf("Could not deserialize record: %v", err)
+	}
+	switch record.Type {
+	case TypePost:
+		post := record.Post
+		if post == nil || post.Id == 0 || post.Title == "" || post.Content == "" || post.CreationDate.IsZero() {
+			return record, errors.New("Could not deserialize post JSON payload")
+		}
+		record.Comment = nil
+	case TypeComment:
+		comment := record.Comment
+		if comment == nil || comment.Id == 0 || comment.PostId == 0 || comment.Comment == "" ||
+			comment.Author == "" || comment.CreationDate.IsZero() {
+			return record, errors.New("Could not deserialize comment JSON payload")
+		}
+		record.Post = nil
+	default:
+		return record, fmt.Errorf("Unknown record type: %q", record.Type)
+	}
+	return record, nil
+}
+
+// parse is parse followed by the normalization of posts and comments, when the options ask for it.
+func (im *importer) parse(data []byte) (Record, error) {
+	record, err := parse(data)
+	switch {
+	case err != nil:
+		return record, err
+	case record.Post != nil && im.opts.NormalizePost != nil:
+		post, err := im.opts.NormalizePost(*record.Post)
+		if err != nil {
+			return record, err
+		}
+		record.Post = &post
+	case record.Comment != nil && im.opts.NormalizeComment != nil:
+		comment, err := im.opts.NormalizeComment(*record.Comment)
+		if err != nil {
+			return record, err
+		}
+		record.Comment = &comment
+	}
+	return record, nil
+}
+
+func (im *importer) fail(number int, status int, message string) {
+	im.report.Errors = append(im.report.Errors, LineError{Line: number, Status: status, Message: message})
+}
+
+func (im *importer) exists(record Record) bool {
+	if record.Post != nil {
+		if im.seenPosts[record.Post.Id] {
+			return true
+		}
+		_, err := im.posts.GetById(record.Post.Id)
+		return err == nil
+	}
+	if im.seenComments[record.Comment.Id] {
+		return true
+	}
+	_, err := im.comments.GetById(record.Comment.Id)
+	return err == nil
+}
+
+// apply imports a batch and reports whether the import may go on.
+func (im *importer) apply(batch []line) bool {
+	if im.opts.OnConflict == Fail {
+		// Ids repeated within the batch conflict as well.
+		posts, comments := make(map[uint64]bool), make(map[uint64]bool)
+		for _, l := range batch {
+			batched := posts
+			if l.record.Comment != nil {
+				batched = comments
+			}
+			if batched[l.record.id()] || im.exists(l.record) {
+				im.fail(l.number, http.StatusConflict, conflictMessage(l.record))
+				im.report.Aborted = true
+				return false
+			}
+			batched[l.record.id()] = true
+		}
+	}
+
+	for _, l := range batch {
+		counts := &im.report.Posts
+		if l.record.Comment != nil {
+			counts = &im.report.Comments
+			if err := im.checkParent(*l.record.Comment); err != nil {
+				im.fail(l.number, http.StatusBadRequest, err.Error())
+				continue
+			}
+		}
+		if !im.exists(l.record) {
+			if err := im.insert(l.record); err != nil {
+				im.fail(l.number, http.StatusConflict, conflictMessage(l.record))
+				continue
+			}
+			im.imported(l.record)
+			counts.Created++
+			continue
+		}
+
+		switch im.opts.OnConflict {
+		case Skip:
+			counts.Skipped++
+		case Overwrite:
+			if err := im.overwrite(l.record); err != nil {
+				im.fail(l.number, http.StatusInternalServerError, err.Error())
+				continue
+			}
+			im.imported(l.record)
+			counts.Overwritten++
+		default:
+			// Another request took the id since the batch was checked.
+			im.fail(l.number, http.StatusConflict, conflictMessage(l.record))
+			im.report.Aborted = true
+			return false
+		}
+	}
+	return true
+}
+
+func (im *importer) checkParent(comment model.Comment) error {
+	if im.opts.CheckParent == nil {
+		return nil
+	}
+	return im.opts.CheckParent(comment, func(id uint64) (model.Comment, bool) {
+		if imported, ok := im.importedComments[id]; ok {
+			return imported, true
+		}
+		stored, err := im.comments.GetById(id)
+		if err != nil {
+			return model.Comment{}, false
+		}
+		return *stored, true
+	})
+}
+
+// imported records a comment once it has been imported, or would have been in a dry run.
+func (im *importer) imported(record Record) {
+	if record.Comment != nil {
+		im.importedComments[record.Comment.Id] = *record.Comment
+	}
+}
+
+func (im *importer) insert(record Record) error {
+	if record.Post != nil {
+		im.seenPosts[record.Post.Id] = true
+		if im.opts.DryRun {
+			return nil
+		}
+		return im.posts.Insert(*record.Post)
+	}
+	im.seenComments[record.Comment.Id] = true
+	if im.opts.DryRun {
+		return nil
+	}
+	return im.comments.Insert(*record.Comment)
+}
+
+func (im *importer) overwrite(record Record) error {
+	if im.opts.DryRun {
+		return nil
+	}
+	var err error
+	if record.Post != nil {
+		previous, lookupErr := im.posts.GetById(record.Post.Id)
+		post := *record.Post
+		post.Version = repository.AnyVersion
+		var updated *model.Post
+		if updated, err = im.posts.Update(post); err == nil && lookupErr == nil && im.opts.Overwritten != nil {
+			im.opts.Overwritten(*previous, *updated)
+		}
+	} else {
+		comment := *record.Comment
+		comment.Version = repository.AnyVersion
+		_, err = im.comments.Update(comment)
+	}
+	// Not found: the post or comment was deleted meanwhile, insert it again.
+	var postNotFound repository.PostNotFoundError
+	var commentNotFound repository.CommentNotFoundError
+	if errors.As(err, &postNotFound) || errors.As(err, &commentNotFound) {
+		return im.insert(record)
+	}
+	return err
+}
+
+func conflictMessage(record Record) string {
+	if record.Post != nil {
+		return fmt.Sprintf("Post with id: %d already exists", record.Post.Id)
+	}
+	return fmt.Sprintf("Comment with id: %d already exists", record.Comment.Id)
+}
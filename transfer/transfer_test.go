@@ -0,0 +1,266 @@
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/model"
+	"gitlab.com/devskiller-tasks/rest-api-blog-golang/repository"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testDate = time.Date(2018, time.September, 16, 12, 0, 0, 0, time.UTC)
+	post1    = model.Post{Id: 1, Title: "first", Content: "content", Author: "alice", CreationDate: testDate}
+	post2    = model.Post{Id: 2, Title: "second", Content: "content", Author: "bob", CreationDate: testDate, ModificationDate: testDate.Add(time.Hour), Version: 3}
+	comment1 = model.Comment{Id: 10, PostId: 1, Comment: "comment", Author: "reader", CreationDate: testDate, Hidden: true, Version: 1}
+)
+
+func repositories(posts []model.Post, comments []model.Comment) (*repository.PostRepository, *repository.CommentRepository) {
+	postRepository := repository.CustomPostRepository(posts)
+	commentRepository := repository.CustomCommentRepository(comments)
+	return &postRepository, &commentRepository
+}
+
+func TestExport(t *testing.T) {
+	// GIVEN
+	posts, comments := repositories([]model.Post{post2, post1}, []model.Comment{comment1})
+	var dump bytes.Buffer
+
+	// WHEN
+	require.NoError(t, Export(&dump, posts, comments))
+
+	// THEN
+	lines := strings.Split(strings.TrimSpace(dump.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.JSONEq(t, `{"type": "post", "post": {"Id": 1, "Title": "first", "Content": "content", "Author": "alice",
+		"CreationDate": "2018-09-16T12:00:00Z", "ModificationDate": "0001-01-01T00:00:00Z", "Version": 0}}`, lines[0])
+	assert.Contains(t, lines[1], `"Id":2`)
+	assert.JSONEq(t, `{"type": "comment", "comment": {"Id": 10, "PostId": 1, "Comment": "comment", "Author": "reader",
+		"CreationDate": "2018-09-16T12:00:00Z", "Hidden": true, "Version": 1}}`, lines[2])
+
+	// WHEN the dump is imported into empty repositories
+	importedPosts, importedComments := repositories(nil, nil)
+	report, err := Import(&dump, importedPosts, importedComments, Options{})
+
+	// THEN every field is preserved
+	require.NoError(t, err)
+	assert.Equal(t, Report{Posts: Counts{Created: 2}, Comments: Counts{Created: 1}, Errors: []LineError{}}, report)
+	assert.Equal(t, posts.GetAll(), importedPosts.GetAll())
+	assert.Equal(t, comments.GetAll(), importedComments.GetAll())
+}
+
+func TestImportConflicts(t *testing.T) {
+	dump := `{"type": "post", "post": {"Id": 1, "Title": "imported", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "post", "post": {"Id": 3, "Title": "new", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "comment", "comment": {"Id": 10, "PostId": 1, "Comment": "imported", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z"}}
+`
+	tests := []struct {
+		testName         string
+		opts             Options
+		expected         Report
+		expectedTitles   []string
+		expectedComment  string
+		expectedCommentV uint64
+	}{
+		{
+			testName:        "skip",
+			opts:            Options{OnConflict: Skip},
+			expected:        Report{Posts: Counts{Created: 1, Skipped: 1}, Comments: Counts{Skipped: 1}, Errors: []LineError{}},
+			expectedTitles:  []string{"first", "second", "new"},
+			expectedComment: "comment", expectedCommentV: 1,
+		},
+		{
+			testName:        "overwrite",
+			opts:            Options{OnConflict: Overwrite},
+			expected:        Report{Posts: Counts{Created: 1, Overwritten: 1}, Comments: Counts{Overwritten: 1}, Errors: []LineError{}},
+			expectedTitles:  []string{"imported", "second", "new"},
+			expectedComment: "imported", expectedCommentV: 2,
+		},
+		{
+			testName: "fail",
+			opts:     Options{OnConflict: Fail},
+			expected: Report{Errors: []LineError{{Line: 1, Status: 409, Message: "Post with id: 1 already exists"}}, Aborted: true},
+			// The conflict is in the first and only batch, so nothing is imported.
+			expectedTitles:  []string{"first", "second"},
+			expectedComment: "comment", expectedCommentV: 1,
+		},
+		{
+			testName: "dryRun",
+			opts:     Options{OnConflict: Overwrite, DryRun: true},
+			expected: Report{
+				DryRun: true, Posts: Counts{Created: 1, Overwritten: 1}, Comments: Counts{Overwritten: 1}, Errors: []LineError{},
+			},
+			expectedTitles:  []string{"first", "second"},
+			expectedComment: "comment", expectedCommentV: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.testName, func(t *testing.T) {
+			// GIVEN
+			posts, comments := repositories([]model.Post{post1, post2}, []model.Comment{comment1})
+
+			// WHEN
+			report, err := Import(strings.NewReader(dump), posts, comments, tc.opts)
+
+			// THEN
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, report)
+			var titles []string
+			for _, post := range posts.GetAll() {
+				titles = append(titles, post.Title)
+			}
+			assert.Equal(t, tc.expectedTitles, titles)
+			comment, _ := comments.GetById(10)
+			assert.Equal(t, tc.expectedComment, comment.Comment)
+			assert.Equal(t, tc.expectedCommentV, comment.Version)
+		})
+	}
+}
+
+func TestImportFailKeepsEarlierBatches(t *testing.T) {
+	// GIVEN a dump repeating a post in its second batch
+	dump := `{"type": "post", "post": {"Id": 5, "Title": "t", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "post", "post": {"Id": 6, "Title": "t", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "post", "post": {"Id": 7, "Title": "t", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "post", "post": {"Id": 5, "Title": "t", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "post", "post": {"Id": 8, "Title": "t", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"}}
+`
+	for _, dryRun := range []bool{false, true} {
+		posts, comments := repositories(nil, nil)
+
+		// WHEN
+		report, err := Import(strings.NewReader(dump), posts, comments, Options{BatchSize: 2, DryRun: dryRun})
+
+		// THEN
+		require.NoError(t, err)
+		assert.Equal(t, Counts{Created: 2}, report.Posts)
+		assert.Equal(t, []LineError{{Line: 4, Status: 409, Message: "Post with id: 5 already exists"}}, report.Errors)
+		assert.True(t, report.Aborted)
+		if !dryRun {
+			assert.Len(t, posts.GetAll(), 2)
+		} else {
+			assert.Empty(t, posts.GetAll())
+		}
+	}
+}
+
+func TestImportLineErrors(t *testing.T) {
+	// GIVEN
+	dump := `{"type": "post", "post": {"Id": 1, "Title": "t", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"}}
+not json
+
+{"type": "post", "post": {"Id": 2, "Title": "t"}}
+{"type": "comment", "comment": {"Id": 1, "PostId": 1, "Comment": "c", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "tag"}
+{"type": "comment", "comment": {"Id": 1, "PostId": 1, "Comment": "c", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z"}}`
+	posts, comments := repositories(nil, nil)
+
+	// WHEN
+	report, err := Import(strings.NewReader(dump), posts, comments, Options{})
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, Counts{Created: 1}, report.Posts)
+	assert.Equal(t, Counts{Created: 1}, report.Comments)
+	assert.Equal(t, []LineError{
+		{Line: 2, Status: 400, Message: "Could not deserialize record: invalid character 'o' in literal null (expecting 'u')"},
+		{Line: 4, Status: 400, Message: "Could not deserialize post JSON payload"},
+		{Line: 5, Status: 400, Message: "Could not deserialize comment JSON payload"},
+		{Line: 6, Status: 400, Message: `Unknown record type: "tag"`},
+	}, report.Errors)
+}
+
+func TestImportHooks(t *testing.T) {
+	// GIVEN
+	dump := `{"type": "post", "post": {"Id": 1, "Title": "imported", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "comment", "comment": {"Id": 11, "PostId": 1, "Comment": "  spaced  ", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "comment", "comment": {"Id": 12, "PostId": 1, "Comment": "rejected", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "post", "post": {"Id": 2, "Title": "rejected", "Content": "c", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "post", "post": {"Id": 3, "Title": "tagged", "Content": "c", "Tags": ["Go"], "CreationDate": "2018-09-16T12:00:00Z"}}`
+	posts, comments := repositories([]model.Post{post1}, nil)
+	var overwritten [][2]string
+	opts := Options{
+		OnConflict: Overwrite,
+		NormalizePost: func(post model.Post) (model.Post, error) {
+			if post.Title == "rejected" {
+				return post, errors.New("Post is rejected")
+			}
+			for i, tag := range post.Tags {
+				post.Tags[i] = strings.ToLower(tag)
+			}
+			return post, nil
+		},
+		NormalizeComment: func(comment model.Comment) (model.Comment, error) {
+			if comment.Comment == "rejected" {
+				return comment, errors.New("Comment is rejected")
+			}
+			comment.Comment = strings.TrimSpace(comment.Comment)
+			return comment, nil
+		},
+		Overwritten: func(previous model.Post, post model.Post) {
+			overwritten = append(overwritten, [2]string{previous.Title, post.Title})
+		},
+	}
+
+	// WHEN
+	report, err := Import(strings.NewReader(dump), posts, comments, opts)
+
+	// THEN
+	require.NoError(t, err)
+	assert.Equal(t, Counts{Created: 1, Overwritten: 1}, report.Posts)
+	assert.Equal(t, Counts{Created: 1}, report.Comments)
+	assert.Equal(t, []LineError{
+		{Line: 3, Status: 400, Message: "Comment is rejected"},
+		{Line: 4, Status: 400, Message: "Post is rejected"},
+	}, report.Errors)
+	assert.Equal(t, [][2]string{{"first", "imported"}}, overwritten)
+	comment, _ := comments.GetById(11)
+	assert.Equal(t, "spaced", comment.Comment)
+	post, _ := posts.GetById(3)
+	assert.Equal(t, []string{"go"}, post.Tags)
+}
+
+func TestImportChecksParents(t *testing.T) {
+	// GIVEN
+	dump := `{"type": "comment", "comment": {"Id": 11, "PostId": 1, "ParentId": 10, "Comment": "c", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "comment", "comment": {"Id": 12, "PostId": 1, "ParentId": 11, "Comment": "c", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z"}}
+{"type": "comment", "comment": {"Id": 13, "PostId": 1, "ParentId": 99, "Comment": "c", "Author": "a", "CreationDate": "2018-09-16T12:00:00Z"}}`
+	posts, comments := repositories([]model.Post{post1}, []model.Comment{comment1})
+	var checked []uint64
+	opts := Options{DryRun: true, CheckParent: func(comment model.Comment, lookup func(id uint64) (model.Comment, bool)) error {
+		if _, ok := lookup(comment.ParentId); !ok {
+			return errors.New("Parent comment does not exist")
+		}
+		checked = append(checked, comment.Id)
+		return nil
+	}}
+
+	// WHEN
+	report, err := Import(strings.NewReader(dump), posts, comments, opts)
+
+	// THEN replies may answer stored comments and those imported before them
+	require.NoError(t, err)
+	assert.Equal(t, Counts{Created: 2}, report.Comments)
+	assert.Equal(t, []LineError{{Line: 3, Status: 400, Message: "Parent comment does not exist"}}, report.Errors)
+	assert.Equal(t, []uint64{11, 12}, checked)
+}
+
+func TestImportLineTooLong(t *testing.T) {
+	posts, comments := repositories(nil, nil)
+	_, err := Import(strings.NewReader(strings.Repeat("x", MaxLineLength+1)), posts, comments, Options{})
+	assert.EqualError(t, err, "line 1 is longer than 1048576 bytes")
+}
+
+func TestParseStrategy(t *testing.T) {
+	strategy, err := ParseStrategy("skip")
+	assert.NoError(t, err)
+	assert.Equal(t, Skip, strategy)
+
+	_, err = ParseStrategy("merge")
+	assert.EqualError(t, err, "Unknown conflict strategy: merge")
+}